@@ -0,0 +1,100 @@
+// Package artifacts manages the directory of files saved for each run, such
+// as the benchmark's raw output, the resolved config, the log and the exported
+// documents, and bundles them up to be attached to bug reports.
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// Names of the files gobench saves into the artifacts directory. Benchmarks
+// save their own files alongside these.
+const (
+	LogFile       string = "gobench.log"
+	ConfigFile    string = "config.json"
+	DocumentsFile string = "documents.ndjson"
+	ReportFile    string = "report.json"
+)
+
+// Redacted replaces secrets within the config saved to the artifacts directory.
+const Redacted string = "REDACTED"
+
+// DefaultDir returns the default artifacts directory for the run with the
+// given ID, being `gobench-<RunID>` within the working directory.
+func DefaultDir(runID string) string {
+	return fmt.Sprintf("gobench-%s", runID)
+}
+
+// Dir returns the artifacts directory for a run with the given Config, being
+// its ArtifactsDir or DefaultDir if it isn't set. An empty string is returned
+// if artifacts are disabled.
+func Dir(cfg *define.Config) string {
+	if cfg.DisableArtifacts {
+		return ""
+	}
+	if len(cfg.ArtifactsDir) > 0 {
+		return cfg.ArtifactsDir
+	}
+	return DefaultDir(cfg.RunID)
+}
+
+// Write writes the given data to the file with the given name within the
+// given artifacts directory, creating any directories needed.
+func Write(dir string, name string, data []byte) error {
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("unable to create artifacts directory for %s: %s", path, err)
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("unable to write artifact %s: %s", path, err)
+	}
+	return nil
+}
+
+// RedactURL replaces the password within the given URL, if it has one.
+func RedactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL
+	}
+	if _, hasPassword := parsed.User.Password(); hasPassword {
+		parsed.User = url.UserPassword(parsed.User.Username(), Redacted)
+	}
+	return parsed.String()
+}
+
+// RedactSecret replaces the given secret, if it is set.
+func RedactSecret(secret string) string {
+	if len(secret) == 0 {
+		return secret
+	}
+	return Redacted
+}
+
+// RedactConfig returns a copy of the given Config with passwords replaced,
+// including those embedded within URLs, so it can be shared safely.
+func RedactConfig(cfg *define.Config) define.Config {
+	redacted := *cfg
+	redacted.ElasticsearchURL = RedactURL(cfg.ElasticsearchURL)
+	redacted.ElasticsearchPassword = RedactSecret(cfg.ElasticsearchPassword)
+	redacted.OpenSearchURL = RedactURL(cfg.OpenSearchURL)
+	redacted.OpenSearchPassword = RedactSecret(cfg.OpenSearchPassword)
+	return redacted
+}
+
+// WriteConfig saves the given Config, with secrets redacted, into the given
+// artifacts directory.
+func WriteConfig(dir string, cfg *define.Config) error {
+	marshalled, err := json.MarshalIndent(RedactConfig(cfg), "", "    ")
+	if err != nil {
+		return fmt.Errorf("unable to marshal config: %s", err)
+	}
+	return Write(dir, ConfigFile, marshalled)
+}
@@ -0,0 +1,185 @@
+// bundle.go defines functionality for packing an artifacts directory into a
+// tar.gz, along with a manifest of its contents.
+package artifacts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Names of the files added to each bundle, describing its contents.
+const (
+	ManifestFile  string = "manifest.json"
+	ChecksumsFile string = "SHA256SUMS"
+)
+
+// ManifestEntry describes a file within a bundle. Path is relative to the
+// artifacts directory, using forward slashes.
+type ManifestEntry struct {
+	Path   string
+	Size   int64
+	SHA256 string
+}
+
+// Manifest describes the contents of a bundle.
+type Manifest struct {
+	RunID     string
+	CreatedAt time.Time
+	Files     []ManifestEntry
+}
+
+// Checksums returns the checksum of each file in the manifest, in the format
+// used by `sha256sum`, so a bundle can be checked with `sha256sum -c`.
+func (m *Manifest) Checksums() []byte {
+	var checksums bytes.Buffer
+	for _, file := range m.Files {
+		fmt.Fprintf(&checksums, "%s  %s\n", file.SHA256, file.Path)
+	}
+	return checksums.Bytes()
+}
+
+// hashFile returns the size and hex-encoded SHA-256 checksum of the file at
+// the given path.
+func hashFile(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// BuildManifest builds a Manifest of every regular file within the given
+// artifacts directory, sorted by path.
+func BuildManifest(dir string, runID string) (*Manifest, error) {
+	manifest := &Manifest{
+		RunID:     runID,
+		CreatedAt: time.Now().UTC(),
+		Files:     []ManifestEntry{},
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		size, checksum, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			Path:   filepath.ToSlash(relative),
+			Size:   size,
+			SHA256: checksum,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read artifacts directory %s: %s", dir, err)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+	return manifest, nil
+}
+
+// addTarFile adds a file with the given name and contents to the given tar writer.
+func addTarFile(writer *tar.Writer, name string, reader io.Reader, size int64, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	}
+	if err := writer.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(writer, reader)
+	return err
+}
+
+// Bundle packs every file within the given artifacts directory into a tar.gz
+// at the given output path, returning the Manifest of the files packed.
+// Files are placed within a `gobench-<RunID>` directory inside the archive,
+// alongside a ManifestFile and a ChecksumsFile describing them. Files are
+// checked against the manifest as they are packed, so files which change
+// while bundling are reported as an error.
+func Bundle(dir string, runID string, output string) (*Manifest, error) {
+	manifest, err := BuildManifest(dir, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	outputFile, err := os.Create(output)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create bundle %s: %s", output, err)
+	}
+	defer outputFile.Close()
+	gzipWriter := gzip.NewWriter(outputFile)
+	tarWriter := tar.NewWriter(gzipWriter)
+	prefix := DefaultDir(runID)
+
+	for _, entry := range manifest.Files {
+		file, err := os.Open(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+		if err != nil {
+			return nil, fmt.Errorf("unable to open artifact %s: %s", entry.Path, err)
+		}
+		hash := sha256.New()
+		err = addTarFile(
+			tarWriter, prefix+"/"+entry.Path,
+			io.TeeReader(file, hash), entry.Size, manifest.CreatedAt,
+		)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("unable to add artifact %s to bundle: %s", entry.Path, err)
+		}
+		if checksum := fmt.Sprintf("%x", hash.Sum(nil)); checksum != entry.SHA256 {
+			return nil, fmt.Errorf("artifact %s changed while it was being bundled", entry.Path)
+		}
+	}
+
+	marshalled, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal manifest: %s", err)
+	}
+	checksums := manifest.Checksums()
+	for name, contents := range map[string][]byte{
+		ManifestFile:  marshalled,
+		ChecksumsFile: checksums,
+	} {
+		err := addTarFile(
+			tarWriter, prefix+"/"+name,
+			bytes.NewReader(contents), int64(len(contents)), manifest.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("unable to add %s to bundle: %s", name, err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return nil, fmt.Errorf("unable to write bundle %s: %s", output, err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("unable to write bundle %s: %s", output, err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,150 @@
+//go:build uperf
+// +build uperf
+
+package uperf
+
+import (
+	"math"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// BenchmarkName is the name of the benchmark attached to each uperf document.
+const BenchmarkName string = "uperf"
+
+// DocumentKindRunInfo is the kind given to UperfRunInfoPayload documents.
+const DocumentKindRunInfo string = "run_info"
+
+// metadataTimestamp returns the timestamp within the given Metadata, or the
+// zero time if the Metadata hasn't been set.
+func metadataTimestamp(metadata *define.Metadata) time.Time {
+	if metadata == nil {
+		return time.Time{}
+	}
+	return metadata.Timestamp
+}
+
+// millisecondsToTime converts a unix timestamp in milliseconds, as printed by
+// uperf, into a time.Time.
+func millisecondsToTime(timestampMS float64) time.Time {
+	seconds, fraction := math.Modf(timestampMS / 1000)
+	return time.Unix(int64(seconds), int64(fraction*float64(time.Second))).UTC()
+}
+
+// BenchmarkName returns BenchmarkName.
+func (ds *DetailsStat) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns the SectionType of the stat, such as StatSectionTX or
+// StatSectionInterval.
+func (ds *DetailsStat) DocumentKind() string { return string(ds.SectionType) }
+
+// DocumentTimestamp returns the time uperf recorded the stat, if it was
+// parsed in the raw format. Otherwise, the time the run started is returned.
+func (ds *DetailsStat) DocumentTimestamp() time.Time {
+	if ds.TimestampMS > 0 {
+		return millisecondsToTime(ds.TimestampMS)
+	}
+	return metadataTimestamp(ds.Metadata)
+}
+
+// SetMetadata attaches the run's Metadata to the stat.
+func (ds *DetailsStat) SetMetadata(metadata *define.Metadata) { ds.Metadata = metadata }
+
+// Fields returns the stat flattened by define.FlattenFields.
+func (ds *DetailsStat) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(ds)
+}
+
+// BenchmarkName returns BenchmarkName.
+func (as *AveragesStat) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns the SectionType of the stat, being StatSectionTxAvg or
+// StatSectionFlowopAvg.
+func (as *AveragesStat) DocumentKind() string { return string(as.SectionType) }
+
+// DocumentTimestamp returns the time the run started, as uperf doesn't
+// timestamp its averages.
+func (as *AveragesStat) DocumentTimestamp() time.Time { return metadataTimestamp(as.Metadata) }
+
+// SetMetadata attaches the run's Metadata to the stat.
+func (as *AveragesStat) SetMetadata(metadata *define.Metadata) { as.Metadata = metadata }
+
+// Fields returns the stat flattened by define.FlattenFields.
+func (as *AveragesStat) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(as)
+}
+
+// BenchmarkName returns BenchmarkName.
+func (ns *NetstatStat) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns StatSectionNetstat, set as the stat's SectionType.
+func (ns *NetstatStat) DocumentKind() string { return string(ns.SectionType) }
+
+// DocumentTimestamp returns the time the run started, as uperf doesn't
+// timestamp its netstat output.
+func (ns *NetstatStat) DocumentTimestamp() time.Time { return metadataTimestamp(ns.Metadata) }
+
+// SetMetadata attaches the run's Metadata to the stat.
+func (ns *NetstatStat) SetMetadata(metadata *define.Metadata) { ns.Metadata = metadata }
+
+// Fields returns the stat flattened by define.FlattenFields.
+func (ns *NetstatStat) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(ns)
+}
+
+// BenchmarkName returns BenchmarkName.
+func (rs *RunStat) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns StatSectionRun, set as the stat's SectionType.
+func (rs *RunStat) DocumentKind() string { return string(rs.SectionType) }
+
+// DocumentTimestamp returns the time the run started.
+func (rs *RunStat) DocumentTimestamp() time.Time { return metadataTimestamp(rs.Metadata) }
+
+// SetMetadata attaches the run's Metadata to the stat.
+func (rs *RunStat) SetMetadata(metadata *define.Metadata) { rs.Metadata = metadata }
+
+// Fields returns the stat flattened by define.FlattenFields.
+func (rs *RunStat) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(rs)
+}
+
+// BenchmarkName returns BenchmarkName.
+func (rds *RunDiffStat) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns StatSectionRunDiff, set as the stat's SectionType.
+func (rds *RunDiffStat) DocumentKind() string { return string(rds.SectionType) }
+
+// DocumentTimestamp returns the time the run started.
+func (rds *RunDiffStat) DocumentTimestamp() time.Time { return metadataTimestamp(rds.Metadata) }
+
+// SetMetadata attaches the run's Metadata to the stat.
+func (rds *RunDiffStat) SetMetadata(metadata *define.Metadata) { rds.Metadata = metadata }
+
+// Fields returns the stat flattened by define.FlattenFields.
+func (rds *RunDiffStat) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(rds)
+}
+
+// BenchmarkName returns BenchmarkName.
+func (ri *UperfRunInfoPayload) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns DocumentKindRunInfo.
+func (ri *UperfRunInfoPayload) DocumentKind() string { return DocumentKindRunInfo }
+
+// DocumentTimestamp returns the time uperf was started.
+func (ri *UperfRunInfoPayload) DocumentTimestamp() time.Time {
+	if ri.StartTime.IsZero() {
+		return metadataTimestamp(ri.Metadata)
+	}
+	return ri.StartTime
+}
+
+// SetMetadata attaches the run's Metadata to the run info.
+func (ri *UperfRunInfoPayload) SetMetadata(metadata *define.Metadata) { ri.Metadata = metadata }
+
+// Fields returns the run info flattened by define.FlattenFields.
+func (ri *UperfRunInfoPayload) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(ri)
+}
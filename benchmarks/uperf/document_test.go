@@ -0,0 +1,76 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// TestUperfPayloadsImplementDocument ensures that each payload the uperf
+// benchmark exports implements the define.Document interface.
+func TestUperfPayloadsImplementDocument(t *testing.T) {
+	payloads := []interface{}{
+		&DetailsStat{},
+		&AveragesStat{},
+		&NetstatStat{},
+		&RunStat{},
+		&RunDiffStat{},
+		&UperfRunInfoPayload{},
+	}
+
+	for _, payload := range payloads {
+		if _, ok := payload.(define.Document); !ok {
+			t.Errorf("%T failed Document type assertion", payload)
+		}
+	}
+}
+
+// TestParsedStatsAreDocuments checks that stats parsed from uperf's stdout
+// report their kind and timestamp, and accept metadata.
+func TestParsedStatsAreDocuments(t *testing.T) {
+	out, err := ParseUperfStdout(UPERF_TEST_STDOUT_ALL_ARGS_RAW)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing stdout: %s", err)
+	}
+
+	metadata := &define.Metadata{RunID: "abc-123", Benchmark: BenchmarkName}
+	for _, document := range *out {
+		document.SetMetadata(metadata)
+		if document.BenchmarkName() != BenchmarkName {
+			t.Errorf(
+				"Expected benchmark name %s, instead got %s",
+				BenchmarkName, document.BenchmarkName(),
+			)
+		}
+		if len(document.DocumentKind()) == 0 {
+			t.Errorf("Expected document kind to be set for %+v", document)
+		}
+		fields, err := document.Fields()
+		if err != nil {
+			t.Errorf("Unexpected error while getting fields: %s", err)
+		}
+		if fields["Metadata.RunID"] != "abc-123" {
+			t.Errorf(
+				"Expected Metadata.RunID to be abc-123, instead got %v",
+				fields["Metadata.RunID"],
+			)
+		}
+
+		stat, ok := document.(*DetailsStat)
+		if !ok || stat.DetailFormat != DetailsFormatRaw {
+			continue
+		}
+		// Test stdout was recorded in February 2022
+		timestamp := stat.DocumentTimestamp()
+		if timestamp.Year() != 2022 || timestamp.Month() != time.February {
+			t.Errorf(
+				"Expected raw stat timestamp from timestamp_ms %f, instead got %s",
+				stat.TimestampMS, timestamp,
+			)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+//go:build uperf
+// +build uperf
+
+// failure.go defines functionality for describing why a run of uperf failed.
+package uperf
+
+import (
+	"strings"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// StatSectionFailure is the section given to UperfFailure documents.
+const StatSectionFailure StatSectionType = "failure"
+
+// failureTailLines is the number of lines kept from the end of uperf's stdout
+// and stderr within an UperfFailure.
+const failureTailLines int = 50
+
+// UperfFailureKind classifies why a run of uperf failed.
+type UperfFailureKind string
+
+const (
+	// FailureConnectionRefused means the remote host refused uperf's
+	// connection, usually because a uperf server isn't running on it.
+	FailureConnectionRefused UperfFailureKind = "connection_refused"
+	// FailureUnreachable means there was no network route to the remote host.
+	FailureUnreachable UperfFailureKind = "host_unreachable"
+	// FailureNameResolution means the remote host's name couldn't be resolved.
+	FailureNameResolution UperfFailureKind = "name_resolution"
+	// FailureTimeout means uperf timed out waiting on the remote host.
+	FailureTimeout UperfFailureKind = "timeout"
+	// FailureHandshake means uperf's handshake with the remote host failed.
+	FailureHandshake UperfFailureKind = "handshake_failure"
+	// FailureSSL means uperf reported an SSL failure, ie `SSL_connect failed`.
+	FailureSSL UperfFailureKind = "ssl_error"
+	// FailureResource means uperf was unable to get a resource it needs,
+	// reported by uperf as `Error getting ...`.
+	FailureResource UperfFailureKind = "resource_error"
+	// FailureStart means uperf could not be started, ie it isn't installed.
+	FailureStart UperfFailureKind = "start_error"
+	// FailureParse means uperf's stdout could not be parsed.
+	FailureParse UperfFailureKind = "parse_error"
+	// FailureDeadline means uperf was stopped for running longer than its
+	// timeout, see UperfBenchmark.Timeout.
+	FailureDeadline UperfFailureKind = "deadline_exceeded"
+	// FailureExit means uperf exited with an error, without printing a
+	// message matching any other kind of failure.
+	FailureExit UperfFailureKind = "exit_error"
+)
+
+// failurePatterns matches known uperf failure messages to the kind of failure
+// they describe, in order of precedence. Patterns are matched against
+// lowercased lines of output.
+// The patterns for SSL and resource errors come last, letting the message
+// which actually caused the failure take precedence.
+var failurePatterns []struct {
+	kind     UperfFailureKind
+	patterns []string
+} = []struct {
+	kind     UperfFailureKind
+	patterns []string
+}{
+	{FailureConnectionRefused, []string{"connection refused"}},
+	{FailureUnreachable, []string{"no route to host", "network is unreachable"}},
+	{FailureNameResolution, []string{"name or service not known", "unknown host", "could not resolve"}},
+	{FailureTimeout, []string{"timed out", "timeout"}},
+	{FailureHandshake, []string{"handshake"}},
+	{FailureSSL, []string{"ssl"}},
+	{FailureResource, []string{"error getting"}},
+}
+
+// sslBanner is printed by uperf on every run, including successful ones, so
+// lines holding it say nothing about why a run failed.
+const sslBanner string = "error getting ssl ctx"
+
+// ClassifyUperfFailure looks through the given output from a failed run of
+// uperf for known failure messages, returning the kind of failure and the
+// line describing it.
+// Stderr is searched before stdout. If no known message is found, then
+// FailureExit is returned along with an empty line.
+// Lines which only report progress, such as uperf's handshake phases, are
+// ignored unless they also mention an error or failure. Uperf's SSL banner,
+// see sslBanner, is always ignored.
+func ClassifyUperfFailure(stdout string, stderr string) (UperfFailureKind, string) {
+	lines := append(
+		strings.Split(strings.ReplaceAll(stderr, "\r", "\n"), "\n"),
+		strings.Split(strings.ReplaceAll(stdout, "\r", "\n"), "\n")...,
+	)
+
+	for _, failure := range failurePatterns {
+		for _, line := range lines {
+			lowered := strings.ToLower(line)
+			if strings.Contains(lowered, sslBanner) {
+				continue
+			}
+			if (failure.kind == FailureHandshake || failure.kind == FailureSSL) &&
+				!strings.Contains(lowered, "fail") && !strings.Contains(lowered, "error") {
+				continue
+			}
+			for _, pattern := range failure.patterns {
+				if strings.Contains(lowered, pattern) {
+					return failure.kind, strings.TrimSpace(line)
+				}
+			}
+		}
+	}
+	return FailureExit, ""
+}
+
+// tailLines returns up to the last n lines of the given output.
+func tailLines(output string, n int) string {
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// UperfFailure describes a failed run of uperf.
+// Kind classifies the failure, and Message holds the line of uperf's output
+// the classification was based on, if there was one. StdoutTail and
+// StderrTail hold the last lines uperf printed. ExitCode is -1 if uperf
+// didn't exit on its own, ie it couldn't be started.
+type UperfFailure struct {
+	Metadata    *define.Metadata
+	SectionType StatSectionType
+	Kind        UperfFailureKind
+	Message     string `json:",omitempty"`
+	Error       string
+	ExitCode    int
+	Cmd         []string
+	StdoutTail  string
+	StderrTail  string
+	StartTime   time.Time
+	EndTime     time.Time
+	StartTimeMS int64
+	EndTimeMS   int64
+}
+
+// BenchmarkName returns BenchmarkName.
+func (uf *UperfFailure) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns StatSectionFailure, so failed runs can be found
+// alongside the results of those which passed.
+func (uf *UperfFailure) DocumentKind() string { return string(uf.SectionType) }
+
+// DocumentTimestamp returns the time the failed run ended.
+func (uf *UperfFailure) DocumentTimestamp() time.Time { return uf.EndTime }
+
+// SetMetadata attaches the run's Metadata to the failure.
+func (uf *UperfFailure) SetMetadata(metadata *define.Metadata) { uf.Metadata = metadata }
+
+// Fields returns the failure flattened by define.FlattenFields.
+func (uf *UperfFailure) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(uf)
+}
@@ -0,0 +1,140 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestClassifyUperfFailure checks that known failure messages are classified,
+// with messages on stderr and more specific messages taking precedence, and
+// that uperf's SSL banner is ignored.
+func TestClassifyUperfFailure(t *testing.T) {
+	tests := []struct {
+		stdout  string
+		stderr  string
+		kind    UperfFailureKind
+		message string
+	}{
+		{
+			"Error getting SSL CTX:1\nStarting handshake phase 2",
+			"** [10.0.0.2] Error connecting: Connection refused\n",
+			FailureConnectionRefused, "** [10.0.0.2] Error connecting: Connection refused",
+		},
+		{"Error getting SSL CTX:1\nHandshake phase 1 failed\n", "", FailureHandshake, "Handshake phase 1 failed"},
+		{"Error getting SSL CTX:1\n", "", FailureExit, ""},
+		{"Error getting SSL CTX:1\n** Error: Thread 0 exited with error 42\n", "", FailureExit, ""},
+		{"Error getting SSL CTX:1\nSSL_connect failed: certificate verify failed\n", "", FailureSSL, "SSL_connect failed: certificate verify failed"},
+		{"Error getting address of remotehost\n", "", FailureResource, "Error getting address of remotehost"},
+		{"connect: No route to host\n", "", FailureUnreachable, "connect: No route to host"},
+		{"", "remotehost: Name or service not known\n", FailureNameResolution, "remotehost: Name or service not known"},
+		{"Completed handshake phase 1\nStarting handshake phase 2\n", "", FailureExit, ""},
+	}
+	for _, test := range tests {
+		kind, message := ClassifyUperfFailure(test.stdout, test.stderr)
+		if kind != test.kind || message != test.message {
+			t.Errorf(
+				"Expected %s (%s) from stdout %q and stderr %q, instead got %s (%s)",
+				test.kind, test.message, test.stdout, test.stderr, kind, message,
+			)
+		}
+	}
+}
+
+// TestTailLines checks that only the last lines of output are kept.
+func TestTailLines(t *testing.T) {
+	if result := tailLines("one\ntwo\nthree\n", 2); result != "two\nthree" {
+		t.Errorf("Expected last two lines, instead got %q", result)
+	}
+	if result := tailLines("one\n", 2); result != "one" {
+		t.Errorf("Expected the only line, instead got %q", result)
+	}
+}
+
+// runFailingUperf runs the given command in place of uperf, returning the
+// UperfFailure which was exported and the error from Run.
+func runFailingUperf(t *testing.T, cmd []string) (*UperfFailure, error) {
+	bench := &UperfBenchmark{Cmd: cmd}
+	exporter := &sweepTestExporter{}
+	err := bench.Run(exporter)
+	if err == nil {
+		t.Fatalf("Expected an error running %v, instead got nil", cmd)
+	}
+
+	for _, payload := range exporter.exported {
+		var failure UperfFailure
+		json.Unmarshal(payload, &failure)
+		if failure.SectionType == StatSectionFailure {
+			return &failure, err
+		}
+	}
+	t.Fatalf("Expected a failure document to be exported, instead got %d other documents", len(exporter.exported))
+	return nil, err
+}
+
+// TestUperfBenchmarkRunFailure checks that when uperf exits with an error,
+// a failure document is exported with the tails of stdout and stderr.
+func TestUperfBenchmarkRunFailure(t *testing.T) {
+	script := `
+for i in $(seq 100); do echo "line $i"; done
+echo "Error getting SSL CTX:1"
+echo "** [10.0.0.2] Error connecting: Connection refused" >&2
+exit 3`
+	failure, err := runFailingUperf(t, []string{"sh", "-c", script})
+
+	if failure.Kind != FailureConnectionRefused || failure.ExitCode != 3 {
+		t.Errorf("Expected connection_refused with exit code 3, instead got %s with %d", failure.Kind, failure.ExitCode)
+	}
+	if !strings.Contains(err.Error(), string(FailureConnectionRefused)) {
+		t.Errorf("Expected returned error to include the kind of failure, instead got: %s", err)
+	}
+	stdoutTail := strings.Split(failure.StdoutTail, "\n")
+	if len(stdoutTail) != failureTailLines || stdoutTail[len(stdoutTail)-1] != "Error getting SSL CTX:1" {
+		t.Errorf("Expected the last %d lines of stdout, instead got %d ending with %q",
+			failureTailLines, len(stdoutTail), stdoutTail[len(stdoutTail)-1])
+	}
+	if failure.StderrTail != "** [10.0.0.2] Error connecting: Connection refused" {
+		t.Errorf("Expected stderr tail to hold the error, instead got %q", failure.StderrTail)
+	}
+}
+
+// TestUperfBenchmarkRunStartFailure checks that a failure document is
+// exported when uperf can't be started.
+func TestUperfBenchmarkRunStartFailure(t *testing.T) {
+	failure, _ := runFailingUperf(t, []string{fmt.Sprintf("%s/uperf", t.TempDir())})
+	if failure.Kind != FailureStart || failure.ExitCode != -1 {
+		t.Errorf("Expected start_error with exit code -1, instead got %s with %d", failure.Kind, failure.ExitCode)
+	}
+}
+
+// TestUperfBenchmarkRunParseFailure checks that a failure document is
+// exported when uperf's stdout can't be parsed.
+func TestUperfBenchmarkRunParseFailure(t *testing.T) {
+	failure, _ := runFailingUperf(t, []string{"echo", "Txn1 not a txn line"})
+	if failure.Kind != FailureParse || !strings.Contains(failure.Error, "line 1") {
+		t.Errorf("Expected parse_error on line 1, instead got %s: %s", failure.Kind, failure.Error)
+	}
+}
+
+// TestUperfBenchmarkRunTimeout checks that uperf is stopped once its timeout
+// passes, and that the failure is classified as such.
+func TestUperfBenchmarkRunTimeout(t *testing.T) {
+	bench := &UperfBenchmark{Cmd: []string{"sleep", "10"}, Timeout: 100 * time.Millisecond}
+	exporter := &sweepTestExporter{}
+	start := time.Now()
+	err := bench.Run(exporter)
+	if err == nil || !strings.Contains(err.Error(), string(FailureDeadline)) {
+		t.Errorf("Expected a deadline_exceeded error, instead got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected uperf to be stopped after its timeout, instead it ran for %s", elapsed)
+	}
+	if len(exporter.exported) != 1 || !strings.Contains(string(exporter.exported[0]), `"Kind":"deadline_exceeded"`) {
+		t.Errorf("Expected a deadline_exceeded failure document, instead got %d documents", len(exporter.exported))
+	}
+}
@@ -0,0 +1,363 @@
+//go:build uperf
+// +build uperf
+
+package uperf
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+)
+
+const (
+	StatSectionTxLatency     StatSectionType = "tx_latency"
+	StatSectionFlowopLatency StatSectionType = "flowop_latency"
+)
+
+// LatencySourceIntervals marks latency stats estimated from interval stats.
+const LatencySourceIntervals string = "intervals"
+
+// histogramSubBucketBits determines the precision of the latencyHistogram.
+// Values are recorded within 1/2^(histogramSubBucketBits-1) of their true
+// value, which is under 1%.
+const histogramSubBucketBits uint = 8
+
+// latencyHistogram is an HDR-style histogram of latencies in nanoseconds.
+// Values below 2^histogramSubBucketBits are counted exactly. Larger values
+// are grouped into buckets which double in size with each power of two, each
+// split into the same number of sub-buckets, keeping the relative error
+// constant across the whole range of values.
+type latencyHistogram struct {
+	counts     map[int]int64
+	totalCount int64
+	min        int64
+	max        int64
+	sum        float64
+}
+
+// histogramIndex returns the index of the bucket the given value belongs to.
+func histogramIndex(value int64) int {
+	subBucketCount := int64(1) << histogramSubBucketBits
+	if value < subBucketCount {
+		return int(value)
+	}
+	shift := uint(bits.Len64(uint64(value))) - histogramSubBucketBits
+	subBucketHalfCount := subBucketCount / 2
+	subBucket := (value >> shift) - subBucketHalfCount
+	return int(subBucketCount + int64(shift-1)*subBucketHalfCount + subBucket)
+}
+
+// histogramValue returns the highest value which belongs to the bucket at the given index.
+func histogramValue(index int) int64 {
+	subBucketCount := int64(1) << histogramSubBucketBits
+	if int64(index) < subBucketCount {
+		return int64(index)
+	}
+	subBucketHalfCount := subBucketCount / 2
+	offset := int64(index) - subBucketCount
+	shift := uint(offset/subBucketHalfCount) + 1
+	subBucket := offset%subBucketHalfCount + subBucketHalfCount
+	return ((subBucket + 1) << shift) - 1
+}
+
+// Record adds the given value to the histogram the given number of times.
+func (h *latencyHistogram) Record(value int64, count int64) {
+	if count <= 0 {
+		return
+	}
+	if value < 0 {
+		value = 0
+	}
+	if h.counts == nil {
+		h.counts = map[int]int64{}
+	}
+	if h.totalCount == 0 || value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+	h.counts[histogramIndex(value)] += count
+	h.totalCount += count
+	h.sum += float64(value) * float64(count)
+}
+
+// ValueAtPercentile returns the value which the given percentage of recorded
+// values are less than or equal to, within the precision of the histogram.
+func (h *latencyHistogram) ValueAtPercentile(percentile float64) int64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	// Remove a small amount before rounding up, so floating point error in
+	// percentiles such as 99.9 doesn't push the target into the next value.
+	target := int64(math.Ceil(percentile/100*float64(h.totalCount) - 1e-9))
+	if target < 1 {
+		target = 1
+	}
+
+	indexes := make([]int, 0, len(h.counts))
+	for index := range h.counts {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var cumulative int64
+	for _, index := range indexes {
+		cumulative += h.counts[index]
+		if cumulative >= target {
+			value := histogramValue(index)
+			if value > h.max {
+				return h.max
+			}
+			return value
+		}
+	}
+	return h.max
+}
+
+// Mean returns the average of the recorded values.
+func (h *latencyHistogram) Mean() float64 {
+	if h.totalCount == 0 {
+		return 0
+	}
+	return h.sum / float64(h.totalCount)
+}
+
+// LatencyStat describes the distribution of latencies for a transaction or flowop.
+// Uperf doesn't report the latency of individual operations, so the
+// distribution is estimated from the average latency of each interval, see
+// ComputeLatencyStats. Variation within an interval is lost, so MinSeconds,
+// MaxSeconds and the percentiles describe interval averages rather than single
+// operations, and can understate tail latency. The percentiles are named
+// after intervals, ie IntervalP99Seconds, to make this clear. MeanSeconds
+// weights the average of each interval by its operations, so it matches the
+// overall average.
+type LatencyStat struct {
+	Name                string
+	Transaction         string
+	Metadata            *define.Metadata
+	SectionType         StatSectionType
+	Source              string
+	NumOps              int64
+	MinSeconds          float64
+	MeanSeconds         float64
+	MaxSeconds          float64
+	IntervalP50Seconds  float64
+	IntervalP90Seconds  float64
+	IntervalP99Seconds  float64
+	IntervalP999Seconds float64
+	Peer                *PeerInfo `json:",omitempty"`
+}
+
+// BenchmarkName returns BenchmarkName.
+func (ls *LatencyStat) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns the SectionType of the stat, being
+// StatSectionTxLatency or StatSectionFlowopLatency.
+func (ls *LatencyStat) DocumentKind() string { return string(ls.SectionType) }
+
+// DocumentTimestamp returns the time the run started, as latencies are
+// computed over the whole run.
+func (ls *LatencyStat) DocumentTimestamp() time.Time { return metadataTimestamp(ls.Metadata) }
+
+// SetMetadata attaches the run's Metadata to the latency stat.
+func (ls *LatencyStat) SetMetadata(metadata *define.Metadata) { ls.Metadata = metadata }
+
+// Fields returns the latency stat flattened by define.FlattenFields.
+func (ls *LatencyStat) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(ls)
+}
+
+// newLatencyStat summarizes the given histogram into a LatencyStat.
+func newLatencyStat(name string, txn string, section StatSectionType, h *latencyHistogram) *LatencyStat {
+	nanoToSeconds := func(value float64) float64 {
+		return value / float64(time.Second)
+	}
+	return &LatencyStat{
+		Name:                name,
+		Transaction:         txn,
+		SectionType:         section,
+		Source:              LatencySourceIntervals,
+		NumOps:              h.totalCount,
+		MinSeconds:          nanoToSeconds(float64(h.min)),
+		MeanSeconds:         nanoToSeconds(h.Mean()),
+		MaxSeconds:          nanoToSeconds(float64(h.max)),
+		IntervalP50Seconds:  nanoToSeconds(float64(h.ValueAtPercentile(50))),
+		IntervalP90Seconds:  nanoToSeconds(float64(h.ValueAtPercentile(90))),
+		IntervalP99Seconds:  nanoToSeconds(float64(h.ValueAtPercentile(99))),
+		IntervalP999Seconds: nanoToSeconds(float64(h.ValueAtPercentile(99.9))),
+	}
+}
+
+// flowOpCount returns the number of operations the given flowop performs each
+// time it runs, based on its `count` option.
+func flowOpCount(flowOp FlowOp) int64 {
+	value, found := flowOpOption(flowOp, "count")
+	if !found {
+		return 1
+	}
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err == nil && count > 0 {
+		return count
+	}
+	return 1
+}
+
+// txnLatencyInfo holds what is known about a transaction from the workload profile.
+type txnLatencyInfo struct {
+	nthreads int64
+	flowOps  []FlowOp
+}
+
+// profileTransactions maps the names uperf gives transactions within its
+// transaction progress lines to their info within the given Profile.
+// Uperf numbers transactions starting at 1, in the order they are defined.
+func profileTransactions(profile *Profile) map[string]txnLatencyInfo {
+	transactions := map[string]txnLatencyInfo{}
+	if profile == nil {
+		return transactions
+	}
+	num := 1
+	for _, group := range profile.Groups {
+		for _, txn := range group.Transactions {
+			transactions[fmt.Sprintf("Txn%d", num)] = txnLatencyInfo{
+				nthreads: int64(group.NThreads),
+				flowOps:  txn.FlowOps,
+			}
+			num++
+		}
+	}
+	return transactions
+}
+
+// ComputeLatencyStats estimates latency distributions for each transaction and
+// flowop from the interval stats within the given UperfStdout.
+// Uperf doesn't print the latency of individual operations, so each interval
+// is treated as a sample: the time spent by every thread in the interval is
+// divided by the operations completed in the interval, giving the average
+// latency of an operation, which is recorded once for each operation.
+// Intervals are most accurate when uperf prints them in the raw format (-R).
+// If the given Profile is not nil, it is used to find the number of threads
+// running each transaction and its flowops. Transaction latencies are then for
+// one iteration of the transaction, and the average time of each flowop, from
+// the flowop averages section, splits the iteration's latency between flowops.
+// Otherwise, transactions are assumed to be run by one thread with one
+// operation per iteration, and no flowop stats are returned.
+// Each stat is attributed to the group running its transaction, see PeerInfo.
+func ComputeLatencyStats(result *UperfStdout, profile *Profile) []define.Document {
+	transactions := profileTransactions(profile)
+
+	flowOpAverages := map[string]float64{}
+	for _, document := range *result {
+		stat, ok := document.(*AveragesStat)
+		if ok && stat.SectionType == StatSectionFlowopAvg {
+			flowOpAverages[stat.Name] = stat.AvgSeconds
+		}
+	}
+
+	txnHistograms := map[string]*latencyHistogram{}
+	flowOpHistograms := map[string]map[string]*latencyHistogram{}
+	txnOrder := []string{}
+
+	for _, document := range *result {
+		stat, ok := document.(*DetailsStat)
+		if !ok || stat.SectionType != StatSectionInterval {
+			continue
+		}
+		if stat.IntervalOps <= 0 || stat.IntervalSeconds <= 0 {
+			continue
+		}
+
+		info, hasInfo := transactions[stat.Name]
+		nthreads := int64(1)
+		if hasInfo && info.nthreads > 0 {
+			nthreads = info.nthreads
+		}
+		perOp := stat.IntervalSeconds * float64(nthreads) / float64(stat.IntervalOps) * float64(time.Second)
+
+		// Work out the number of operations in one iteration of the transaction
+		// and the average time spent in each operation of each flowop.
+		opsPerIteration := int64(1)
+		flowOpScale := map[string]float64{}
+		flowOpOps := map[string]int64{}
+		if hasInfo && len(info.flowOps) > 0 {
+			opsPerIteration = 0
+			var weightedAvg float64
+			allAveraged := true
+			for _, flowOp := range info.flowOps {
+				count := flowOpCount(flowOp)
+				opsPerIteration += count
+				flowOpOps[flowOp.Type] += count
+				avg, found := flowOpAverages[flowOp.Type]
+				if !found || avg <= 0 {
+					allAveraged = false
+				}
+				weightedAvg += float64(count) * avg
+			}
+			weightedAvg /= float64(opsPerIteration)
+			for flowOpType := range flowOpOps {
+				flowOpScale[flowOpType] = 1
+				if allAveraged {
+					flowOpScale[flowOpType] = flowOpAverages[flowOpType] / weightedAvg
+				}
+			}
+		}
+
+		iterations := stat.IntervalOps / opsPerIteration
+		if iterations < 1 {
+			iterations = 1
+		}
+
+		if _, found := txnHistograms[stat.Name]; !found {
+			txnHistograms[stat.Name] = &latencyHistogram{}
+			flowOpHistograms[stat.Name] = map[string]*latencyHistogram{}
+			txnOrder = append(txnOrder, stat.Name)
+		}
+		txnHistograms[stat.Name].Record(
+			int64(perOp*float64(opsPerIteration)), iterations,
+		)
+		for flowOpType, ops := range flowOpOps {
+			h, found := flowOpHistograms[stat.Name][flowOpType]
+			if !found {
+				h = &latencyHistogram{}
+				flowOpHistograms[stat.Name][flowOpType] = h
+			}
+			h.Record(
+				int64(perOp*flowOpScale[flowOpType]),
+				stat.IntervalOps*ops/opsPerIteration,
+			)
+		}
+	}
+
+	peers := buildPeerIndex(profile)
+	stats := []define.Document{}
+	for _, txn := range txnOrder {
+		stats = append(
+			stats,
+			newLatencyStat(txn, txn, StatSectionTxLatency, txnHistograms[txn]),
+		)
+		flowOpTypes := []string{}
+		for flowOpType := range flowOpHistograms[txn] {
+			flowOpTypes = append(flowOpTypes, flowOpType)
+		}
+		sort.Strings(flowOpTypes)
+		for _, flowOpType := range flowOpTypes {
+			stats = append(
+				stats,
+				newLatencyStat(
+					flowOpType, txn, StatSectionFlowopLatency,
+					flowOpHistograms[txn][flowOpType],
+				),
+			)
+		}
+	}
+	for _, stat := range stats {
+		peers.annotate(stat)
+	}
+	return stats
+}
@@ -0,0 +1,100 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"math"
+	"testing"
+)
+
+// TestLatencyHistogramPrecision checks that values recorded in the histogram
+// are returned within 1% of their true value.
+func TestLatencyHistogramPrecision(t *testing.T) {
+	for _, value := range []int64{0, 1, 255, 256, 1000, 12345, 987654321, 1 << 40} {
+		h := latencyHistogram{}
+		h.Record(value, 1)
+		result := h.ValueAtPercentile(50)
+		if math.Abs(float64(result-value)) > float64(value)/100 {
+			t.Errorf("Expected value %d to be recorded within 1%%, instead got %d", value, result)
+		}
+	}
+}
+
+// TestLatencyHistogramPercentiles checks that percentiles are weighted by the
+// number of times each value is recorded.
+func TestLatencyHistogramPercentiles(t *testing.T) {
+	h := latencyHistogram{}
+	h.Record(1000, 900)
+	h.Record(10000, 90)
+	h.Record(100000, 9)
+	h.Record(1000000, 1)
+
+	tests := map[float64]int64{
+		50:    1000,
+		90:    1000,
+		99:    10000,
+		99.9:  100000,
+		100.0: 1000000,
+	}
+	for percentile, expected := range tests {
+		result := h.ValueAtPercentile(percentile)
+		if math.Abs(float64(result-expected)) > float64(expected)/100 {
+			t.Errorf("Expected p%v to be %d, instead got %d", percentile, expected, result)
+		}
+	}
+	if h.min != 1000 || h.max != 1000000 {
+		t.Errorf("Expected min 1000 and max 1000000, instead got %d and %d", h.min, h.max)
+	}
+}
+
+// TestComputeLatencyStats checks that latency stats are estimated for each
+// transaction and flowop from raw interval stats.
+func TestComputeLatencyStats(t *testing.T) {
+	out, err := ParseUperfStdout(UPERF_TEST_STDOUT_ALL_ARGS_RAW)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing stdout: %s", err)
+	}
+	count := "count=10 size=8k"
+	profile := &Profile{
+		Name: "iperf",
+		Groups: []Group{
+			{
+				NThreads: 1,
+				Transactions: []Transaction{
+					{FlowOps: []FlowOp{{Type: "connect"}}},
+					{FlowOps: []FlowOp{{Type: "write", Options: &count}}},
+					{FlowOps: []FlowOp{{Type: "disconnect"}}},
+				},
+			},
+		},
+	}
+
+	stats := ComputeLatencyStats(out, profile)
+	var txn2, write *LatencyStat
+	for _, document := range stats {
+		stat := document.(*LatencyStat)
+		if stat.SectionType == StatSectionTxLatency && stat.Name == "Txn2" {
+			txn2 = stat
+		}
+		if stat.SectionType == StatSectionFlowopLatency && stat.Name == "write" && stat.Transaction == "Txn2" {
+			write = stat
+		}
+	}
+	if txn2 == nil || write == nil {
+		t.Fatalf("Expected latency stats for Txn2 and its write flowop, instead got %+v", stats)
+	}
+
+	// Roughly 285k writes per second with one thread is ~3.5us per write,
+	// with ten writes per iteration of Txn2.
+	if write.IntervalP50Seconds < 3e-6 || write.IntervalP50Seconds > 4e-6 {
+		t.Errorf("Expected write p50 of ~3.5us, instead got %v", write.IntervalP50Seconds)
+	}
+	if txn2.IntervalP50Seconds < 3e-5 || txn2.IntervalP50Seconds > 4e-5 {
+		t.Errorf("Expected Txn2 p50 of ~35us, instead got %v", txn2.IntervalP50Seconds)
+	}
+	if !(txn2.IntervalP50Seconds <= txn2.IntervalP90Seconds && txn2.IntervalP90Seconds <= txn2.IntervalP99Seconds &&
+		txn2.IntervalP99Seconds <= txn2.IntervalP999Seconds && txn2.IntervalP999Seconds <= txn2.MaxSeconds) {
+		t.Errorf("Expected percentiles to be in increasing order, instead got %+v", txn2)
+	}
+}
@@ -0,0 +1,291 @@
+//go:build uperf
+// +build uperf
+
+// parser.go defines a streaming parser for uperf's stdout, which emits
+// documents as uperf prints them.
+package uperf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+)
+
+// maxStdoutLineBytes is the longest line the parser will read from uperf's stdout.
+const maxStdoutLineBytes int = 1024 * 1024
+
+// ParserOptions configures a UperfStdoutParser.
+// StartTime is the time uperf was started at, used to timestamp interval
+// stats in the computed format, see annotateIntervals. If Tolerant is true,
+// then lines which can't be parsed are skipped and counted, rather than
+// stopping the parser. If Profile is set, then stats are attributed to the
+// group within it which produced them, see PeerInfo.
+type ParserOptions struct {
+	StartTime time.Time
+	Tolerant  bool
+	Profile   *Profile
+}
+
+// ParseError describes a line of uperf's stdout which couldn't be parsed.
+// Line is the line number within stdout, starting at 1, and Section is the
+// section of stdout the line was found in.
+type ParseError struct {
+	Line    int
+	Section StatSectionType
+	Text    string
+	Err     error
+}
+
+func (pe *ParseError) Error() string {
+	return fmt.Sprintf(
+		"unable to parse line %d of uperf stdout in %s section: %s",
+		pe.Line, pe.Section, pe.Err,
+	)
+}
+
+func (pe *ParseError) Unwrap() error {
+	return pe.Err
+}
+
+// stdoutSectionHeaders matches the header of each section within uperf's
+// stdout to the type of stats found within it.
+var stdoutSectionHeaders []struct {
+	matches func(line string) bool
+	section StatSectionType
+} = []struct {
+	matches func(line string) bool
+	section StatSectionType
+}{
+	{func(line string) bool { return strings.HasPrefix(line, "Group Details") }, StatSectionGroup},
+	{func(line string) bool { return strings.HasPrefix(line, "Strand Details") }, StatSectionStrand},
+	{func(line string) bool { return strings.HasPrefix(strings.ReplaceAll(line, " ", ""), "TxnCount") }, StatSectionTxAvg},
+	{func(line string) bool { return strings.HasPrefix(line, "Flowop") }, StatSectionFlowopAvg},
+	{func(line string) bool { return strings.HasPrefix(line, "Netstat statistics") }, StatSectionNetstat},
+	{func(line string) bool { return strings.HasPrefix(line, "Run Statistics") }, StatSectionRun},
+}
+
+// scanStdoutLines is a bufio.SplitFunc which splits uperf's stdout into lines.
+// Uperf uses `\r` to rewrite transaction progress in place, so lines may end
+// with `\n`, `\r` or `\r\n`.
+func scanStdoutLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\r' {
+			if i+1 == len(data) && !atEOF {
+				// Need to know if the next byte is `\n`
+				return 0, nil, nil
+			}
+			if i+1 < len(data) && data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+		}
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// UperfStdoutParser parses uperf's stdout line by line, using a state
+// machine which tracks the section of stdout being read.
+// After parsing, SkippedLines holds the number of lines which were skipped
+// in tolerant mode.
+type UperfStdoutParser struct {
+	Options      ParserOptions
+	SkippedLines int
+	line         int
+	section      StatSectionType
+	inHeader     bool
+	annotator    *intervalAnnotator
+	peers        *peerIndex
+}
+
+// parseSectionLine parses a line from within the current section.
+// A nil document is returned for lines which hold column headers.
+func (p *UperfStdoutParser) parseSectionLine(line string) (define.Document, error) {
+	switch p.section {
+	case StatSectionGroup, StatSectionStrand:
+		detailsStat, err := parseDetailsStat(line)
+		if err != nil {
+			return nil, err
+		}
+		detailsStat.SectionType = p.section
+		return detailsStat, nil
+	case StatSectionTxAvg, StatSectionFlowopAvg:
+		averagesStat, err := parseAveragesStat(line)
+		if err != nil {
+			return nil, err
+		}
+		averagesStat.SectionType = p.section
+		return averagesStat, nil
+	case StatSectionNetstat:
+		if strings.HasPrefix(strings.ReplaceAll(line, " ", ""), "Nicopkts/s") {
+			return nil, nil
+		}
+		netstatStat, err := parseNetstatStat(line)
+		if err != nil {
+			return nil, err
+		}
+		netstatStat.SectionType = StatSectionNetstat
+		return netstatStat, nil
+	case StatSectionRun:
+		if strings.HasPrefix(strings.ReplaceAll(line, " ", ""), "HostnameTime") {
+			return nil, nil
+		}
+		if strings.HasPrefix(line, "Difference") {
+			runDiffStat, err := parseRunDiffStat(line)
+			if err != nil {
+				return nil, err
+			}
+			runDiffStat.SectionType = StatSectionRunDiff
+			return runDiffStat, nil
+		}
+		runStat, err := parseRunStat(line)
+		if err != nil {
+			return nil, err
+		}
+		runStat.SectionType = StatSectionRun
+		return runStat, nil
+	}
+	return nil, fmt.Errorf("unknown section %s", p.section)
+}
+
+// parseLine advances the state machine with the given line, returning the
+// document parsed from it, if there is one.
+// Outside of a section, section headers and transaction progress lines are
+// looked for, and any other line is ignored. Within a section, the line after
+// the header and lines of dashes are skipped, and an empty line ends the section.
+func (p *UperfStdoutParser) parseLine(line string) (define.Document, error) {
+	if len(p.section) > 0 {
+		if p.inHeader {
+			p.inHeader = false
+			return nil, nil
+		}
+		if len(line) == 0 {
+			log.Debug().Int("line", p.line).Msg("Finished parsing section")
+			p.section = ""
+			return nil, nil
+		}
+		if strings.HasPrefix(line, "---") {
+			return nil, nil
+		}
+		return p.parseSectionLine(line)
+	}
+
+	for _, header := range stdoutSectionHeaders {
+		if header.matches(line) {
+			log.Debug().
+				Int("line", p.line).
+				Str("current_line", line).
+				Str("section", string(header.section)).
+				Msg("Parsing section")
+			p.section = header.section
+			p.inHeader = true
+			return nil, nil
+		}
+	}
+
+	var (
+		detailsStat *DetailsStat
+		err         error
+	)
+	switch {
+	case strings.HasPrefix(line, "Txn") || strings.HasPrefix(line, "Total"):
+		detailsStat, err = parseDetailsStatComputed(line)
+	case strings.HasPrefix(line, "timestamp_ms"):
+		detailsStat, err = parseDetailsStatRaw(line)
+	default:
+		log.Debug().Int("line", p.line).Str("current_line", line).Msg("Skipping line")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	detailsStat.SectionType = StatSectionTX
+	return detailsStat, nil
+}
+
+// Parse reads uperf's stdout from the given reader, sending each document
+// parsed on the given channel as soon as it is ready. The channel is closed
+// once the reader is exhausted or parsing stops.
+// Transaction progress lines are annotated as they are read, see
+// annotateIntervals. The summary of a transaction is sent once the line after
+// its last progress line is read.
+// If a line can't be parsed, then a *ParseError is returned, unless the
+// parser is in tolerant mode, in which case the line is skipped and counted.
+// Parse stops reading as soon as an error is returned, so callers reading
+// from a running process should drain the reader afterwards.
+func (p *UperfStdoutParser) Parse(reader io.Reader, documents chan<- define.Document) error {
+	defer close(documents)
+	p.line = 0
+	p.section = ""
+	p.inHeader = false
+	p.annotator = &intervalAnnotator{startTime: p.Options.StartTime}
+	p.peers = buildPeerIndex(p.Options.Profile)
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStdoutLineBytes)
+	scanner.Split(scanStdoutLines)
+
+	for scanner.Scan() {
+		p.line++
+		line := scanner.Text()
+		section := p.section
+		document, err := p.parseLine(line)
+		if err != nil {
+			if len(section) == 0 {
+				section = StatSectionTX
+			}
+			parseErr := &ParseError{Line: p.line, Section: section, Text: line, Err: err}
+			if !p.Options.Tolerant {
+				return parseErr
+			}
+			p.SkippedLines++
+			log.Warn().Err(parseErr).Msg("Skipping uperf stdout line which could not be parsed.")
+			continue
+		}
+		if document == nil {
+			continue
+		}
+		p.peers.annotate(document)
+		for _, ready := range p.annotator.add(document) {
+			documents <- ready
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read uperf stdout after line %d: %s", p.line, err)
+	}
+
+	for _, ready := range p.annotator.finishTxn() {
+		documents <- ready
+	}
+	return nil
+}
+
+// ParseAll reads uperf's stdout from the given reader, returning every
+// document parsed. See Parse.
+func (p *UperfStdoutParser) ParseAll(reader io.Reader) (*UperfStdout, error) {
+	documents := make(chan define.Document)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.Parse(reader, documents)
+	}()
+
+	result := &UperfStdout{}
+	for document := range documents {
+		*result = append(*result, document)
+	}
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,151 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// UPERF_TEST_STDOUT_MINIMAL_ARGS with an unparsable netstat line.
+// The line number and section need to be synced with the test below.
+var UPERF_TEST_STDOUT_MINIMAL_ARGS_BAD_NETSTAT string = strings.Replace(
+	UPERF_TEST_STDOUT_MINIMAL_ARGS,
+	"lo         272158      272158",
+	"lo         272158      lots",
+	1,
+)
+
+// TestScanStdoutLines checks that uperf's stdout is split on each type of line ending.
+func TestScanStdoutLines(t *testing.T) {
+	scanner := bufio.NewScanner(strings.NewReader("one\ntwo\rthree\r\nfour\r\r\nfive"))
+	scanner.Split(scanStdoutLines)
+	lines := []string{}
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	expected := []string{"one", "two", "three", "four", "", "five"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected lines %q, instead got %q", expected, lines)
+	}
+}
+
+// TestUperfStdoutParserStreams checks that documents are sent by the parser
+// as soon as they are read, before the rest of stdout is available.
+func TestUperfStdoutParserStreams(t *testing.T) {
+	reader, writer := io.Pipe()
+	documents := make(chan define.Document)
+	errs := make(chan error, 1)
+	parser := &UperfStdoutParser{}
+	go func() {
+		errs <- parser.Parse(reader, documents)
+	}()
+
+	fmt.Fprint(writer, "Txn1            0 /   1.00(s) =            0           1op/s\n")
+	select {
+	case document := <-documents:
+		stat, ok := document.(*DetailsStat)
+		if !ok || stat.Name != "Txn1" || stat.SectionType != StatSectionInterval {
+			t.Errorf("Expected Txn1 interval stat, instead got %+v", document)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a document before stdout was closed, instead got nothing")
+	}
+
+	go func() {
+		fmt.Fprint(writer, "Txn2      67.14GB /  30.23(s) =    19.08Gb/s      291075op/s\n")
+		fmt.Fprint(writer, "Total     67.14GB /  32.34(s) =    17.84Gb/s      272158op/s\n")
+		writer.Close()
+	}()
+	names := []string{}
+	for document := range documents {
+		names = append(names, fmt.Sprintf("%s/%s", document.(*DetailsStat).Name, document.DocumentKind()))
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Unexpected error while parsing: %s", err)
+	}
+
+	expected := []string{"Txn1/tx", "Txn2/interval", "Txn2/tx", "Total/tx"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected remaining documents %v, instead got %v", expected, names)
+	}
+}
+
+// TestUperfStdoutParserError checks that a line which can't be parsed stops
+// the parser with an error giving its line number and section.
+func TestUperfStdoutParserError(t *testing.T) {
+	parser := &UperfStdoutParser{}
+	_, err := parser.ParseAll(strings.NewReader(UPERF_TEST_STDOUT_MINIMAL_ARGS_BAD_NETSTAT))
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("Expected a ParseError, instead got: %v", err)
+	}
+	if parseErr.Line != 14 || parseErr.Section != StatSectionNetstat {
+		t.Errorf(
+			"Expected error on line 14 in the netstat section, instead got line %d in %s",
+			parseErr.Line, parseErr.Section,
+		)
+	}
+	if !strings.Contains(parseErr.Text, "lots") {
+		t.Errorf("Expected error to hold the bad line, instead got %s", parseErr.Text)
+	}
+}
+
+// TestUperfStdoutParserTolerant checks that in tolerant mode, lines which
+// can't be parsed are skipped and counted while the rest of stdout is parsed.
+func TestUperfStdoutParserTolerant(t *testing.T) {
+	parser := &UperfStdoutParser{Options: ParserOptions{Tolerant: true}}
+	out, err := parser.ParseAll(strings.NewReader(UPERF_TEST_STDOUT_MINIMAL_ARGS_BAD_NETSTAT))
+	if err != nil {
+		t.Fatalf("Unexpected error in tolerant mode: %s", err)
+	}
+	if parser.SkippedLines != 1 {
+		t.Errorf("Expected 1 skipped line, instead got %d", parser.SkippedLines)
+	}
+
+	expected, err := ParseUperfStdout(UPERF_TEST_STDOUT_MINIMAL_ARGS)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing stdout: %s", err)
+	}
+	if len(*out) != len(*expected)-1 {
+		t.Errorf("Expected every document but the netstat stat, instead got %d of %d", len(*out), len(*expected))
+	}
+	for _, document := range *out {
+		if document.DocumentKind() == string(StatSectionNetstat) {
+			t.Errorf("Expected the netstat stat to be skipped, instead got %+v", document)
+		}
+	}
+}
+
+// TestUperfStdoutParserLongOutput checks that long outputs, such as those from
+// `-R -i 1` on long runs, are parsed without issue.
+func TestUperfStdoutParserLongOutput(t *testing.T) {
+	var stdout strings.Builder
+	numLines := 100000
+	for i := 1; i <= numLines; i++ {
+		fmt.Fprintf(
+			&stdout, "timestamp_ms:%d.0 name:Txn2 nr_bytes:%d nr_ops:%d\r",
+			1644254626628+i*1000, i*1024, i,
+		)
+	}
+
+	parser := &UperfStdoutParser{}
+	out, err := parser.ParseAll(strings.NewReader(stdout.String()))
+	if err != nil {
+		t.Fatalf("Unexpected error parsing long output: %s", err)
+	}
+	if len(*out) != numLines+1 {
+		t.Errorf("Expected %d intervals and a summary, instead got %d documents", numLines, len(*out))
+	}
+}
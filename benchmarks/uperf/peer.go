@@ -0,0 +1,135 @@
+//go:build uperf
+// +build uperf
+
+// peer.go defines functionality for attributing stats parsed from uperf's
+// stdout to the group within the workload profile, and the remote host, which
+// produced them.
+package uperf
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// PeerInfo describes the group within a workload profile which produced a
+// stat, and the remote host the group talked to.
+// RemoteHost and Protocol are taken from the first connect or accept flowop
+// within the group, and are empty if the group has none.
+type PeerInfo struct {
+	GroupIndex int
+	NThreads   int
+	RemoteHost string `json:",omitempty"`
+	Protocol   string `json:",omitempty"`
+}
+
+// flowOpOption returns the value of the option with the given name within
+// the given flowop's options, and whether it was found.
+func flowOpOption(flowOp FlowOp, name string) (string, bool) {
+	if flowOp.Options == nil {
+		return "", false
+	}
+	for _, option := range strings.Fields(*flowOp.Options) {
+		if strings.HasPrefix(option, name+"=") {
+			return strings.TrimPrefix(option, name+"="), true
+		}
+	}
+	return "", false
+}
+
+// groupPeer builds the PeerInfo for the group at the given index.
+func groupPeer(index int, group Group) *PeerInfo {
+	peer := &PeerInfo{GroupIndex: index, NThreads: group.NThreads}
+	for _, txn := range group.Transactions {
+		for _, flowOp := range txn.FlowOps {
+			if flowOp.Type != "connect" && flowOp.Type != "accept" {
+				continue
+			}
+			peer.RemoteHost, _ = flowOpOption(flowOp, "remotehost")
+			peer.Protocol, _ = flowOpOption(flowOp, "protocol")
+			return peer
+		}
+	}
+	return peer
+}
+
+// peerIndex maps the names uperf gives groups, strands and transactions
+// within its stdout to the group which produced them.
+// Uperf numbers groups (Group0), strands (Thr0) and transaction averages
+// (Txn0) from 0, and transaction progress lines (Txn1) from 1. Strands and
+// transactions are numbered across every group, in the order they are defined.
+type peerIndex struct {
+	groups      map[string]*PeerInfo
+	strands     map[string]*PeerInfo
+	txns        map[string]*PeerInfo
+	txnAverages map[string]*PeerInfo
+	hosts       map[string]*PeerInfo
+}
+
+// buildPeerIndex builds a peerIndex from the given Profile, which may be nil.
+// Run stats are attributed by their hostname, so a host is only indexed if a
+// single group talks to it.
+func buildPeerIndex(profile *Profile) *peerIndex {
+	pi := &peerIndex{
+		groups:      map[string]*PeerInfo{},
+		strands:     map[string]*PeerInfo{},
+		txns:        map[string]*PeerInfo{},
+		txnAverages: map[string]*PeerInfo{},
+		hosts:       map[string]*PeerInfo{},
+	}
+	if profile == nil {
+		return pi
+	}
+
+	ambiguousHosts := map[string]bool{}
+	strand, txn := 0, 0
+	for i, group := range profile.Groups {
+		peer := groupPeer(i, group)
+		pi.groups[fmt.Sprintf("Group%d", i)] = peer
+		for t := 0; t < group.NThreads; t++ {
+			pi.strands[fmt.Sprintf("Thr%d", strand)] = peer
+			strand++
+		}
+		for range group.Transactions {
+			pi.txnAverages[fmt.Sprintf("Txn%d", txn)] = peer
+			pi.txns[fmt.Sprintf("Txn%d", txn+1)] = peer
+			txn++
+		}
+
+		if len(peer.RemoteHost) == 0 {
+			continue
+		}
+		if _, found := pi.hosts[peer.RemoteHost]; found {
+			ambiguousHosts[peer.RemoteHost] = true
+		}
+		pi.hosts[peer.RemoteHost] = peer
+	}
+	for host := range ambiguousHosts {
+		delete(pi.hosts, host)
+	}
+	return pi
+}
+
+// annotate sets the Peer of the given document, if it can be attributed to a group.
+func (pi *peerIndex) annotate(document define.Document) {
+	switch stat := document.(type) {
+	case *DetailsStat:
+		switch stat.SectionType {
+		case StatSectionGroup:
+			stat.Peer = pi.groups[stat.Name]
+		case StatSectionStrand:
+			stat.Peer = pi.strands[stat.Name]
+		case StatSectionTX, StatSectionInterval:
+			stat.Peer = pi.txns[stat.Name]
+		}
+	case *AveragesStat:
+		if stat.SectionType == StatSectionTxAvg {
+			stat.Peer = pi.txnAverages[stat.Name]
+		}
+	case *RunStat:
+		stat.Peer = pi.hosts[stat.Hostname]
+	case *LatencyStat:
+		stat.Peer = pi.txns[stat.Transaction]
+	}
+}
@@ -0,0 +1,135 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"strings"
+	"testing"
+)
+
+// WORKLOAD_XML_TWO_HOSTS is the iperf workload, with a second group writing to
+// another host.
+var WORKLOAD_XML_TWO_HOSTS string = `<?xml version="1.0"?>
+<profile name="iPERF">
+  <group nthreads="1">
+        <transaction iterations="1">
+            <flowop type="connect" options="remotehost=127.0.0.1 protocol=tcp wndsz=50k  tcp_nodelay"/>
+        </transaction>
+        <transaction duration="30s">
+            <flowop type="write" options="count=10 size=8k"/>
+        </transaction>
+        <transaction iterations="1">
+            <flowop type="disconnect" />
+        </transaction>
+  </group>
+  <group nthreads="2">
+        <transaction duration="30s">
+            <flowop type="connect" options="remotehost=10.0.0.2 protocol=udp"/>
+            <flowop type="write" options="size=64"/>
+        </transaction>
+  </group>
+</profile>`
+
+// TestBuildPeerIndex checks that the names uperf gives groups, strands and
+// transactions are mapped to the group which defines them, and that hosts used
+// by more than one group aren't attributed to either.
+func TestBuildPeerIndex(t *testing.T) {
+	profile, err := ParseWorkloadXML([]byte(WORKLOAD_XML_TWO_HOSTS))
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing workload: %s", err)
+	}
+	pi := buildPeerIndex(profile)
+
+	first := PeerInfo{GroupIndex: 0, NThreads: 1, RemoteHost: "127.0.0.1", Protocol: "tcp"}
+	second := PeerInfo{GroupIndex: 1, NThreads: 2, RemoteHost: "10.0.0.2", Protocol: "udp"}
+	tests := []struct {
+		names    map[string]*PeerInfo
+		name     string
+		expected *PeerInfo
+	}{
+		{pi.groups, "Group0", &first},
+		{pi.groups, "Group1", &second},
+		{pi.strands, "Thr0", &first},
+		{pi.strands, "Thr1", &second},
+		{pi.strands, "Thr2", &second},
+		{pi.strands, "Thr3", nil},
+		{pi.txns, "Txn1", &first},
+		{pi.txns, "Txn3", &first},
+		{pi.txns, "Txn4", &second},
+		{pi.txnAverages, "Txn0", &first},
+		{pi.txnAverages, "Txn3", &second},
+		{pi.hosts, "127.0.0.1", &first},
+		{pi.hosts, "10.0.0.2", &second},
+	}
+	for _, test := range tests {
+		peer := test.names[test.name]
+		if test.expected == nil {
+			if peer != nil {
+				t.Errorf("Expected no peer for %s, instead got %+v", test.name, *peer)
+			}
+			continue
+		}
+		if peer == nil || *peer != *test.expected {
+			t.Errorf("Expected peer %+v for %s, instead got %+v", *test.expected, test.name, peer)
+		}
+	}
+
+	shared := strings.Replace(WORKLOAD_XML_TWO_HOSTS, "10.0.0.2", "127.0.0.1", 1)
+	profile, err = ParseWorkloadXML([]byte(shared))
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing workload: %s", err)
+	}
+	if peer, found := buildPeerIndex(profile).hosts["127.0.0.1"]; found {
+		t.Errorf("Expected no peer for a host shared by two groups, instead got %+v", *peer)
+	}
+}
+
+// TestUperfStdoutParserAttributesPeers checks that stats parsed with a Profile
+// are attributed to the group which produced them.
+func TestUperfStdoutParserAttributesPeers(t *testing.T) {
+	profile, err := ParseWorkloadXML([]byte(WORKLOAD_XML_TWO_HOSTS))
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing workload: %s", err)
+	}
+	parser := &UperfStdoutParser{Options: ParserOptions{Profile: profile}}
+	result, err := parser.ParseAll(strings.NewReader(UPERF_TEST_STDOUT_ALL_ARGS))
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing stdout: %s", err)
+	}
+
+	attributed := 0
+	for _, document := range *result {
+		switch stat := document.(type) {
+		case *DetailsStat:
+			if stat.Name == "Total" {
+				if stat.Peer != nil {
+					t.Errorf("Expected no peer for the total, instead got %+v", *stat.Peer)
+				}
+				continue
+			}
+			if stat.Peer == nil || stat.Peer.GroupIndex != 0 {
+				t.Errorf("Expected %s (%s) to be attributed to group 0, instead got %+v", stat.Name, stat.SectionType, stat.Peer)
+				continue
+			}
+			attributed++
+		case *RunStat:
+			if stat.Hostname == "127.0.0.1" && (stat.Peer == nil || stat.Peer.RemoteHost != "127.0.0.1") {
+				t.Errorf("Expected run stat for 127.0.0.1 to be attributed to it, instead got %+v", stat.Peer)
+			}
+			if stat.Hostname == "master" && stat.Peer != nil {
+				t.Errorf("Expected no peer for the local host, instead got %+v", *stat.Peer)
+			}
+		}
+	}
+	if attributed == 0 {
+		t.Errorf("Expected stats to be attributed to group 0, instead got none")
+	}
+
+	for _, document := range ComputeLatencyStats(result, profile) {
+		stat := document.(*LatencyStat)
+		if stat.Peer == nil || stat.Peer.Protocol != "tcp" {
+			t.Errorf("Expected latency stat %s to be attributed to group 0, instead got %+v", stat.Name, stat.Peer)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+//go:build uperf
+// +build uperf
+
+// preset.go defines functionality for generating uperf workloads from a set of
+// common presets, rather than writing workload xml files by hand.
+package uperf
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// PresetStream sends data to the remote host as fast as possible.
+	PresetStream string = "stream"
+	// PresetIperf sends data to the remote host in batches of ten writes,
+	// matching uperf's bundled iperf.xml workload.
+	PresetIperf string = "iperf"
+	// PresetRR sends a request and waits for a response of the same size over
+	// a single connection.
+	PresetRR string = "rr"
+	// PresetCRR opens a new connection for each request and response.
+	PresetCRR string = "crr"
+)
+
+// Presets lists each preset which can be given to BuildPresetProfile.
+var Presets []string = []string{PresetStream, PresetIperf, PresetRR, PresetCRR}
+
+// PresetOptions holds the values used to build a Profile from a preset.
+type PresetOptions struct {
+	Preset   string
+	Protocol string
+	NThreads int
+	Size     string
+	Duration time.Duration
+	Remote   string
+}
+
+// validate checks that each of the PresetOptions has a usable value.
+func (po *PresetOptions) validate() error {
+	knownPreset := false
+	for _, preset := range Presets {
+		if po.Preset == preset {
+			knownPreset = true
+		}
+	}
+	if !knownPreset {
+		return fmt.Errorf("unknown uperf preset '%s', expected one of %v", po.Preset, Presets)
+	}
+	if po.Protocol != "tcp" && po.Protocol != "udp" {
+		return fmt.Errorf("unknown protocol '%s', expected tcp or udp", po.Protocol)
+	}
+	if po.NThreads < 1 {
+		return fmt.Errorf("number of threads must be at least 1, got %d", po.NThreads)
+	}
+	if len(po.Size) == 0 {
+		return fmt.Errorf("a message size is required")
+	}
+	if po.Duration < time.Second {
+		return fmt.Errorf("duration must be at least 1s, got %s", po.Duration)
+	}
+	if len(po.Remote) == 0 {
+		return fmt.Errorf("a remote host is required")
+	}
+	return nil
+}
+
+// BuildPresetProfile builds a Profile from the preset within the given PresetOptions.
+// Each preset has a single group of NThreads threads. Presets other than
+// PresetCRR open a connection in their first transaction, run their main
+// transaction for the given Duration, then disconnect.
+func BuildPresetProfile(opts PresetOptions) (*Profile, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	connectOptions := fmt.Sprintf("remotehost=%s protocol=%s", opts.Remote, opts.Protocol)
+	sizeOptions := fmt.Sprintf("size=%s", opts.Size)
+	flowOp := func(flowOpType string, options string) FlowOp {
+		return FlowOp{Type: flowOpType, Options: &options}
+	}
+	once := func(flowOps ...FlowOp) Transaction {
+		iterations := 1
+		return Transaction{Iterations: &iterations, FlowOps: flowOps}
+	}
+	timed := func(flowOps ...FlowOp) Transaction {
+		duration := int(opts.Duration.Seconds())
+		return Transaction{DurationSeconds: &duration, FlowOps: flowOps}
+	}
+
+	var transactions []Transaction
+	switch opts.Preset {
+	case PresetStream:
+		transactions = []Transaction{
+			once(flowOp("connect", connectOptions)),
+			timed(flowOp("write", sizeOptions)),
+			once(FlowOp{Type: "disconnect"}),
+		}
+	case PresetIperf:
+		transactions = []Transaction{
+			once(flowOp("connect", connectOptions)),
+			timed(flowOp("write", "count=10 "+sizeOptions)),
+			once(FlowOp{Type: "disconnect"}),
+		}
+	case PresetRR:
+		transactions = []Transaction{
+			once(flowOp("connect", connectOptions)),
+			timed(flowOp("write", sizeOptions), flowOp("read", sizeOptions)),
+			once(FlowOp{Type: "disconnect"}),
+		}
+	case PresetCRR:
+		transactions = []Transaction{
+			timed(
+				flowOp("connect", connectOptions),
+				flowOp("write", sizeOptions),
+				flowOp("read", sizeOptions),
+				FlowOp{Type: "disconnect"},
+			),
+		}
+	}
+
+	return &Profile{
+		Name: fmt.Sprintf("%s-%s", opts.Preset, opts.Protocol),
+		Groups: []Group{
+			{
+				NThreads:     opts.NThreads,
+				Transactions: transactions,
+			},
+		},
+	}, nil
+}
+
+// RenderWorkloadXML serializes the given Profile into a uperf workload xml file.
+func RenderWorkloadXML(profile *Profile) ([]byte, error) {
+	profileXMLInstance := profileXML{Name: profile.Name}
+	for _, group := range profile.Groups {
+		groupXMLInstance := groupXML{NThreads: strconv.Itoa(group.NThreads)}
+		for _, transaction := range group.Transactions {
+			transactionXMLInstance := transactionXML{}
+			if transaction.DurationSeconds != nil {
+				transactionXMLInstance.Duration = fmt.Sprintf("%ds", *transaction.DurationSeconds)
+			}
+			if transaction.Iterations != nil {
+				transactionXMLInstance.Iterations = strconv.Itoa(*transaction.Iterations)
+			}
+			for _, flowOp := range transaction.FlowOps {
+				flowOpXMLInstance := flowOpXML{Type: flowOp.Type}
+				if flowOp.Options != nil {
+					flowOpXMLInstance.Options = *flowOp.Options
+				}
+				transactionXMLInstance.FlowOps = append(
+					transactionXMLInstance.FlowOps, flowOpXMLInstance,
+				)
+			}
+			groupXMLInstance.Transactions = append(
+				groupXMLInstance.Transactions, transactionXMLInstance,
+			)
+		}
+		profileXMLInstance.Groups = append(profileXMLInstance.Groups, groupXMLInstance)
+	}
+
+	rendered, err := xml.MarshalIndent(profileXMLInstance, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("unable to render workload xml: %s", err)
+	}
+	return append([]byte("<?xml version=\"1.0\"?>\n"), append(rendered, '\n')...), nil
+}
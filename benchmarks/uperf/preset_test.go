@@ -0,0 +1,112 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestBuildPresetProfileRoundTrip checks that each preset can be rendered to
+// xml and parsed back into the same Profile.
+func TestBuildPresetProfileRoundTrip(t *testing.T) {
+	for _, preset := range Presets {
+		profile, err := BuildPresetProfile(
+			PresetOptions{
+				Preset:   preset,
+				Protocol: "udp",
+				NThreads: 8,
+				Size:     "1k",
+				Duration: 30 * time.Second,
+				Remote:   "10.0.0.2",
+			},
+		)
+		if err != nil {
+			t.Fatalf("Unexpected error building preset %s: %s", preset, err)
+		}
+
+		rendered, err := RenderWorkloadXML(profile)
+		if err != nil {
+			t.Fatalf("Unexpected error rendering preset %s: %s", preset, err)
+		}
+		parsed, err := ParseWorkloadXML(rendered)
+		if err != nil {
+			t.Fatalf("Unable to parse rendered preset %s: %s\n%s", preset, err, rendered)
+		}
+		if !reflect.DeepEqual(profile, parsed) {
+			t.Errorf(
+				"Expected rendered preset %s to parse back into %+v, instead got %+v",
+				preset, profile, parsed,
+			)
+		}
+		if parsed.Groups[0].NThreads != 8 {
+			t.Errorf("Expected preset %s to use 8 threads, instead got %d", preset, parsed.Groups[0].NThreads)
+		}
+	}
+}
+
+// TestRenderWorkloadXMLIperf checks that the iperf preset renders to the
+// same workload as uperf's bundled iperf.xml.
+func TestRenderWorkloadXMLIperf(t *testing.T) {
+	profile, err := BuildPresetProfile(
+		PresetOptions{
+			Preset:   PresetIperf,
+			Protocol: "tcp",
+			NThreads: 1,
+			Size:     "64k",
+			Duration: 30 * time.Second,
+			Remote:   "localhost",
+		},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error building preset: %s", err)
+	}
+	rendered, err := RenderWorkloadXML(profile)
+	if err != nil {
+		t.Fatalf("Unexpected error rendering preset: %s", err)
+	}
+
+	expected := `<?xml version="1.0"?>
+<profile name="iperf-tcp">
+  <group nthreads="1">
+    <transaction iterations="1">
+      <flowop type="connect" options="remotehost=localhost protocol=tcp"></flowop>
+    </transaction>
+    <transaction duration="30s">
+      <flowop type="write" options="count=10 size=64k"></flowop>
+    </transaction>
+    <transaction iterations="1">
+      <flowop type="disconnect"></flowop>
+    </transaction>
+  </group>
+</profile>
+`
+	if string(rendered) != expected {
+		t.Errorf("Expected rendered workload:\n%s\ninstead got:\n%s", expected, rendered)
+	}
+}
+
+// TestBuildPresetProfileInvalid checks that invalid preset options are rejected.
+func TestBuildPresetProfileInvalid(t *testing.T) {
+	valid := PresetOptions{
+		Preset: PresetRR, Protocol: "tcp", NThreads: 1, Size: "64k",
+		Duration: time.Second, Remote: "localhost",
+	}
+	invalid := []func(*PresetOptions){
+		func(po *PresetOptions) { po.Preset = "unknown" },
+		func(po *PresetOptions) { po.Protocol = "sctp" },
+		func(po *PresetOptions) { po.NThreads = 0 },
+		func(po *PresetOptions) { po.Size = "" },
+		func(po *PresetOptions) { po.Duration = 0 },
+		func(po *PresetOptions) { po.Remote = "" },
+	}
+	for _, modify := range invalid {
+		opts := valid
+		modify(&opts)
+		if _, err := BuildPresetProfile(opts); err == nil {
+			t.Errorf("Expected error building preset with options %+v, instead got nil", opts)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+//go:build uperf
+// +build uperf
+
+// replay.go defines a benchmark which parses and exports uperf stdout saved
+// from a previous run, without running uperf.
+package uperf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+)
+
+// UperfReplayBenchmark parses uperf stdout saved from a previous run and
+// exports the results, exactly as if uperf had just printed them.
+// Stdout is read from StdoutPath, or from the StdoutRaw of the run info
+// document at RunInfoPath, such as those printed with --print-json. A run info
+// document also provides the workload, variables, command and times of the
+// run, unless they are set on the Benchmark.
+// The workload is optional. Without one, stats can't be attributed to
+// groups and latency stats assume one thread per transaction.
+// StartTime is the time uperf was started at, used to timestamp intervals
+// printed in the computed format. If it isn't known, then the run is dated
+// by the modification time of the stdout file.
+type UperfReplayBenchmark struct {
+	Benchmark   UperfBenchmark
+	StdoutPath  string
+	RunInfoPath string
+	StartTime   time.Time
+	stdout      string
+	stderr      string
+	startTime   time.Time
+	endTime     time.Time
+}
+
+// findRunInfo looks for a run info document within the given json, which may
+// be a single document, an array of documents as printed by --print-json, or
+// one document per line as printed by `gobench fetch --format ndjson`.
+// If more than one run info document is found, then the last is returned.
+func findRunInfo(raw []byte) (*UperfRunInfoPayload, error) {
+	var documents []json.RawMessage
+	trimmed := bytes.TrimSpace(raw)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &documents); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		for decoder.More() {
+			var document json.RawMessage
+			if err := decoder.Decode(&document); err != nil {
+				return nil, err
+			}
+			documents = append(documents, document)
+		}
+	}
+
+	var found *UperfRunInfoPayload
+	for _, document := range documents {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(document, &fields); err != nil {
+			return nil, err
+		}
+		if _, ok := fields["StdoutRaw"]; !ok {
+			continue
+		}
+		runInfo := &UperfRunInfoPayload{}
+		if err := json.Unmarshal(document, runInfo); err != nil {
+			return nil, err
+		}
+		found = runInfo
+	}
+	if found == nil {
+		return nil, fmt.Errorf("no %s document found", DocumentKindRunInfo)
+	}
+	return found, nil
+}
+
+// loadRunInfo reads the run info document at RunInfoPath, filling in
+// anything not already set.
+func (urb *UperfReplayBenchmark) loadRunInfo() error {
+	runInfoBytes, err := ioutil.ReadFile(urb.RunInfoPath)
+	if err != nil {
+		return fmt.Errorf("unable to read run info at %s: %s", urb.RunInfoPath, err)
+	}
+	runInfo, err := findRunInfo(runInfoBytes)
+	if err != nil {
+		return fmt.Errorf("unable to parse run info at %s: %s", urb.RunInfoPath, err)
+	}
+
+	urb.stdout = runInfo.StdoutRaw
+	urb.stderr = runInfo.StderrRaw
+	bench := &urb.Benchmark
+	if bench.Preset == nil && len(bench.WorkloadPath) == 0 {
+		bench.WorkloadRaw = runInfo.Workload
+	}
+	if len(bench.Vars) == 0 {
+		bench.Vars = runInfo.Vars
+	}
+	if len(bench.Cmd) == 0 {
+		bench.Cmd = runInfo.Cmd
+	}
+	if urb.StartTime.IsZero() {
+		urb.StartTime = runInfo.StartTime
+	}
+	urb.endTime = runInfo.EndTime
+	return nil
+}
+
+// Setup reads the saved stdout and loads the workload, if one is given.
+func (urb *UperfReplayBenchmark) Setup(cfg *define.Config) error {
+	if len(urb.RunInfoPath) > 0 {
+		if err := urb.loadRunInfo(); err != nil {
+			return err
+		}
+	}
+	if len(urb.StdoutPath) > 0 {
+		stdoutBytes, err := ioutil.ReadFile(urb.StdoutPath)
+		if err != nil {
+			return fmt.Errorf("unable to read uperf stdout at %s: %s", urb.StdoutPath, err)
+		}
+		urb.stdout = string(stdoutBytes)
+		if urb.endTime.IsZero() {
+			if info, err := os.Stat(urb.StdoutPath); err == nil {
+				urb.endTime = info.ModTime().UTC()
+			}
+		}
+	}
+	if len(urb.stdout) == 0 {
+		return fmt.Errorf("no saved uperf stdout to parse, give a stdout file or a run info document")
+	}
+
+	bench := &urb.Benchmark
+	if bench.Preset != nil || len(bench.WorkloadPath) > 0 || len(bench.WorkloadRaw) > 0 {
+		if err := bench.loadWorkload(); err != nil {
+			return err
+		}
+	}
+
+	// Date documents by when the run happened, rather than when it was parsed
+	urb.startTime = urb.StartTime
+	if urb.startTime.IsZero() {
+		urb.startTime = urb.endTime
+	}
+	if urb.endTime.IsZero() {
+		urb.endTime = urb.startTime
+	}
+	if len(bench.ArtifactsDir) == 0 {
+		bench.ArtifactsDir = cfg.ArtifactsDir
+	}
+	bench.Metadata = define.GetMetadataPayload(cfg)
+	bench.Metadata.Benchmark = BenchmarkName
+	if !urb.startTime.IsZero() {
+		bench.Metadata.Timestamp = urb.startTime.UTC()
+		bench.Metadata.TimestampMS = urb.startTime.UnixMilli()
+	}
+
+	log.Info().
+		Str("stdout_path", urb.StdoutPath).
+		Str("run_info_path", urb.RunInfoPath).
+		Bool("has_workload", bench.workloadProfile() != nil).
+		Msg("Successfully loaded saved uperf output.")
+	return nil
+}
+
+// Run parses and exports the saved stdout, see UperfBenchmark.Run.
+// The saved output and workload are copied into the artifacts directory, as
+// they would be for a run of uperf.
+// If the stdout can't be parsed, then an UperfFailure is exported and an
+// error is returned.
+func (urb *UperfReplayBenchmark) Run(exporter define.Exporterable) error {
+	bench := &urb.Benchmark
+	if bench.workloadProfile() != nil {
+		bench.saveArtifact(ArtifactWorkload, bench.WorkloadRaw)
+	}
+	bench.saveArtifact(ArtifactStdout, urb.stdout)
+	bench.saveArtifact(ArtifactStderr, urb.stderr)
+	payloadResults, skippedLines, parseErr, exportErr := bench.parseAndExport(
+		exporter, strings.NewReader(urb.stdout), urb.StartTime,
+	)
+	if parseErr != nil {
+		return bench.exportFailure(
+			exporter, FailureParse, parseErr, 0,
+			urb.stdout, urb.stderr, urb.startTime, urb.endTime,
+		)
+	}
+	if exportErr != nil {
+		return exportErr
+	}
+	return bench.exportSummary(
+		exporter, payloadResults, skippedLines,
+		urb.stdout, urb.stderr, urb.startTime, urb.endTime,
+	)
+}
+
+// Teardown for the UperfReplayBenchmark. Nothing is left to clean up.
+func (urb *UperfReplayBenchmark) Teardown(*define.Config) error {
+	log.Info().Msg("Finished parsing saved uperf output.")
+	return nil
+}
@@ -0,0 +1,198 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// replayExported runs the given UperfReplayBenchmark, returning the run info
+// exported, the number of documents exported and the documents themselves.
+func replayExported(t *testing.T, bench *UperfReplayBenchmark) (*UperfRunInfoPayload, int, [][]byte) {
+	if err := bench.Setup(&define.Config{RunID: "abc-123"}); err != nil {
+		t.Fatalf("Unexpected error during setup: %s", err)
+	}
+	exporter := &sweepTestExporter{}
+	if err := bench.Run(exporter); err != nil {
+		t.Fatalf("Unexpected error during run: %s", err)
+	}
+	if err := bench.Teardown(&define.Config{}); err != nil {
+		t.Fatalf("Unexpected error during teardown: %s", err)
+	}
+
+	runInfo, err := findRunInfo([]byte(fmt.Sprintf("[%s]", joinExported(exporter.exported))))
+	if err != nil {
+		t.Fatalf("Expected a run info document to be exported, instead got: %s", err)
+	}
+	return runInfo, len(exporter.exported), exporter.exported
+}
+
+// joinExported joins the given exported documents with commas.
+func joinExported(exported [][]byte) string {
+	documents := []string{}
+	for _, document := range exported {
+		documents = append(documents, string(document))
+	}
+	return strings.Join(documents, ",")
+}
+
+// TestUperfReplayBenchmarkImplementsBenchmarkable ensures that the
+// UperfReplayBenchmark object implements the Benchmarkable interface
+func TestUperfReplayBenchmarkImplementsBenchmarkable(t *testing.T) {
+	var replay interface{} = &UperfReplayBenchmark{}
+	if _, ok := replay.(define.Benchmarkable); !ok {
+		t.Errorf("UperfReplayBenchmark failed Benchmarkable type assertion")
+	}
+}
+
+// TestUperfReplayBenchmarkStdout checks that saved stdout is parsed and
+// exported along with the given workload, and that re-parsing the exported
+// run info gives the same documents.
+func TestUperfReplayBenchmarkStdout(t *testing.T) {
+	dir := t.TempDir()
+	stdoutPath := filepath.Join(dir, "stdout.txt")
+	workloadPath := filepath.Join(dir, "iperf.xml")
+	if err := ioutil.WriteFile(stdoutPath, []byte(UPERF_TEST_STDOUT_ALL_ARGS_RAW), 0644); err != nil {
+		t.Fatalf("Unable to write test stdout: %s", err)
+	}
+	if err := ioutil.WriteFile(workloadPath, []byte(WORKLOAD_XML_IPERF), 0644); err != nil {
+		t.Fatalf("Unable to write test workload: %s", err)
+	}
+
+	start := time.Date(2022, time.February, 7, 17, 23, 15, 0, time.UTC)
+	runInfo, numExported, exported := replayExported(t, &UperfReplayBenchmark{
+		Benchmark: UperfBenchmark{
+			WorkloadPath: workloadPath,
+			Vars:         map[string]string{"nthr": "1", "h": "127.0.0.1", "proto": "tcp"},
+		},
+		StdoutPath: stdoutPath,
+		StartTime:  start,
+	})
+
+	expected, err := ParseUperfStdout(UPERF_TEST_STDOUT_ALL_ARGS_RAW)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing stdout: %s", err)
+	}
+	if numExported <= len(*expected) {
+		t.Errorf(
+			"Expected parsed stats plus latency stats and run info to be exported, instead got %d documents for %d stats",
+			numExported, len(*expected),
+		)
+	}
+	if !runInfo.StartTime.Equal(start) || runInfo.Metadata == nil || !runInfo.Metadata.Timestamp.Equal(start) {
+		t.Errorf("Expected run info and metadata to be dated %s, instead got %+v", start, runInfo)
+	}
+	if runInfo.Metadata.RunID != "abc-123" {
+		t.Errorf("Expected run ID abc-123, instead got %s", runInfo.Metadata.RunID)
+	}
+	if runInfo.Profile == nil || runInfo.Profile.Groups[0].NThreads != 1 || runInfo.Vars["h"] != "127.0.0.1" {
+		t.Errorf("Expected run info to hold the substituted workload, instead got %+v", runInfo)
+	}
+	if !strings.Contains(joinExported(exported), `"Peer":{"GroupIndex":0`) {
+		t.Errorf("Expected stats to be attributed to the workload's group")
+	}
+
+	// Replay the exported run info, as printed by --print-json
+	runInfoPath := filepath.Join(dir, "out.json")
+	if err := ioutil.WriteFile(runInfoPath, []byte(fmt.Sprintf("[%s]", joinExported(exported))), 0644); err != nil {
+		t.Fatalf("Unable to write exported documents: %s", err)
+	}
+	replayed, numReplayed, _ := replayExported(t, &UperfReplayBenchmark{RunInfoPath: runInfoPath})
+	if numReplayed != numExported {
+		t.Errorf("Expected %d documents when replaying run info, instead got %d", numExported, numReplayed)
+	}
+	if replayed.WorkloadSHA256 != runInfo.WorkloadSHA256 || replayed.Vars["nthr"] != "1" {
+		t.Errorf("Expected replayed run info to keep the workload and vars, instead got %+v", replayed)
+	}
+	if !replayed.StartTime.Equal(start) || !replayed.EndTime.Equal(runInfo.EndTime) {
+		t.Errorf(
+			"Expected replayed run to be dated %s to %s, instead got %s to %s",
+			start, runInfo.EndTime, replayed.StartTime, replayed.EndTime,
+		)
+	}
+}
+
+// TestUperfReplayBenchmarkWithoutWorkload checks that saved stdout can be
+// parsed without a workload, and that missing stdout is an error.
+func TestUperfReplayBenchmarkWithoutWorkload(t *testing.T) {
+	stdoutPath := filepath.Join(t.TempDir(), "stdout.txt")
+	if err := ioutil.WriteFile(stdoutPath, []byte(UPERF_TEST_STDOUT_MINIMAL_ARGS), 0644); err != nil {
+		t.Fatalf("Unable to write test stdout: %s", err)
+	}
+	runInfo, _, _ := replayExported(t, &UperfReplayBenchmark{StdoutPath: stdoutPath})
+	if runInfo.Profile != nil || len(runInfo.Workload) > 0 {
+		t.Errorf("Expected run info without a workload, instead got %+v", runInfo)
+	}
+	if runInfo.StartTime.IsZero() {
+		t.Errorf("Expected run to be dated by the stdout file, instead got the zero time")
+	}
+
+	bench := &UperfReplayBenchmark{}
+	if err := bench.Setup(&define.Config{}); err == nil {
+		t.Errorf("Expected error when no saved stdout is given, instead got nil")
+	}
+}
+
+// TestFindRunInfo checks that run info documents are found within single
+// documents, arrays and newline-delimited documents.
+func TestFindRunInfo(t *testing.T) {
+	runInfo, err := json.Marshal(&UperfRunInfoPayload{StdoutRaw: "Txn1 ...", Cmd: []string{"uperf"}})
+	if err != nil {
+		t.Fatalf("Unable to marshal run info: %s", err)
+	}
+	other := `{"Name": "Txn1", "SectionType": "tx"}`
+
+	for _, raw := range []string{
+		string(runInfo),
+		fmt.Sprintf("[%s, %s]", other, runInfo),
+		fmt.Sprintf("%s\n%s\n", other, runInfo),
+	} {
+		found, err := findRunInfo([]byte(raw))
+		if err != nil {
+			t.Errorf("Unexpected error when finding run info in %s: %s", raw, err)
+			continue
+		}
+		if found.StdoutRaw != "Txn1 ..." {
+			t.Errorf("Expected run info with saved stdout, instead got %+v", found)
+		}
+	}
+
+	if _, err := findRunInfo([]byte(other)); err == nil {
+		t.Errorf("Expected error when no run info is given, instead got nil")
+	}
+}
+
+// TestUperfReplayBenchmarkSavesArtifacts checks that the saved output is
+// copied into the Config's artifacts directory.
+func TestUperfReplayBenchmarkSavesArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	stdoutPath := filepath.Join(dir, "saved.txt")
+	if err := ioutil.WriteFile(stdoutPath, []byte(UPERF_TEST_STDOUT_MINIMAL_ARGS), 0644); err != nil {
+		t.Fatalf("Unable to write test stdout: %s", err)
+	}
+	artifactsDir := filepath.Join(dir, "artifacts")
+	bench := &UperfReplayBenchmark{StdoutPath: stdoutPath}
+	if err := bench.Setup(&define.Config{ArtifactsDir: artifactsDir}); err != nil {
+		t.Fatalf("Unexpected error during setup: %s", err)
+	}
+	if err := bench.Run(&sweepTestExporter{}); err != nil {
+		t.Fatalf("Unexpected error during run: %s", err)
+	}
+
+	saved, err := ioutil.ReadFile(filepath.Join(artifactsDir, ArtifactStdout))
+	if err != nil || string(saved) != UPERF_TEST_STDOUT_MINIMAL_ARGS {
+		t.Errorf("Expected stdout to be saved as an artifact, instead got %q (%v)", string(saved), err)
+	}
+	if _, err := ioutil.ReadFile(filepath.Join(artifactsDir, ArtifactWorkload)); err == nil {
+		t.Errorf("Expected no workload artifact when no workload is given")
+	}
+}
@@ -0,0 +1,182 @@
+//go:build uperf
+// +build uperf
+
+package uperf
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultServerPort is the port uperf listens on when started with `-s` and no `-P`.
+const DefaultServerPort int = 20000
+
+// serverStartTimeout is how long to wait for a managed uperf server to start
+// accepting connections.
+const serverStartTimeout time.Duration = 10 * time.Second
+
+// serverPollInterval is how long to wait between checks on whether a managed
+// uperf server is ready.
+const serverPollInterval time.Duration = 100 * time.Millisecond
+
+// serverPort returns the port the managed uperf server listens on.
+func (u *UperfBenchmark) serverPort() int {
+	if u.ServerPort == 0 {
+		return DefaultServerPort
+	}
+	return u.ServerPort
+}
+
+// serverCmd returns the command used to start the managed uperf server.
+// The uperf binary is taken from the benchmark's Cmd, if it has been set.
+// If ServerNetns is set, then the server is started within the given network
+// namespace using `ip netns exec`.
+func (u *UperfBenchmark) serverCmd() []string {
+	binary := "uperf"
+	if len(u.Cmd) > 0 {
+		binary = u.Cmd[0]
+	}
+	cmd := []string{binary, "-s"}
+	if u.ServerPort != 0 {
+		cmd = append(cmd, "-P", strconv.Itoa(u.ServerPort))
+	}
+	if len(u.ServerNetns) > 0 {
+		cmd = append([]string{"ip", "netns", "exec", u.ServerNetns}, cmd...)
+	}
+	return cmd
+}
+
+// startServer starts a uperf server in the background, writing its output to
+// ServerLogPath, and waits for it to become ready.
+func (u *UperfBenchmark) startServer() error {
+	cmdArgs := u.serverCmd()
+	serverLog, err := os.Create(u.ServerLogPath)
+	if err != nil {
+		return fmt.Errorf(
+			"unable to create uperf server log at %s: %s", u.ServerLogPath, err,
+		)
+	}
+
+	cmd := exec.Command(cmdArgs[0], cmdArgs[1:]...)
+	cmd.Stdout = serverLog
+	cmd.Stderr = serverLog
+	if err := cmd.Start(); err != nil {
+		serverLog.Close()
+		return fmt.Errorf(
+			"unable to start uperf server with '%s': %s",
+			strings.Join(cmdArgs, " "), err,
+		)
+	}
+	u.server = cmd
+	u.serverLog = serverLog
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	u.serverExited = exited
+
+	log.Info().
+		Str("cmd", strings.Join(cmdArgs, " ")).
+		Str("log_path", u.ServerLogPath).
+		Int("pid", cmd.Process.Pid).
+		Msg("Started uperf server, waiting for it to become ready.")
+
+	if err := u.waitForServer(serverStartTimeout); err != nil {
+		u.stopServer()
+		return err
+	}
+
+	log.Info().
+		Int("port", u.serverPort()).
+		Msg("Uperf server is ready.")
+	return nil
+}
+
+// waitForServer checks that the managed uperf server is accepting connections,
+// until the given timeout is reached.
+// Connections can't be made into another network namespace, so if ServerNetns
+// is set, then the server is only checked to still be running once the
+// timeout's worth of polls have been given for it to fail.
+func (u *UperfBenchmark) waitForServer(timeout time.Duration) error {
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(u.serverPort()))
+	deadline := time.Now().Add(timeout)
+	if len(u.ServerNetns) > 0 {
+		deadline = time.Now().Add(serverPollInterval * 10)
+	}
+
+	for {
+		select {
+		case err := <-u.serverExited:
+			u.serverExited = nil
+			return fmt.Errorf(
+				"uperf server exited before becoming ready (%v), output: %s",
+				err, u.serverOutput(),
+			)
+		default:
+		}
+
+		if len(u.ServerNetns) == 0 {
+			conn, err := net.DialTimeout("tcp", address, serverPollInterval)
+			if err == nil {
+				conn.Close()
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if len(u.ServerNetns) > 0 {
+				return nil
+			}
+			return fmt.Errorf(
+				"uperf server did not accept connections on %s within %s",
+				address, timeout,
+			)
+		}
+		time.Sleep(serverPollInterval)
+	}
+}
+
+// serverOutput returns what the managed uperf server has written to its log so far.
+func (u *UperfBenchmark) serverOutput() string {
+	output, err := ioutil.ReadFile(u.ServerLogPath)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// stopServer kills the managed uperf server, if it is running, and closes its log.
+func (u *UperfBenchmark) stopServer() error {
+	if u.server == nil {
+		return nil
+	}
+	defer func() {
+		u.server = nil
+		u.serverExited = nil
+		u.serverLog.Close()
+	}()
+
+	if u.serverExited == nil {
+		// Server has already exited
+		return nil
+	}
+	if err := u.server.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("unable to stop uperf server: %s", err)
+	}
+	<-u.serverExited
+
+	log.Info().
+		Str("log_path", u.ServerLogPath).
+		Msg("Stopped uperf server.")
+	return nil
+}
@@ -0,0 +1,75 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServerCmd checks that the command used to start a managed uperf server
+// respects the configured binary, port and network namespace.
+func TestServerCmd(t *testing.T) {
+	tests := []struct {
+		benchmark UperfBenchmark
+		expected  []string
+	}{
+		{UperfBenchmark{}, []string{"uperf", "-s"}},
+		{UperfBenchmark{Cmd: []string{"/opt/uperf", "-m", "a.xml"}, ServerPort: 30000}, []string{"/opt/uperf", "-s", "-P", "30000"}},
+		{UperfBenchmark{ServerNetns: "server"}, []string{"ip", "netns", "exec", "server", "uperf", "-s"}},
+	}
+
+	for _, test := range tests {
+		result := test.benchmark.serverCmd()
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("Expected server command %v, instead got %v", test.expected, result)
+		}
+	}
+}
+
+// TestWaitForServer checks that a server accepting connections on the
+// configured port is considered ready.
+func TestWaitForServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to create listener: %s", err)
+	}
+	defer listener.Close()
+
+	u := UperfBenchmark{ServerPort: listener.Addr().(*net.TCPAddr).Port}
+	if err := u.waitForServer(time.Second); err != nil {
+		t.Errorf("Expected server to be ready, instead got: %s", err)
+	}
+}
+
+// TestStartServerExitsEarly checks that an error containing the server's
+// output is returned if the server exits before becoming ready.
+func TestStartServerExitsEarly(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "server.log")
+	u := UperfBenchmark{
+		// `sh -s` runs commands from stdin, which is empty, and exits immediately.
+		Cmd:           []string{"sh"},
+		ServerPort:    1,
+		ServerLogPath: logPath,
+	}
+
+	err := u.startServer()
+	if err == nil {
+		t.Fatal("Expected error when server exits early, instead got nil")
+	}
+	if !strings.Contains(err.Error(), "exited before becoming ready") {
+		t.Errorf("Expected error about server exiting, instead got: %s", err)
+	}
+	if u.server != nil {
+		t.Error("Expected server to be cleaned up after failing to start")
+	}
+	if _, err := ioutil.ReadFile(logPath); err != nil {
+		t.Errorf("Expected server log to be created, instead got: %s", err)
+	}
+}
@@ -5,14 +5,14 @@ package uperf
 
 import (
 	"fmt"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/docker/go-units"
 	"github.com/learnitall/gobench/define"
-	"github.com/rs/zerolog/log"
+	"github.com/learnitall/gobench/units"
 )
 
 // StatSectionType defines the section a stat was parsed from.
@@ -22,6 +22,7 @@ const (
 	StatSectionGroup     StatSectionType = "groups"
 	StatSectionStrand    StatSectionType = "strand"
 	StatSectionTX        StatSectionType = "tx"
+	StatSectionInterval  StatSectionType = "interval"
 	StatSectionFlowopAvg StatSectionType = "flowop_avg"
 	StatSectionTxAvg     StatSectionType = "tx_avg"
 	StatSectionNetstat   StatSectionType = "netstat"
@@ -46,11 +47,23 @@ type DetailsStat struct {
 	TotalBytes     int64   `json:",omitempty"`
 	TotalSeconds   float64 `json:",omitempty"`
 	BytesPerSecond int64   `json:",omitempty"`
+	BitsPerSecond  int64   `json:",omitempty"`
 	OpsPerSecond   int     `json:",omitempty"`
 	// Raw Stats
 	TimestampMS float64 `json:",omitempty"`
 	Bytes       int     `json:",omitempty"`
 	Ops         int     `json:",omitempty"`
+	// Interval Stats, see annotateIntervals
+	IntervalIndex          int        `json:",omitempty"`
+	Timestamp              *time.Time `json:",omitempty"`
+	IntervalSeconds        float64    `json:",omitempty"`
+	IntervalBytes          int64      `json:",omitempty"`
+	IntervalOps            int64      `json:",omitempty"`
+	IntervalBytesPerSecond float64    `json:",omitempty"`
+	IntervalBitsPerSecond  float64    `json:",omitempty"`
+	IntervalOpsPerSecond   float64    `json:",omitempty"`
+	// Group which produced the stat, see PeerInfo
+	Peer *PeerInfo `json:",omitempty"`
 }
 
 type AveragesStat struct {
@@ -62,6 +75,7 @@ type AveragesStat struct {
 	CpuSeconds  float64
 	MaxSeconds  float64
 	MinSeconds  float64
+	Peer        *PeerInfo `json:",omitempty"`
 }
 
 type NetstatStat struct {
@@ -72,6 +86,8 @@ type NetstatStat struct {
 	InPktsPerSecond   int64
 	OutBytesPerSecond int64
 	InBytesPerSecond  int64
+	OutBitsPerSecond  int64
+	InBitsPerSecond   int64
 }
 
 type RunStat struct {
@@ -81,8 +97,10 @@ type RunStat struct {
 	TimeSeconds              float64
 	DataBytes                int64
 	ThroughputBytesPerSecond int64
+	ThroughputBitsPerSecond  int64
 	Operations               int64
 	Errors                   float64
+	Peer                     *PeerInfo `json:",omitempty"`
 }
 
 type RunDiffStat struct {
@@ -96,8 +114,8 @@ type RunDiffStat struct {
 }
 
 // UperfStdout represents the data parsed from uperf's stdout.
-// Acts as a list of pointers to any struct that should be marshalled and exported.
-type UperfStdout []interface{}
+// Acts as a list of documents that should be marshalled and exported.
+type UperfStdout []define.Document
 
 // getParseError constructs a new error instance for when a struct's
 // field cannot be parser correctly.
@@ -111,32 +129,25 @@ func getParseError(stdoutLine string, field string, object string, name string)
 	)
 }
 
-// parseSecondsString parses a string of the format <float>(s) or <float>s, returning a corresponding float64.
+// parseSecondsString parses a string of the format <float>(s) or <float><unit>, returning a corresponding float64.
 func parseSecondsString(humanString string) (float64, error) {
-	duration, err := time.ParseDuration(
-		strings.Replace(
-			strings.Replace(humanString, "(", "", 1),
-			")", "", 1,
-		),
-	)
-
-	if err != nil {
-		return 0, err
-	}
-	return duration.Seconds(), nil
+	return units.ParseDuration(humanString)
 }
 
 // parseDataString parses a string of the format <float><data units>, normalizing it to bytes.
+// Uperf gives sizes in bytes using powers of 1024, see units.Uperf.
 func parseDataString(humanString string) (int64, error) {
-	return units.FromHumanSize(humanString)
+	data, err := units.ParseData(humanString, units.Uperf)
+	if err != nil {
+		return 0, err
+	}
+	return data.Bytes(), nil
 }
 
-// parseDataPerSecond parses a string of the format '<float><data units>/s', normalizing
-// it to bytes per second.
-func parseDataPerSecondString(humanString string) (int64, error) {
-	return parseDataString(
-		strings.Replace(humanString, "/s", "", 1),
-	)
+// parseDataPerSecond parses a string of the format '<float><data units>/s', such as
+// `18.92Gb/s`. Uperf gives rates in bits using powers of 1000, see units.Uperf.
+func parseDataPerSecondString(humanString string) (units.Data, error) {
+	return units.ParseDataRate(humanString, units.Uperf)
 }
 
 // checkNumFields checks if the number of fields in the given string is greater than or equal to a given number.
@@ -170,20 +181,6 @@ func checkPrefix(humanString string, expected string, object string) error {
 	return nil
 }
 
-// addMetadataField adds the given pointer to a define.Metadata object into the
-// given struct pointer, if the struct has a field named 'Metadata'.
-// If the Metadata field exists on the given struct and it can be added, then
-// a debug log is emitted.
-func addMetadataField(targetStruct interface{}, metadata define.Metadata) {
-	metadataField := reflect.ValueOf(targetStruct).Elem().FieldByName("Metadata")
-	if metadataField.CanSet() {
-		metadataField.Set(reflect.ValueOf(&metadata))
-		log.Debug().
-			Interface("stat", targetStruct).
-			Msg("Added metadata to stdout stat.")
-	}
-}
-
 // ParseDetailsStatComputed parses the given line expected to contain a DetailsStat in a computed format.
 // Checks that the line contains 7 fields.
 // Examples:
@@ -201,7 +198,7 @@ func parseDetailsStatComputed(stdoutLine string) (*DetailsStat, error) {
 			getParseError(stdoutLine, fields[fieldNum], "DetailsStatComputed", name)
 	}
 
-	totalBytes, err := units.FromHumanSize(fields[1])
+	totalBytes, err := parseDataString(fields[1])
 	if err != nil {
 		return _onError(1, "TotalBytes")
 	}
@@ -211,12 +208,12 @@ func parseDetailsStatComputed(stdoutLine string) (*DetailsStat, error) {
 		return _onError(3, "TotalSeconds")
 	}
 
-	bytesPerSecond, err := parseDataPerSecondString(fields[5])
+	dataPerSecond, err := parseDataPerSecondString(fields[5])
 	if err != nil {
 		return _onError(5, "BytesPerSecond")
 	}
 
-	opsPerSecond, err := strconv.Atoi(strings.Replace(fields[6], "op/s", "", 1))
+	opsPerSecond, err := units.ParseOpRate(fields[6])
 	if err != nil {
 		return _onError(6, "OpsPerSecond")
 	}
@@ -226,8 +223,9 @@ func parseDetailsStatComputed(stdoutLine string) (*DetailsStat, error) {
 		DetailFormat:   DetailsFormatComputed,
 		TotalBytes:     totalBytes,
 		TotalSeconds:   totalTime,
-		BytesPerSecond: bytesPerSecond,
-		OpsPerSecond:   opsPerSecond,
+		BytesPerSecond: dataPerSecond.Bytes(),
+		BitsPerSecond:  dataPerSecond.Bits(),
+		OpsPerSecond:   int(math.Round(opsPerSecond)),
 	}, nil
 }
 
@@ -396,8 +394,10 @@ func parseNetstatStat(stdoutLine string) (*NetstatStat, error) {
 		Name:              name,
 		OutPktsPerSecond:  int64(outPkts),
 		InPktsPerSecond:   int64(inPkts),
-		OutBytesPerSecond: outBytes,
-		InBytesPerSecond:  inBytes,
+		OutBytesPerSecond: outBytes.Bytes(),
+		InBytesPerSecond:  inBytes.Bytes(),
+		OutBitsPerSecond:  outBytes.Bits(),
+		InBitsPerSecond:   inBytes.Bits(),
 	}, nil
 }
 
@@ -447,7 +447,8 @@ func parseRunStat(stdoutLine string) (*RunStat, error) {
 		Hostname:                 hostname,
 		TimeSeconds:              timeSeconds,
 		DataBytes:                dataBytes,
-		ThroughputBytesPerSecond: throughput,
+		ThroughputBytesPerSecond: throughput.Bytes(),
+		ThroughputBitsPerSecond:  throughput.Bits(),
 		Operations:               int64(ops),
 		Errors:                   es,
 	}, nil
@@ -505,211 +506,138 @@ func parseRunDiffStat(stdoutLine string) (*RunDiffStat, error) {
 	return &RunDiffStat, nil
 }
 
-// parseUperfStdoutSection calls the given callback function on each line
-// in the given stdoutLines until a line that is empty is hit.
-// If a line is encountered that contains dashes, it will be skipped over.
-// We assume that the stdoutLines starts with the section header/title, ie:
-// `[Section Header, -(a bunch of dashes)-, Section Contents]`
-func parseUperfStdoutSection(stdoutLines []string, callback func(string) error) ([]string, error) {
-	// Skip ahead two lines to get past the header and dashes
-	stdoutLines = stdoutLines[1:]
-	for {
-		stdoutLines = stdoutLines[1:]
-
-		if len(stdoutLines) == 0 {
-			return stdoutLines, nil
-		}
-
-		if len(stdoutLines[0]) == 0 {
-			return stdoutLines, nil
-		}
-
-		if strings.HasPrefix(stdoutLines[0], "---") {
-			continue
-		}
-
-		err := callback(stdoutLines[0])
-		if err != nil {
-			return stdoutLines, err
-		}
-	}
+// intervalTotals returns the cumulative seconds, bytes and operations of the given
+// transaction stat, based on the format it was parsed in.
+// Computed stats only report an average rate of operations, so the number of
+// operations is estimated from the rate and the elapsed time.
+func intervalTotals(stat *DetailsStat) (float64, int64, int64) {
+	if stat.DetailFormat == DetailsFormatRaw {
+		return stat.TimestampMS / 1000, int64(stat.Bytes), int64(stat.Ops)
+	}
+	return stat.TotalSeconds,
+		stat.TotalBytes,
+		int64(math.Round(float64(stat.OpsPerSecond) * stat.TotalSeconds))
 }
 
-// parseUperfStdoutDetailsSection parses a section containing DetailsStat.
-func parseUperfStdoutDetailsSection(stdoutLines []string, sectionType StatSectionType, result *UperfStdout) ([]string, error) {
-	return parseUperfStdoutSection(
-		stdoutLines,
-		func(nextLine string) error {
-			detailsStat, err := parseDetailsStat(nextLine)
-			if err != nil {
-				return err
-			}
-			detailsStat.SectionType = sectionType
-			*result = append(*result, detailsStat)
-			return nil
-		},
-	)
+// intervalAnnotator turns transaction stats into time-series interval stats as
+// they are parsed. See annotateIntervals.
+type intervalAnnotator struct {
+	startTime   time.Time
+	previous    *DetailsStat
+	index       int
+	txnOffset   float64
+	lastSummary *DetailsStat
 }
 
-// parseUperfStdoutAveragesSection parses a section containing AveragesStat.
-func parseUperfStdoutAveragesSection(stdoutLines []string, sectionType StatSectionType, result *UperfStdout) ([]string, error) {
-	return parseUperfStdoutSection(
-		stdoutLines,
-		func(nextLine string) error {
-			averagesStat, err := parseAveragesStat(nextLine)
-			if err != nil {
-				return err
-			}
-			averagesStat.SectionType = sectionType
-			*result = append(*result, averagesStat)
-			return nil
-		},
-	)
+// finishTxn returns the summary for the current transaction, if there is one.
+func (ia *intervalAnnotator) finishTxn() []define.Document {
+	ia.previous = nil
+	if ia.lastSummary == nil {
+		return nil
+	}
+	summary := *ia.lastSummary
+	summary.SectionType = StatSectionTX
+	summary.IntervalIndex = 0
+	summary.Timestamp = nil
+	summary.IntervalSeconds = 0
+	summary.IntervalBytes = 0
+	summary.IntervalOps = 0
+	summary.IntervalBytesPerSecond = 0
+	summary.IntervalBitsPerSecond = 0
+	summary.IntervalOpsPerSecond = 0
+	if summary.DetailFormat == DetailsFormatComputed {
+		ia.txnOffset += summary.TotalSeconds
+	}
+	ia.lastSummary = nil
+	return []define.Document{&summary}
 }
 
-// parseUperfStdoutNetstatSection parses a section containing NetstatStat,
-// placing the results into the given UperfStdout struct under the `NetstatStats` map.
-func parseUperfStdoutNetstatSection(stdoutLines []string, result *UperfStdout) ([]string, error) {
-	return parseUperfStdoutSection(
-		stdoutLines,
-		func(nextLine string) error {
-			if strings.HasPrefix(strings.ReplaceAll(nextLine, " ", ""), "Nicopkts/s") {
-				return nil
-			}
-			netstatStat, err := parseNetstatStat(nextLine)
-			if err != nil {
-				return err
-			}
-			netstatStat.SectionType = StatSectionNetstat
-			*result = append(*result, netstatStat)
-			return nil
-		},
-	)
+// add annotates the given document if it is a transaction stat, returning
+// the documents which are ready to be exported.
+func (ia *intervalAnnotator) add(document define.Document) []define.Document {
+	stat, ok := document.(*DetailsStat)
+	if !ok || stat.SectionType != StatSectionTX || stat.Name == "Total" {
+		return append(ia.finishTxn(), document)
+	}
+
+	var ready []define.Document
+	if ia.previous == nil || ia.previous.Name != stat.Name {
+		ready = ia.finishTxn()
+		ia.index = 0
+	}
+	ia.index++
+
+	stat.SectionType = StatSectionInterval
+	stat.IntervalIndex = ia.index
+
+	seconds, bytes, ops := intervalTotals(stat)
+	if ia.previous != nil {
+		previousSeconds, previousBytes, previousOps := intervalTotals(ia.previous)
+		stat.IntervalSeconds = seconds - previousSeconds
+		stat.IntervalBytes = bytes - previousBytes
+		stat.IntervalOps = ops - previousOps
+	} else if stat.DetailFormat == DetailsFormatComputed {
+		stat.IntervalSeconds = seconds
+		stat.IntervalBytes = bytes
+		stat.IntervalOps = ops
+	}
+	if stat.IntervalSeconds > 0 {
+		stat.IntervalBytesPerSecond = float64(stat.IntervalBytes) / stat.IntervalSeconds
+		stat.IntervalBitsPerSecond = stat.IntervalBytesPerSecond * 8
+		stat.IntervalOpsPerSecond = float64(stat.IntervalOps) / stat.IntervalSeconds
+	}
+
+	if stat.DetailFormat == DetailsFormatRaw {
+		timestamp := millisecondsToTime(stat.TimestampMS)
+		stat.Timestamp = &timestamp
+	} else if !ia.startTime.IsZero() {
+		timestamp := ia.startTime.Add(
+			time.Duration((ia.txnOffset + seconds) * float64(time.Second)),
+		).UTC()
+		stat.Timestamp = &timestamp
+		stat.TimestampMS = float64(timestamp.UnixNano()) / float64(time.Millisecond)
+	}
+
+	// Keep a copy, as the stat may be changed by its consumer once it is sent,
+	// ie when its metadata is set
+	kept := *stat
+	ia.previous = &kept
+	ia.lastSummary = &kept
+	return append(ready, stat)
 }
 
-// parseUperfStdoutRunStatsSection parses a section containing RunStats,
-// placing the results into the given UperfStdout.
-func parseUperfStdoutRunStatsSection(stdoutLines []string, result *UperfStdout) ([]string, error) {
-	return parseUperfStdoutSection(
-		stdoutLines,
-		func(nextLine string) error {
-			if strings.HasPrefix(strings.ReplaceAll(nextLine, " ", ""), "HostnameTime") {
-				return nil
-			}
-			if strings.HasPrefix(nextLine, "Difference") {
-				runStatsDiff, err := parseRunDiffStat(nextLine)
-				if err != nil {
-					return err
-				}
-				runStatsDiff.SectionType = StatSectionRunDiff
-				*result = append(*result, runStatsDiff)
-				return nil
-			}
-			runStat, err := parseRunStat(nextLine)
-			if err != nil {
-				return err
-			}
-			runStat.SectionType = StatSectionRun
-			*result = append(*result, runStat)
-			return nil
-		},
-	)
+// annotateIntervals turns the transaction stats within the given result into
+// time-series interval stats.
+// Uperf prints a transaction's cumulative progress as it runs, once a second
+// or as often as is given through `-i`. Each of these lines is given the
+// StatSectionInterval section, an IntervalIndex starting at 1, a Timestamp and
+// the bytes, operations and time which passed since the last line.
+// The last line for each transaction is also kept under StatSectionTX, as it
+// summarizes the whole transaction.
+// Computed lines don't include a timestamp, so one is derived from the given
+// startTime, assuming transactions run one after another. If startTime is the
+// zero time, then computed lines are not given a Timestamp.
+func annotateIntervals(result *UperfStdout, startTime time.Time) {
+	annotator := &intervalAnnotator{startTime: startTime}
+	annotated := UperfStdout{}
+	for _, document := range *result {
+		annotated = append(annotated, annotator.add(document)...)
+	}
+	annotated = append(annotated, annotator.finishTxn()...)
+	*result = annotated
 }
 
-func parseUperfStdout(stdoutLines []string, result *UperfStdout) error {
-	if len(stdoutLines) == 0 {
-		return nil
-	}
-
-	currentLine := stdoutLines[0]
-
-	var (
-		detailsStat *DetailsStat = nil
-		err         error        = nil
-	)
-
-	if strings.HasPrefix(currentLine, "Group Details") {
-		log.Debug().Str("current_line", currentLine).Msg("Parsing Group Details section")
-		stdoutLines, err = parseUperfStdoutDetailsSection(
-			stdoutLines, StatSectionGroup, result,
-		)
-		if err != nil {
-			return err
-		}
-	} else if strings.HasPrefix(currentLine, "Strand Details") {
-		log.Debug().Str("current_line", currentLine).Msg("Parsing Strand Details section")
-		stdoutLines, err = parseUperfStdoutDetailsSection(
-			stdoutLines, StatSectionStrand, result,
-		)
-		if err != nil {
-			return err
-		}
-	} else if strings.HasPrefix(strings.ReplaceAll(currentLine, " ", ""), "TxnCount") {
-		log.Debug().Str("current_line", currentLine).Msg("Parsing Txn Averages section")
-		stdoutLines, err = parseUperfStdoutAveragesSection(
-			stdoutLines, StatSectionTxAvg, result,
-		)
-		if err != nil {
-			return err
-		}
-	} else if strings.HasPrefix(currentLine, "Flowop") {
-		log.Debug().Str("current_line", currentLine).Msg("Parsing Flowop Averages section")
-		stdoutLines, err = parseUperfStdoutAveragesSection(
-			stdoutLines, StatSectionFlowopAvg, result,
-		)
-		if err != nil {
-			return err
-		}
-	} else if strings.HasPrefix(currentLine, "Netstat statistics") {
-		log.Debug().Str("current_line", currentLine).Msg("Parsing Netstat Statistics section")
-		stdoutLines, err = parseUperfStdoutNetstatSection(
-			stdoutLines, result,
-		)
-		if err != nil {
-			return err
-		}
-	} else if strings.HasPrefix(currentLine, "Run Statistics") {
-		log.Debug().Str("current_line", currentLine).Msg("Parsing Run Statistics section")
-		stdoutLines, err = parseUperfStdoutRunStatsSection(
-			stdoutLines, result,
-		)
-		if err != nil {
-			return err
-		}
-	} else if strings.HasPrefix(currentLine, "Txn") || strings.HasPrefix(currentLine, "Total") {
-		log.Debug().Str("current_line", currentLine).Msg("Parsing Txn detail (computed)")
-		detailsStat, err = parseDetailsStatComputed(currentLine)
-		detailsStat.SectionType = StatSectionTX
-		if err != nil {
-			return err
-		}
-		*result = append(*result, detailsStat)
-		stdoutLines = stdoutLines[1:]
-	} else if strings.HasPrefix(currentLine, "timestamp_ms") {
-		log.Debug().Str("current_line", currentLine).Msg("Parsing Txn detail (raw)")
-		detailsStat, err = parseDetailsStatRaw(currentLine)
-		detailsStat.SectionType = StatSectionTX
-		if err != nil {
-			return err
-		}
-		*result = append(*result, detailsStat)
-		stdoutLines = stdoutLines[1:]
-	} else {
-		log.Debug().Str("current_line", currentLine).Msg("Skipping line")
-		stdoutLines = stdoutLines[1:]
-	}
-
-	return parseUperfStdout(stdoutLines, result)
+// ParseUperfStdout parses the given stdout from uperf into a list of documents.
+// Transaction progress lines are returned as interval stats without a timestamp
+// if they are in the computed format, see ParseUperfStdoutFrom.
+func ParseUperfStdout(uperfStdout string) (*UperfStdout, error) {
+	return ParseUperfStdoutFrom(uperfStdout, time.Time{})
 }
 
-func ParseUperfStdout(uperfStdout string) (*UperfStdout, error) {
-	var (
-		lines  []string     = strings.Split(uperfStdout, "\n")
-		result *UperfStdout = &UperfStdout{}
-	)
-	err := parseUperfStdout(lines, result)
-	if err != nil {
-		return nil, err
-	}
-	return result, err
+// ParseUperfStdoutFrom parses the given stdout from uperf into a list of documents,
+// using the given time uperf was started at to timestamp interval stats.
+// See UperfStdoutParser.
+func ParseUperfStdoutFrom(uperfStdout string, startTime time.Time) (*UperfStdout, error) {
+	parser := &UperfStdoutParser{Options: ParserOptions{StartTime: startTime}}
+	return parser.ParseAll(strings.NewReader(uperfStdout))
 }
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 )
 
 // uperf -T -t -f -g -k -p -e -E -a -v  -m iperf.xml
@@ -247,3 +248,152 @@ func TestParseUperfStdout(t *testing.T) {
 		fmt.Println(string(marshalled))
 	}
 }
+
+// TestParseUperfStdoutIntervalsRaw checks that transaction lines in the raw
+// format are turned into interval stats, with a summary for each transaction.
+func TestParseUperfStdoutIntervalsRaw(t *testing.T) {
+	out, err := ParseUperfStdout(UPERF_TEST_STDOUT_ALL_ARGS_RAW)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing stdout: %s", err)
+	}
+
+	intervals := map[string][]*DetailsStat{}
+	summaries := map[string]int{}
+	for _, document := range *out {
+		stat, ok := document.(*DetailsStat)
+		if !ok {
+			continue
+		}
+		switch stat.SectionType {
+		case StatSectionInterval:
+			intervals[stat.Name] = append(intervals[stat.Name], stat)
+		case StatSectionTX:
+			summaries[stat.Name]++
+		}
+	}
+
+	for _, name := range []string{"Txn1", "Txn2", "Txn3"} {
+		if summaries[name] != 1 {
+			t.Errorf("Expected one tx summary for %s, instead got %d", name, summaries[name])
+		}
+	}
+	if summaries["Total"] != 1 {
+		t.Errorf("Expected Total to be kept as a tx stat, instead got %d", summaries["Total"])
+	}
+
+	txn2 := intervals["Txn2"]
+	if len(txn2) != 30 {
+		t.Fatalf("Expected 30 interval stats for Txn2, instead got %d", len(txn2))
+	}
+	for i, stat := range txn2 {
+		if stat.IntervalIndex != i+1 {
+			t.Errorf("Expected interval index %d, instead got %d", i+1, stat.IntervalIndex)
+		}
+		if stat.Timestamp == nil {
+			t.Errorf("Expected interval %d to have a timestamp", stat.IntervalIndex)
+		}
+	}
+	second := txn2[1]
+	if second.IntervalBytes != 2338242560 || second.IntervalOps != 285430 {
+		t.Errorf(
+			"Expected second interval to have 2338242560 bytes and 285430 ops, instead got %d and %d",
+			second.IntervalBytes, second.IntervalOps,
+		)
+	}
+	if second.IntervalSeconds < 1.0 || second.IntervalSeconds > 1.01 {
+		t.Errorf("Expected second interval to last ~1s, instead got %f", second.IntervalSeconds)
+	}
+}
+
+// TestParseUperfStdoutIntervalsComputed checks that transaction lines in the
+// computed format are timestamped using the time uperf started.
+func TestParseUperfStdoutIntervalsComputed(t *testing.T) {
+	start := time.Date(2022, time.February, 7, 17, 23, 0, 0, time.UTC)
+	out, err := ParseUperfStdoutFrom(UPERF_TEST_STDOUT_ALL_ARGS, start)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing stdout: %s", err)
+	}
+
+	txn2 := []*DetailsStat{}
+	for _, document := range *out {
+		stat, ok := document.(*DetailsStat)
+		if ok && stat.SectionType == StatSectionInterval && stat.Name == "Txn2" {
+			txn2 = append(txn2, stat)
+		}
+	}
+	if len(txn2) != 2 {
+		t.Fatalf("Expected 2 interval stats for Txn2, instead got %d", len(txn2))
+	}
+
+	// Txn1 runs for 1.00s before Txn2 starts
+	expected := start.Add(31230 * time.Millisecond)
+	if txn2[1].Timestamp == nil || !txn2[1].Timestamp.Equal(expected) {
+		t.Errorf("Expected second Txn2 interval at %s, instead got %v", expected, txn2[1].Timestamp)
+	}
+	if seconds := txn2[1].IntervalSeconds; seconds < 1.19 || seconds > 1.21 {
+		t.Errorf("Expected second Txn2 interval to last 1.2s, instead got %f", seconds)
+	}
+}
+
+// TestParseUperfStdoutRates checks that rates uperf prints in bits are
+// exported in both bits and bytes per second, and that sizes use powers of 1024.
+func TestParseUperfStdoutRates(t *testing.T) {
+	out, err := ParseUperfStdout(UPERF_TEST_STDOUT_ALL_ARGS)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing stdout: %s", err)
+	}
+
+	var total *DetailsStat
+	var netstat *NetstatStat
+	var run *RunStat
+	for _, document := range *out {
+		switch stat := document.(type) {
+		case *DetailsStat:
+			if stat.Name == "Total" {
+				total = stat
+			}
+		case *NetstatStat:
+			if stat.Name == "lo" {
+				netstat = stat
+			}
+		case *RunStat:
+			if stat.Hostname == "master" {
+				run = stat
+			}
+		}
+	}
+	if total == nil || netstat == nil || run == nil {
+		t.Fatalf("Expected total, netstat and run stats, instead got %v, %v and %v", total, netstat, run)
+	}
+
+	// Total     66.11GB /  32.33(s) =    17.56Gb/s      267977op/s
+	if total.TotalBytes != 70985071985 {
+		t.Errorf("Expected total of 70985071985 bytes, instead got %d", total.TotalBytes)
+	}
+	if total.BitsPerSecond != 17560000000 || total.BytesPerSecond != 2195000000 {
+		t.Errorf(
+			"Expected total rate of 17560000000 bits/s and 2195000000 bytes/s, instead got %d and %d",
+			total.BitsPerSecond, total.BytesPerSecond,
+		)
+	}
+	if total.OpsPerSecond != 267977 {
+		t.Errorf("Expected total rate of 267977 op/s, instead got %d", total.OpsPerSecond)
+	}
+	// lo         267977      267977    17.62Gb/s    17.62Gb/s
+	if netstat.OutBitsPerSecond != 17620000000 || netstat.InBytesPerSecond != 2202500000 {
+		t.Errorf(
+			"Expected netstat rate of 17620000000 bits/s and 2202500000 bytes/s, instead got %d and %d",
+			netstat.OutBitsPerSecond, netstat.InBytesPerSecond,
+		)
+	}
+	// master            32.33s    66.11GB    17.56Gb/s      8664523        0.00
+	if run.ThroughputBitsPerSecond != 17560000000 || run.ThroughputBytesPerSecond != 2195000000 {
+		t.Errorf(
+			"Expected run throughput of 17560000000 bits/s and 2195000000 bytes/s, instead got %d and %d",
+			run.ThroughputBitsPerSecond, run.ThroughputBytesPerSecond,
+		)
+	}
+	if run.TimeSeconds != 32.33 {
+		t.Errorf("Expected run time of 32.33s, instead got %v", run.TimeSeconds)
+	}
+}
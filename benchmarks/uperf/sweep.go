@@ -0,0 +1,407 @@
+//go:build uperf
+// +build uperf
+
+// sweep.go defines functionality for running uperf once for each combination
+// of a set of workload parameters.
+package uperf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+)
+
+// StatSectionSweepSummary is the section given to SweepSummary documents.
+const StatSectionSweepSummary StatSectionType = "sweep_summary"
+
+// SweepIndexTag is the metadata tag holding the index of the sweep
+// combination a document belongs to.
+const SweepIndexTag string = "sweep_index"
+
+// sweepParameterName matches the names of variables which can be substituted
+// into a workload by SubstituteWorkloadVars.
+var sweepParameterName *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// presetParameters lists the sweep parameters which override the options of a
+// preset, see applyPresetParameter.
+var presetParameters []string = []string{"proto", "nthr", "size", "duration", "remote"}
+
+// SweepParameter is a workload parameter and the values to sweep it over.
+type SweepParameter struct {
+	Name   string
+	Values []string
+}
+
+// SweepSpec lists each parameter within a sweep.
+type SweepSpec []SweepParameter
+
+// ParseSweepParameter parses a parameter of the format `name=value1,value2,...`.
+func ParseSweepParameter(parameter string) (SweepParameter, error) {
+	fields := strings.SplitN(parameter, "=", 2)
+	if len(fields) != 2 {
+		return SweepParameter{}, fmt.Errorf(
+			"expected sweep parameter of the format name=value1,value2,..., got: %s",
+			parameter,
+		)
+	}
+	name := strings.TrimSpace(fields[0])
+	if !sweepParameterName.MatchString(name) {
+		return SweepParameter{}, fmt.Errorf(
+			"sweep parameter name '%s' must only contain letters, numbers and underscores", name,
+		)
+	}
+
+	values := []string{}
+	for _, value := range strings.Split(fields[1], ",") {
+		value = strings.TrimSpace(value)
+		if len(value) == 0 {
+			return SweepParameter{}, fmt.Errorf(
+				"sweep parameter %s contains an empty value: %s", name, parameter,
+			)
+		}
+		values = append(values, value)
+	}
+	return SweepParameter{Name: name, Values: values}, nil
+}
+
+// ParseSweepSpec parses each of the given parameters into a SweepSpec.
+// See ParseSweepParameter.
+func ParseSweepSpec(parameters []string) (SweepSpec, error) {
+	spec := SweepSpec{}
+	seen := map[string]bool{}
+	for _, parameter := range parameters {
+		sweepParameter, err := ParseSweepParameter(parameter)
+		if err != nil {
+			return nil, err
+		}
+		if seen[sweepParameter.Name] {
+			return nil, fmt.Errorf(
+				"sweep parameter %s was given more than once", sweepParameter.Name,
+			)
+		}
+		seen[sweepParameter.Name] = true
+		spec = append(spec, sweepParameter)
+	}
+	return spec, nil
+}
+
+// Names returns the name of each parameter within the SweepSpec, in order.
+func (ss SweepSpec) Names() []string {
+	names := []string{}
+	for _, parameter := range ss {
+		names = append(names, parameter.Name)
+	}
+	return names
+}
+
+// Expand returns every combination of values within the SweepSpec.
+// Combinations are ordered so the last parameter changes the fastest.
+func (ss SweepSpec) Expand() []map[string]string {
+	combinations := []map[string]string{{}}
+	for _, parameter := range ss {
+		expanded := []map[string]string{}
+		for _, combination := range combinations {
+			for _, value := range parameter.Values {
+				next := map[string]string{}
+				for name, existing := range combination {
+					next[name] = existing
+				}
+				next[parameter.Name] = value
+				expanded = append(expanded, next)
+			}
+		}
+		combinations = expanded
+	}
+	return combinations
+}
+
+// SweepCombination describes how the run of a single combination within a sweep went.
+type SweepCombination struct {
+	Index      int
+	Parameters map[string]string
+	StartTime  time.Time
+	EndTime    time.Time
+	Success    bool
+	Error      string `json:",omitempty"`
+}
+
+// SweepSummary indexes each combination run within a sweep.
+type SweepSummary struct {
+	Metadata     *define.Metadata
+	SectionType  StatSectionType
+	Parameters   []string
+	Combinations []SweepCombination
+}
+
+// BenchmarkName returns BenchmarkName.
+func (ss *SweepSummary) BenchmarkName() string { return BenchmarkName }
+
+// DocumentKind returns StatSectionSweepSummary.
+func (ss *SweepSummary) DocumentKind() string { return string(ss.SectionType) }
+
+// DocumentTimestamp returns the time the sweep started.
+func (ss *SweepSummary) DocumentTimestamp() time.Time { return metadataTimestamp(ss.Metadata) }
+
+// SetMetadata attaches the run's Metadata to the sweep summary.
+func (ss *SweepSummary) SetMetadata(metadata *define.Metadata) { ss.Metadata = metadata }
+
+// Fields returns the sweep summary flattened by define.FlattenFields.
+func (ss *SweepSummary) Fields() (map[string]interface{}, error) {
+	return define.FlattenFields(ss)
+}
+
+// UperfSweepBenchmark runs the given UperfBenchmark once for each combination
+// of parameters within the given SweepSpec.
+// For each combination, every parameter is added to the benchmark's Vars,
+// overriding values given there, to be substituted into the workload by
+// SubstituteWorkloadVars. The process environment is left untouched. If the
+// UperfBenchmark uses a preset, then parameters named after preset flags
+// (proto, nthr, size, duration and remote) also override the preset's options.
+// Parameters which do neither are rejected during Setup.
+// Every document exported for a combination is tagged with its parameters and
+// its index, and a SweepSummary is exported once each combination has run.
+// It implements the define.Benchmarkable interface.
+type UperfSweepBenchmark struct {
+	Benchmark    UperfBenchmark
+	Sweep        SweepSpec
+	cfg          *define.Config
+	combinations []map[string]string
+}
+
+// Setup checks the SweepSpec and expands it into the combinations to run.
+// See checkParameters.
+func (usb *UperfSweepBenchmark) Setup(cfg *define.Config) error {
+	if len(usb.Sweep) == 0 {
+		return fmt.Errorf("a sweep requires at least one parameter")
+	}
+	if err := usb.checkParameters(); err != nil {
+		return err
+	}
+	usb.cfg = cfg
+	usb.combinations = usb.Sweep.Expand()
+
+	log.Info().
+		Strs("parameters", usb.Sweep.Names()).
+		Int("num_combinations", len(usb.combinations)).
+		Msg("Expanded uperf sweep.")
+	return nil
+}
+
+// checkParameters returns an error if a parameter within the sweep isn't
+// referenced by the workload, and isn't a preset option when a preset is used,
+// as it wouldn't change anything between combinations, such as a misspelled
+// parameter name. See workloadVarNames.
+// If the workload can't be loaded, then the check is skipped, leaving the
+// error to be reported by each combination.
+func (usb *UperfSweepBenchmark) checkParameters() error {
+	var (
+		workloadBytes []byte
+		err           error
+	)
+	known := map[string]bool{}
+	switch {
+	case usb.Benchmark.Preset != nil:
+		for _, name := range presetParameters {
+			known[name] = true
+		}
+		var profile *Profile
+		profile, err = BuildPresetProfile(*usb.Benchmark.Preset)
+		if err == nil {
+			workloadBytes, err = RenderWorkloadXML(profile)
+		}
+	case len(usb.Benchmark.WorkloadPath) > 0:
+		workloadBytes, err = ioutil.ReadFile(usb.Benchmark.WorkloadPath)
+	default:
+		return nil
+	}
+	if err != nil {
+		log.Debug().
+			Err(err).
+			Msg("Unable to load workload to check sweep parameters, skipping check.")
+		return nil
+	}
+	for _, name := range workloadVarNames(workloadBytes) {
+		known[name] = true
+	}
+
+	unreferenced := []string{}
+	for _, parameter := range usb.Sweep {
+		if !known[parameter.Name] {
+			unreferenced = append(unreferenced, parameter.Name)
+		}
+	}
+	if len(unreferenced) == 0 {
+		return nil
+	}
+	if usb.Benchmark.Preset != nil {
+		return fmt.Errorf(
+			"sweep parameter(s) %s are not referenced by the workload or one of the preset options %s",
+			strings.Join(unreferenced, ", "), strings.Join(presetParameters, ", "),
+		)
+	}
+	return fmt.Errorf(
+		"sweep parameter(s) %s are not referenced by the workload",
+		strings.Join(unreferenced, ", "),
+	)
+}
+
+// applyPresetParameter overrides the option of the given PresetOptions which
+// matches the given parameter name, if there is one.
+func applyPresetParameter(opts *PresetOptions, name string, value string) error {
+	switch name {
+	case "proto":
+		opts.Protocol = value
+	case "remote":
+		opts.Remote = value
+	case "size":
+		opts.Size = value
+	case "nthr":
+		nthreads, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse nthr value %s: %s", value, err)
+		}
+		opts.NThreads = nthreads
+	case "duration":
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse duration value %s: %s", value, err)
+		}
+		opts.Duration = duration
+	}
+	return nil
+}
+
+// runCombination sets up, runs and tears down a copy of the UperfBenchmark
+// using the given combination of parameters.
+func (usb *UperfSweepBenchmark) runCombination(
+	index int, combination map[string]string, exporter define.Exporterable,
+) error {
+	vars := map[string]string{}
+	for name, value := range usb.Benchmark.Vars {
+		vars[name] = value
+	}
+	for name, value := range combination {
+		vars[name] = value
+	}
+
+	bench := UperfBenchmark{
+		WorkloadPath:    usb.Benchmark.WorkloadPath,
+		Vars:            vars,
+		TolerantParsing: usb.Benchmark.TolerantParsing,
+		Args:            usb.Benchmark.Args,
+		Cmd:             usb.Benchmark.Cmd,
+		Serve:           usb.Benchmark.Serve,
+		ServerPort:      usb.Benchmark.ServerPort,
+		ServerNetns:     usb.Benchmark.ServerNetns,
+		ServerLogPath:   usb.Benchmark.ServerLogPath,
+		Timeout:         usb.Benchmark.Timeout,
+	}
+	if usb.Benchmark.Preset != nil {
+		preset := *usb.Benchmark.Preset
+		for name, value := range combination {
+			if err := applyPresetParameter(&preset, name, value); err != nil {
+				return err
+			}
+		}
+		bench.Preset = &preset
+	}
+	// Keep each combination's artifacts apart
+	artifactsDir := usb.Benchmark.ArtifactsDir
+	if len(artifactsDir) == 0 {
+		artifactsDir = usb.cfg.ArtifactsDir
+	}
+	if len(artifactsDir) > 0 {
+		bench.ArtifactsDir = filepath.Join(artifactsDir, fmt.Sprintf("sweep-%d", index))
+	} else if bench.Serve && len(bench.ServerLogPath) == 0 {
+		bench.ServerLogPath = fmt.Sprintf("uperf-server-%s-%d.log", usb.cfg.RunID, index)
+	}
+
+	if err := bench.Setup(usb.cfg); err != nil {
+		bench.Teardown(usb.cfg)
+		return err
+	}
+	if bench.Metadata.Tags == nil {
+		bench.Metadata.Tags = map[string]string{}
+	}
+	for name, value := range combination {
+		bench.Metadata.Tags[name] = value
+	}
+	bench.Metadata.Tags[SweepIndexTag] = strconv.Itoa(index)
+
+	runErr := bench.Run(exporter)
+	teardownErr := bench.Teardown(usb.cfg)
+	if runErr != nil {
+		return runErr
+	}
+	return teardownErr
+}
+
+// Run runs each combination within the sweep in order, then exports a SweepSummary.
+// If a combination fails, then the remaining combinations are still run, and
+// an error listing each failed combination is returned.
+func (usb *UperfSweepBenchmark) Run(exporter define.Exporterable) error {
+	summary := &SweepSummary{
+		SectionType:  StatSectionSweepSummary,
+		Parameters:   usb.Sweep.Names(),
+		Combinations: []SweepCombination{},
+	}
+	failed := []string{}
+
+	for index, combination := range usb.combinations {
+		log.Info().
+			Int("index", index).
+			Interface("parameters", combination).
+			Msg("Running uperf sweep combination.")
+
+		result := SweepCombination{
+			Index:      index,
+			Parameters: combination,
+			StartTime:  time.Now().UTC(),
+		}
+		err := usb.runCombination(index, combination, exporter)
+		result.EndTime = time.Now().UTC()
+		result.Success = err == nil
+		if err != nil {
+			result.Error = err.Error()
+			failed = append(failed, fmt.Sprintf("%d (%s)", index, err))
+			log.Error().
+				Err(err).
+				Int("index", index).
+				Msg("Uperf sweep combination failed.")
+		}
+		summary.Combinations = append(summary.Combinations, result)
+	}
+
+	metadata := define.GetMetadataPayload(usb.cfg)
+	metadata.Benchmark = BenchmarkName
+	summary.SetMetadata(&metadata)
+	marshalled, err := exporter.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	if err := exporter.Export(marshalled); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf(
+			"%d of %d sweep combinations failed: %s",
+			len(failed), len(usb.combinations), strings.Join(failed, ", "),
+		)
+	}
+	return nil
+}
+
+// Teardown function for the uperf sweep.
+// Each combination is torn down after it runs, so this just returns nil.
+func (usb *UperfSweepBenchmark) Teardown(*define.Config) error {
+	log.Info().Msg("Uperf sweep finished")
+	return nil
+}
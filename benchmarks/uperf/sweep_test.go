@@ -0,0 +1,213 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// TestParseSweepSpec checks that sweep parameters are parsed and expanded
+// into every combination, with the last parameter changing the fastest.
+func TestParseSweepSpec(t *testing.T) {
+	spec, err := ParseSweepSpec([]string{"size=64,1k", "nthr=1, 4", "proto=tcp"})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing sweep spec: %s", err)
+	}
+	if !reflect.DeepEqual(spec.Names(), []string{"size", "nthr", "proto"}) {
+		t.Errorf("Expected parameters size, nthr and proto, instead got %v", spec.Names())
+	}
+
+	expected := []map[string]string{
+		{"size": "64", "nthr": "1", "proto": "tcp"},
+		{"size": "64", "nthr": "4", "proto": "tcp"},
+		{"size": "1k", "nthr": "1", "proto": "tcp"},
+		{"size": "1k", "nthr": "4", "proto": "tcp"},
+	}
+	if result := spec.Expand(); !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected combinations %v, instead got %v", expected, result)
+	}
+}
+
+// TestParseSweepSpecInvalid checks that malformed sweep parameters are rejected.
+func TestParseSweepSpecInvalid(t *testing.T) {
+	invalid := [][]string{
+		{"size"},
+		{"=64,1k"},
+		{"my-size=64"},
+		{"size=64,,1k"},
+		{"size=64", "size=1k"},
+	}
+	for _, parameters := range invalid {
+		if _, err := ParseSweepSpec(parameters); err == nil {
+			t.Errorf("Expected error parsing sweep parameters %v, instead got nil", parameters)
+		}
+	}
+}
+
+// sweepTestExporter collects each payload given to it.
+type sweepTestExporter struct {
+	exported [][]byte
+}
+
+func (ste *sweepTestExporter) Setup(*define.Config) error { return nil }
+
+func (ste *sweepTestExporter) Teardown() error { return nil }
+
+func (ste *sweepTestExporter) Healthcheck() error { return nil }
+
+func (ste *sweepTestExporter) Marshal(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (ste *sweepTestExporter) Export(payload []byte) error {
+	ste.exported = append(ste.exported, payload)
+	return nil
+}
+
+func (ste *sweepTestExporter) Flush() error { return nil }
+
+func (ste *sweepTestExporter) Report() []*define.ExportReport { return nil }
+
+// TestUperfSweepBenchmarkRun checks that each combination of a sweep is run
+// with its parameters substituted into the workload and added as tags, and
+// that a summary of every combination is exported.
+func TestUperfSweepBenchmarkRun(t *testing.T) {
+	workloadPath := filepath.Join(t.TempDir(), "workload.xml")
+	err := ioutil.WriteFile(
+		workloadPath,
+		[]byte(`<?xml version="1.0"?>
+<profile name="sweep">
+  <group nthreads="$nthr">
+    <transaction iterations="1">
+      <flowop type="write" options="size=64k"/>
+    </transaction>
+  </group>
+</profile>`),
+		0644,
+	)
+	if err != nil {
+		t.Fatalf("Unable to write test workload: %s", err)
+	}
+
+	usb := UperfSweepBenchmark{
+		Benchmark: UperfBenchmark{
+			WorkloadPath: workloadPath,
+			// Stand in for uperf, printing nothing
+			Cmd: []string{"true"},
+		},
+		Sweep: SweepSpec{{Name: "nthr", Values: []string{"1", "4"}}},
+	}
+	exporter := &sweepTestExporter{}
+	cfg := &define.Config{RunID: "abc-123"}
+	if err := usb.Setup(cfg); err != nil {
+		t.Fatalf("Unexpected error during setup: %s", err)
+	}
+	if err := usb.Run(exporter); err != nil {
+		t.Fatalf("Unexpected error during run: %s", err)
+	}
+	if _, ok := os.LookupEnv("nthr"); ok {
+		t.Error("Expected sweep parameter to not be set within the environment")
+	}
+
+	var runInfos []UperfRunInfoPayload
+	var summary SweepSummary
+	for _, payload := range exporter.exported {
+		var document map[string]interface{}
+		json.Unmarshal(payload, &document)
+		switch document["SectionType"] {
+		case string(StatSectionSweepSummary):
+			json.Unmarshal(payload, &summary)
+		case nil:
+			var runInfo UperfRunInfoPayload
+			json.Unmarshal(payload, &runInfo)
+			runInfos = append(runInfos, runInfo)
+		}
+	}
+
+	if len(runInfos) != 2 {
+		t.Fatalf("Expected a run info document for each combination, instead got %d", len(runInfos))
+	}
+	for i, nthr := range []int{1, 4} {
+		runInfo := runInfos[i]
+		if runInfo.Profile.Groups[0].NThreads != nthr {
+			t.Errorf("Expected combination %d to run with %d threads, instead got %d", i, nthr, runInfo.Profile.Groups[0].NThreads)
+		}
+		if runInfo.Vars["nthr"] != fmt.Sprint(nthr) {
+			t.Errorf("Expected combination %d to record its resolved vars, instead got %v", i, runInfo.Vars)
+		}
+		if runInfo.Metadata.Tags["nthr"] != fmt.Sprint(nthr) || runInfo.Metadata.Tags[SweepIndexTag] != fmt.Sprint(i) {
+			t.Errorf("Expected combination %d to be tagged with its parameters, instead got %v", i, runInfo.Metadata.Tags)
+		}
+	}
+
+	if len(summary.Combinations) != 2 || !summary.Combinations[1].Success {
+		t.Errorf("Expected a summary of both successful combinations, instead got %+v", summary)
+	}
+	if summary.Combinations[0].EndTime.Before(summary.Combinations[0].StartTime) ||
+		summary.Combinations[0].StartTime.Before(time.Unix(1, 0)) {
+		t.Errorf("Expected combination times to be recorded, instead got %+v", summary.Combinations[0])
+	}
+}
+
+// TestUperfSweepBenchmarkSetupUnreferencedParameter checks that sweep
+// parameters which aren't referenced by the workload, and aren't preset
+// options when a preset is used, are rejected during setup.
+func TestUperfSweepBenchmarkSetupUnreferencedParameter(t *testing.T) {
+	workloadPath := filepath.Join(t.TempDir(), "workload.xml")
+	err := ioutil.WriteFile(
+		workloadPath,
+		[]byte(`<?xml version="1.0"?>
+<profile name="sweep">
+  <group nthreads="$nthr">
+    <transaction iterations="1">
+      <flowop type="write" options="size=${size:-64k}"/>
+    </transaction>
+  </group>
+</profile>`),
+		0644,
+	)
+	if err != nil {
+		t.Fatalf("Unable to write test workload: %s", err)
+	}
+	preset := &PresetOptions{
+		Preset: PresetStream, Protocol: "tcp", NThreads: 1, Size: "64k",
+		Duration: time.Second, Remote: "localhost",
+	}
+
+	cases := []struct {
+		bench UperfBenchmark
+		sweep []string
+		valid bool
+	}{
+		{UperfBenchmark{WorkloadPath: workloadPath}, []string{"nthr=1,4", "size=1k"}, true},
+		{UperfBenchmark{WorkloadPath: workloadPath}, []string{"nthrds=1,4"}, false},
+		{UperfBenchmark{WorkloadPath: workloadPath}, []string{"proto=tcp,udp"}, false},
+		{UperfBenchmark{Preset: preset}, []string{"proto=tcp,udp", "nthr=1,4"}, true},
+		{UperfBenchmark{Preset: preset}, []string{"nthrds=1,4"}, false},
+	}
+	for _, c := range cases {
+		sweep, err := ParseSweepSpec(c.sweep)
+		if err != nil {
+			t.Fatalf("Unable to parse sweep %v: %s", c.sweep, err)
+		}
+		usb := UperfSweepBenchmark{Benchmark: c.bench, Sweep: sweep}
+		err = usb.Setup(&define.Config{})
+		if c.valid && err != nil {
+			t.Errorf("Expected sweep %v to be valid, instead got: %s", c.sweep, err)
+		}
+		if !c.valid && (err == nil || !strings.Contains(err.Error(), "not referenced")) {
+			t.Errorf("Expected sweep %v to be rejected as unreferenced, instead got: %v", c.sweep, err)
+		}
+	}
+}
@@ -5,68 +5,254 @@ package uperf
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/learnitall/gobench/artifacts"
 	"github.com/learnitall/gobench/define"
 	"github.com/rs/zerolog/log"
 )
 
 // UperfRunInfoPayload holds information to help describe the run of a uperf benchmark.
+// StdoutRaw and StderrRaw hold everything uperf printed.
+// StartTime and EndTime are marshalled in RFC3339 format with nanoseconds, and
+// StartTimeMS and EndTimeMS hold the same times as milliseconds since the unix epoch.
+// Workload holds the workload xml file uperf executed, after variables were
+// substituted, and WorkloadSHA256 holds its hex-encoded SHA-256 checksum.
+// WorkloadPath holds the path of the workload file it was read from, unless
+// it was built from a preset, in which case Preset holds the options used to
+// generate it. Vars holds the value substituted for each variable referenced
+// within the workload. SkippedLines holds the number of lines of stdout
+// which couldn't be parsed, when TolerantParsing is enabled.
 type UperfRunInfoPayload struct {
-	StdoutRaw string
-	Profile   *Profile
-	Cmd       []string
-	Metadata  *define.Metadata
-	StartTime int64
-	EndTime   int64
+	StdoutRaw      string
+	StderrRaw      string
+	SkippedLines   int
+	Profile        *Profile
+	Workload       string
+	WorkloadSHA256 string
+	WorkloadPath   string            `json:",omitempty"`
+	Preset         *PresetOptions    `json:",omitempty"`
+	Vars           map[string]string `json:",omitempty"`
+	Cmd            []string
+	Metadata       *define.Metadata
+	StartTime      time.Time
+	EndTime        time.Time
+	StartTimeMS    int64
+	EndTimeMS      int64
 }
 
 // UperfBenchmark helps facilitate running Uperf.
 // It implements the define.Benchmarkable interface.
+// If Serve is true, then a local uperf server is started during Setup and
+// stopped during Teardown, listening on ServerPort and optionally running
+// within the network namespace ServerNetns. Its output is written to
+// ServerLogPath, which defaults to `uperf-server.log` within ArtifactsDir, or
+// `uperf-server-<run id>.log` if there is no artifacts directory.
+// The executed workload and everything uperf prints are saved within
+// ArtifactsDir, which defaults to the Config's ArtifactsDir. Nothing is saved
+// if neither is set.
+// Uperf is killed if it runs for longer than Timeout, which defaults to the
+// Config's Timeout. Zero means no limit.
+// Vars holds values for variables referenced within the workload, which take
+// precedence over the environment. See SubstituteWorkloadVars.
+// If TolerantParsing is true, then lines of uperf's stdout which can't be
+// parsed are skipped rather than failing the run. See UperfStdoutParser.
 type UperfBenchmark struct {
-	WorkloadPath string
-	WorkloadRaw  string
-	Profile      Profile
-	Cmd          []string
-	Metadata     define.Metadata
+	WorkloadPath         string
+	WorkloadRaw          string
+	Preset               *PresetOptions
+	Vars                 map[string]string
+	TolerantParsing      bool
+	resolvedVars         map[string]string
+	workloadSHA256       string
+	Profile              Profile
+	Args                 []string
+	Cmd                  []string
+	Metadata             define.Metadata
+	Serve                bool
+	ServerPort           int
+	ServerNetns          string
+	ServerLogPath        string
+	ArtifactsDir         string
+	Timeout              time.Duration
+	executedWorkloadPath string
+	server               *exec.Cmd
+	serverLog            *os.File
+	serverExited         chan error
 }
 
-// Setup runs setup tasks for the UperfBenchmark.
-// Assumes that the following fields are already set:
-// - WorkloadPath
-// - Cmd
-func (u *UperfBenchmark) Setup(cfg *define.Config) error {
-	workloadBytes, err := ioutil.ReadFile(u.WorkloadPath)
+// renderPresetWorkload generates a workload xml file from the UperfBenchmark's Preset.
+func (u *UperfBenchmark) renderPresetWorkload() ([]byte, error) {
+	profile, err := BuildPresetProfile(*u.Preset)
 	if err != nil {
-		return fmt.Errorf(
-			"unable to read workload file at %s: %s",
-			u.WorkloadPath, err,
-		)
+		return nil, err
 	}
+	rendered, err := RenderWorkloadXML(profile)
+	if err != nil {
+		return nil, err
+	}
+	log.Info().
+		Str("preset", u.Preset.Preset).
+		Msg("Generated uperf workload from preset.")
+	return rendered, nil
+}
 
-	workloadParsedBytes, err := PerformEnvSubst(workloadBytes)
+// writeExecutedWorkload writes the given workload to a temporary file, which
+// is the workload uperf is given to execute.
+// The file is removed during Teardown.
+func (u *UperfBenchmark) writeExecutedWorkload(workload []byte) error {
+	workloadFile, err := ioutil.TempFile("", "gobench-uperf-*.xml")
 	if err != nil {
+		return fmt.Errorf("unable to create file for executed workload: %s", err)
+	}
+	defer workloadFile.Close()
+	u.executedWorkloadPath = workloadFile.Name()
+	if _, err := workloadFile.Write(workload); err != nil {
 		return fmt.Errorf(
-			"unable to parse environment variables in workload file at %s: %s",
-			u.WorkloadPath, err,
+			"unable to write executed workload to %s: %s", workloadFile.Name(), err,
 		)
 	}
+	return nil
+}
+
+// loadWorkload reads the workload from Preset, WorkloadPath or WorkloadRaw,
+// in that order of precedence, substitutes its variables and checks it with
+// ValidateWorkloadXML before parsing it into Profile.
+// WorkloadRaw is replaced with the substituted workload. A workload given in
+// WorkloadRaw is assumed to have been substituted already, such as one saved
+// in a run info document, so Vars are recorded but not substituted again.
+func (u *UperfBenchmark) loadWorkload() error {
+	var (
+		workloadBytes       []byte
+		workloadParsedBytes []byte
+		resolvedVars        map[string]string
+		workloadSource      string
+		err                 error
+	)
+	if u.Preset != nil {
+		workloadSource = fmt.Sprintf("preset %s", u.Preset.Preset)
+		workloadBytes, err = u.renderPresetWorkload()
+		if err != nil {
+			return err
+		}
+	} else if len(u.WorkloadPath) > 0 {
+		workloadSource = fmt.Sprintf("workload file at %s", u.WorkloadPath)
+		workloadBytes, err = ioutil.ReadFile(u.WorkloadPath)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %s", workloadSource, err)
+		}
+	} else {
+		workloadSource = "saved workload"
+		workloadParsedBytes = []byte(u.WorkloadRaw)
+		resolvedVars = u.Vars
+	}
+
+	if workloadBytes != nil {
+		workloadParsedBytes, resolvedVars, err = SubstituteWorkloadVars(workloadBytes, u.Vars)
+		if err != nil {
+			return fmt.Errorf(
+				"unable to substitute variables in %s: %s",
+				workloadSource, err,
+			)
+		}
+	}
+
+	if err := ValidateWorkloadXML(workloadParsedBytes); err != nil {
+		return fmt.Errorf("%s is invalid: %s", workloadSource, err)
+	}
 
 	profile, err := ParseWorkloadXML(workloadParsedBytes)
 	if err != nil {
-		return fmt.Errorf(
-			"unable to parse workload file at %s: %s",
-			u.WorkloadPath, err,
-		)
+		return fmt.Errorf("unable to parse %s: %s", workloadSource, err)
 	}
 
 	u.WorkloadRaw = string(workloadParsedBytes)
+	u.workloadSHA256 = fmt.Sprintf("%x", sha256.Sum256(workloadParsedBytes))
+	u.resolvedVars = resolvedVars
 	u.Profile = *profile
+	return nil
+}
+
+// workloadProfile returns the Profile parsed from the workload, or nil if no
+// workload was loaded.
+func (u *UperfBenchmark) workloadProfile() *Profile {
+	if len(u.WorkloadRaw) == 0 {
+		return nil
+	}
+	return &u.Profile
+}
+
+// Names of the files UperfBenchmark saves within its artifacts directory.
+const (
+	ArtifactWorkload  string = "workload.xml"
+	ArtifactStdout    string = "stdout.txt"
+	ArtifactStderr    string = "stderr.txt"
+	ArtifactServerLog string = "uperf-server.log"
+)
+
+// saveArtifact writes the given contents to the file with the given name
+// within ArtifactsDir, if it is set. Artifacts are only kept to help debug the
+// run, so failing to save one is logged rather than failing the run.
+func (u *UperfBenchmark) saveArtifact(name string, contents string) {
+	if len(u.ArtifactsDir) == 0 {
+		return
+	}
+	if err := artifacts.Write(u.ArtifactsDir, name, []byte(contents)); err != nil {
+		log.Warn().
+			Err(err).
+			Str("artifact", name).
+			Msg("Unable to save uperf artifact.")
+	}
+}
+
+// Setup runs setup tasks for the UperfBenchmark.
+// Assumes that either WorkloadPath or Preset is already set.
+// The workload is loaded with loadWorkload, then written to a temporary
+// file, so the workload uperf executes is exactly the one parsed.
+// If Cmd is not set, then it is built from this file and Args, as
+// `uperf -m <executed workload> <Args>`.
+func (u *UperfBenchmark) Setup(cfg *define.Config) error {
+	if err := u.loadWorkload(); err != nil {
+		return err
+	}
+
+	if err := u.writeExecutedWorkload([]byte(u.WorkloadRaw)); err != nil {
+		return err
+	}
+	if len(u.Cmd) == 0 {
+		u.Cmd = append([]string{"uperf", "-m", u.executedWorkloadPath}, u.Args...)
+	}
+
 	u.Metadata = define.GetMetadataPayload(cfg)
+	u.Metadata.Benchmark = "uperf"
+
+	if len(u.ArtifactsDir) == 0 {
+		u.ArtifactsDir = cfg.ArtifactsDir
+	}
+	if u.Timeout == 0 {
+		u.Timeout = cfg.Timeout
+	}
+	u.saveArtifact(ArtifactWorkload, u.WorkloadRaw)
+
+	if u.Serve {
+		if len(u.ServerLogPath) == 0 && len(u.ArtifactsDir) > 0 {
+			u.ServerLogPath = filepath.Join(u.ArtifactsDir, ArtifactServerLog)
+		} else if len(u.ServerLogPath) == 0 {
+			u.ServerLogPath = fmt.Sprintf("uperf-server-%s.log", cfg.RunID)
+		}
+		if err := u.startServer(); err != nil {
+			return err
+		}
+	}
 
 	log.Info().
 		Msg("Successfully initiated the uperf benchmark.")
@@ -74,100 +260,278 @@ func (u *UperfBenchmark) Setup(cfg *define.Config) error {
 	return nil
 }
 
+// exportDocument sets the metadata of the given document, then marshals and
+// exports it.
+func (u *UperfBenchmark) exportDocument(exporter define.Exporterable, document define.Document) error {
+	log.Debug().
+		Interface("stat", document).
+		Msg("Looking at uperf stdout stat.")
+
+	document.SetMetadata(&u.Metadata)
+
+	marshalled, err := exporter.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("unable to marshal uperf stdout stat: %s", err)
+	}
+	log.Debug().
+		Bytes("marshalled_stat", marshalled).
+		Msg("Marshalling successful, exporting.")
+
+	if err := exporter.Export(marshalled); err != nil {
+		return fmt.Errorf("unexpected error while exporting marshalled payload: %s", err)
+	}
+	log.Debug().
+		Bytes("marshalled_stat", marshalled).
+		Msg("Successfully sent payload to exporter.")
+	return nil
+}
+
+// exportFailure exports an UperfFailure describing why the run failed,
+// returning an error which includes the kind of failure.
+// If the given kind is empty, then it is classified from uperf's output using
+// ClassifyUperfFailure.
+func (u *UperfBenchmark) exportFailure(
+	exporter define.Exporterable, kind UperfFailureKind, runErr error,
+	exitCode int, stdout string, stderr string, start time.Time, end time.Time,
+) error {
+	message := ""
+	if len(kind) == 0 {
+		kind, message = ClassifyUperfFailure(stdout, stderr)
+	}
+	stdout = strings.ReplaceAll(stdout, "\r", "\n")
+
+	log.Error().
+		Err(runErr).
+		Str("kind", string(kind)).
+		Str("message", message).
+		Str("stdout", stdout).
+		Str("stderr", stderr).
+		Msg("Uperf run failed.")
+
+	failure := &UperfFailure{
+		SectionType: StatSectionFailure,
+		Kind:        kind,
+		Message:     message,
+		Error:       runErr.Error(),
+		ExitCode:    exitCode,
+		Cmd:         u.Cmd,
+		StdoutTail:  tailLines(stdout, failureTailLines),
+		StderrTail:  tailLines(stderr, failureTailLines),
+		StartTime:   start,
+		EndTime:     end,
+		StartTimeMS: start.UnixMilli(),
+		EndTimeMS:   end.UnixMilli(),
+	}
+	if err := u.exportDocument(exporter, failure); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Unable to export uperf failure.")
+	}
+
+	if len(message) > 0 {
+		return fmt.Errorf("uperf failed (%s: %s): %s", kind, message, runErr)
+	}
+	return fmt.Errorf("uperf failed (%s): %s", kind, runErr)
+}
+
 // Run facilitates running, parsing and exporting data from the uperf benchmark.
 // Assumes Setup has already been called prior.
+// Uperf's stdout is parsed as it is printed, and each document is exported as
+// soon as it is parsed, so results show up while uperf is still running. Stats
+// which need the whole run, such as latency stats and the run info, are
+// exported once uperf exits.
+// If a document fails to export, then the rest are still parsed but not
+// exported, and the error is returned once uperf exits.
+// Uperf's stderr is captured separately. If uperf can't be started, exits
+// with an error or prints stdout which can't be parsed, then an UperfFailure
+// is exported describing why, and an error is returned. The same goes for
+// uperf being killed once Timeout has passed.
 func (u *UperfBenchmark) Run(exporter define.Exporterable) error {
 	log.Info().
 		Str("cmd", strings.Join(u.Cmd, " ")).
-		Str("workload_path", u.WorkloadPath).
+		Str("workload_path", u.executedWorkloadPath).
+		Dur("timeout", u.Timeout).
 		Msg("Running Uperf")
 
-	cmd := exec.Command(u.Cmd[0], u.Cmd[1:]...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
+	ctx := context.Background()
+	if u.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, u.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, u.Cmd[0], u.Cmd[1:]...)
+	stdoutPipe, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("unable to open uperf stdout: %s", err)
+	}
+	var out, errOut bytes.Buffer
+	stdoutReader := io.TeeReader(stdoutPipe, &out)
+	cmd.Stderr = &errOut
+
+	start := time.Now().UTC()
+	if err := cmd.Start(); err != nil {
+		return u.exportFailure(
+			exporter, FailureStart, err, -1, "", "", start, time.Now().UTC(),
+		)
+	}
 
-	start := time.Now().Unix()
-	err := cmd.Run()
-	end := time.Now().Unix()
+	payloadResults, skippedLines, parseErr, exportErr := u.parseAndExport(
+		exporter, stdoutReader, start,
+	)
+	err = cmd.Wait()
+	end := time.Now().UTC()
 	stdout := out.String()
+	stderr := errOut.String()
+	u.saveArtifact(ArtifactStdout, stdout)
+	u.saveArtifact(ArtifactStderr, stderr)
 
-	if err != nil {
-		log.Fatal().
-			Str("stdout", stdout).
-			Err(err).
-			Msg("Error occurred while running uperf.")
-		return err
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return u.exportFailure(
+			exporter, FailureDeadline,
+			fmt.Errorf("stopped after running for longer than %s: %s", u.Timeout, err),
+			cmd.ProcessState.ExitCode(), stdout, stderr, start, end,
+		)
+	} else if err != nil {
+		return u.exportFailure(
+			exporter, "", err, cmd.ProcessState.ExitCode(), stdout, stderr, start, end,
+		)
 	}
 
 	log.Info().
 		Msg("Uperf successfully finished, preparing results.")
 	log.Debug().
-		Int64("start_time", start).
-		Int64("end_time", end).
+		Time("start_time", start).
+		Time("end_time", end).
 		Str("stdout", stdout).
-		Msg("Received the following stdout.")
+		Str("stderr", stderr).
+		Msg("Received the following stdout and stderr.")
 
-	// Replace \r with \n so regardless of which one we get we can parse
-	stdout = strings.ReplaceAll(stdout, "\r", "\n")
+	if parseErr != nil {
+		return u.exportFailure(
+			exporter, FailureParse, parseErr, 0, stdout, stderr, start, end,
+		)
+	}
+	if exportErr != nil {
+		return exportErr
+	}
 
-	payloadResults, err := ParseUperfStdout(stdout)
-	if err != nil {
-		log.Fatal().
-			Str("stdout", stdout).
-			Err(err).
-			Msg("Received error while parsing uperf stdout.")
-		return err
+	return u.exportSummary(
+		exporter, payloadResults, skippedLines, stdout, stderr, start, end,
+	)
+}
+
+// parseAndExport parses uperf's stdout from the given reader, exporting each
+// document as soon as it is parsed. The given start time is the time uperf
+// was started at, see ParserOptions.
+// The reader is always read to the end, even if parsing stops early.
+// If a document fails to export, then the rest are still parsed but not
+// exported. Every document parsed is returned, along with the number of lines
+// skipped in tolerant mode, the error from parsing and the error from exporting.
+func (u *UperfBenchmark) parseAndExport(
+	exporter define.Exporterable, reader io.Reader, start time.Time,
+) (*UperfStdout, int, error, error) {
+	parser := &UperfStdoutParser{
+		Options: ParserOptions{
+			StartTime: start,
+			Tolerant:  u.TolerantParsing,
+			Profile:   u.workloadProfile(),
+		},
 	}
+	documents := make(chan define.Document)
+	parseErrs := make(chan error, 1)
+	go func() {
+		err := parser.Parse(reader, documents)
+		// Keep reading if parsing stopped early, so uperf doesn't block
+		// on a full pipe
+		io.Copy(ioutil.Discard, reader)
+		parseErrs <- err
+	}()
 
-	runInfoPayload := &UperfRunInfoPayload{
-		StdoutRaw: stdout,
-		Profile:   &u.Profile,
-		Cmd:       u.Cmd,
-		Metadata:  &u.Metadata,
-		StartTime: start,
-		EndTime:   end,
+	payloadResults := &UperfStdout{}
+	var exportErr error
+	for document := range documents {
+		*payloadResults = append(*payloadResults, document)
+		if exportErr != nil {
+			continue
+		}
+		exportErr = u.exportDocument(exporter, document)
+		if exportErr != nil {
+			log.Error().
+				Err(exportErr).
+				Msg("Unable to export uperf stdout stat, no more stats will be exported.")
+		}
 	}
-	*payloadResults = append(*payloadResults, runInfoPayload)
+	parseErr := <-parseErrs
 
-	log.Info().
-		Msg("Parsed stdout and prepared payload documents, marshalling.")
+	if parser.SkippedLines > 0 {
+		log.Warn().
+			Int("skipped_lines", parser.SkippedLines).
+			Msg("Skipped lines of uperf stdout which could not be parsed.")
+	}
+	return payloadResults, parser.SkippedLines, parseErr, exportErr
+}
 
-	for _, payload := range *payloadResults {
-		log.Debug().
-			Interface("stat", payload).
-			Msg("Looking at uperf stdout stat.")
+// exportSummary exports the stats which need the whole run, being the latency
+// stats computed from the given results and the run info.
+func (u *UperfBenchmark) exportSummary(
+	exporter define.Exporterable, payloadResults *UperfStdout, skippedLines int,
+	stdout string, stderr string, start time.Time, end time.Time,
+) error {
+	// Replace \r with \n so progress lines are readable within the run info
+	stdout = strings.ReplaceAll(stdout, "\r", "\n")
 
-		addMetadataField(payload, u.Metadata)
+	finalResults := UperfStdout(ComputeLatencyStats(payloadResults, u.workloadProfile()))
+	finalResults = append(finalResults, &UperfRunInfoPayload{
+		StdoutRaw:      stdout,
+		StderrRaw:      stderr,
+		SkippedLines:   skippedLines,
+		Profile:        u.workloadProfile(),
+		Workload:       u.WorkloadRaw,
+		WorkloadSHA256: u.workloadSHA256,
+		WorkloadPath:   u.WorkloadPath,
+		Preset:         u.Preset,
+		Vars:           u.resolvedVars,
+		Cmd:            u.Cmd,
+		Metadata:       &u.Metadata,
+		StartTime:      start,
+		EndTime:        end,
+		StartTimeMS:    start.UnixMilli(),
+		EndTimeMS:      end.UnixMilli(),
+	})
 
-		marshalled, err := exporter.Marshal(payload)
-		if err != nil {
-			log.Fatal().
-				Err(err).
-				Msg("Unable to marshal uperf stdout stat.")
-			return err
-		}
-		log.Debug().
-			Bytes("marshalled_stat", marshalled).
-			Msg("Marshalling successful, exporting.")
+	log.Info().
+		Msg("Parsed stdout and exported stats, exporting run summary.")
 
-		err = exporter.Export(marshalled)
-		if err != nil {
-			log.Fatal().
+	for _, payload := range finalResults {
+		if err := u.exportDocument(exporter, payload); err != nil {
+			log.Error().
 				Err(err).
-				Msg("Unexpected error while exporting marshalled payload.")
+				Msg("Unable to export uperf run summary.")
 			return err
 		}
-		log.Debug().
-			Bytes("marshalled_stat", marshalled).
-			Msg("Successfully sent payload to exporter.")
 	}
 
 	return nil
 }
 
 // Teardown function for the uperf benchmark.
-// No specific tasks need to be run, so this just returns nil.
+// Stops the local uperf server, if one was started during Setup, and removes
+// the executed workload.
 func (u *UperfBenchmark) Teardown(*define.Config) error {
+	if err := u.stopServer(); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Unable to stop uperf server.")
+		return err
+	}
+	if len(u.executedWorkloadPath) > 0 {
+		if err := os.Remove(u.executedWorkloadPath); err != nil {
+			log.Warn().
+				Err(err).
+				Str("workload_path", u.executedWorkloadPath).
+				Msg("Unable to remove executed workload.")
+		}
+	}
 	log.Info().Msg("Uperf benchmark finished")
 	return nil
 }
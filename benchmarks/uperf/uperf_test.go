@@ -4,6 +4,13 @@
 package uperf
 
 import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/learnitall/gobench/define"
@@ -24,3 +31,122 @@ func TestUperfBenchmarkImplementsBenchmarkable(t *testing.T) {
 		)
 	}
 }
+
+// TestUperfBenchmarkExecutesSubstitutedWorkload checks that the workload
+// uperf is given during Run is the substituted workload parsed during Setup,
+// and that it is recorded in the run info with its checksum.
+func TestUperfBenchmarkExecutesSubstitutedWorkload(t *testing.T) {
+	workloadPath := filepath.Join(t.TempDir(), "workload.xml")
+	err := ioutil.WriteFile(
+		workloadPath,
+		[]byte(`<?xml version="1.0"?>
+<profile name="executed">
+  <group nthreads="${nthr:-1}">
+    <transaction iterations="1">
+      <flowop type="write" options="size=64k"/>
+    </transaction>
+  </group>
+</profile>`),
+		0644,
+	)
+	if err != nil {
+		t.Fatalf("Unable to write test workload: %s", err)
+	}
+
+	bench := &UperfBenchmark{
+		WorkloadPath: workloadPath,
+		Vars:         map[string]string{"nthr": "3"},
+		Args:         []string{"-R"},
+	}
+	if err := bench.Setup(&define.Config{RunID: "abc-123"}); err != nil {
+		t.Fatalf("Unexpected error during setup: %s", err)
+	}
+
+	if len(bench.Cmd) != 4 || bench.Cmd[0] != "uperf" || bench.Cmd[1] != "-m" || bench.Cmd[3] != "-R" {
+		t.Fatalf("Expected cmd 'uperf -m <workload> -R', instead got %v", bench.Cmd)
+	}
+	executedPath := bench.Cmd[2]
+	if executedPath == workloadPath {
+		t.Errorf("Expected uperf to be given the substituted workload, instead got the original")
+	}
+	executed, err := ioutil.ReadFile(executedPath)
+	if err != nil {
+		t.Fatalf("Unable to read executed workload: %s", err)
+	}
+	if string(executed) != bench.WorkloadRaw || !strings.Contains(bench.WorkloadRaw, `nthreads="3"`) {
+		t.Errorf("Expected executed workload to match parsed workload, instead got:\n%s", executed)
+	}
+
+	// Stand in for uperf, printing nothing
+	bench.Cmd = []string{"true"}
+	exporter := &sweepTestExporter{}
+	if err := bench.Run(exporter); err != nil {
+		t.Fatalf("Unexpected error during run: %s", err)
+	}
+	var runInfo UperfRunInfoPayload
+	json.Unmarshal(exporter.exported[len(exporter.exported)-1], &runInfo)
+	expectedSHA256 := fmt.Sprintf("%x", sha256.Sum256(executed))
+	if runInfo.Workload != string(executed) || runInfo.WorkloadSHA256 != expectedSHA256 {
+		t.Errorf(
+			"Expected run info to hold executed workload with checksum %s, instead got %s",
+			expectedSHA256, runInfo.WorkloadSHA256,
+		)
+	}
+
+	if err := bench.Teardown(nil); err != nil {
+		t.Fatalf("Unexpected error during teardown: %s", err)
+	}
+	if _, err := os.Stat(executedPath); !os.IsNotExist(err) {
+		t.Errorf("Expected executed workload to be removed during teardown, instead got %v", err)
+	}
+}
+
+// streamTestExporter calls onExport with each payload given to it.
+type streamTestExporter struct {
+	sweepTestExporter
+	onExport func(payload []byte)
+}
+
+func (ste *streamTestExporter) Export(payload []byte) error {
+	ste.onExport(payload)
+	return ste.sweepTestExporter.Export(payload)
+}
+
+// TestUperfBenchmarkRunExportsWhileRunning checks that stats are exported
+// as soon as uperf prints them, before uperf exits.
+func TestUperfBenchmarkRunExportsWhileRunning(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "exported")
+	// Stand in for uperf, which only finishes once the first stat is exported
+	script := fmt.Sprintf(`
+echo "Txn1            0 /   1.00(s) =            0           1op/s"
+for i in $(seq 100); do
+	if [ -f %s ]; then
+		echo "Total     67.14GB /  32.34(s) =    17.84Gb/s      272158op/s"
+		exit 0
+	fi
+	sleep 0.05
+done`, marker)
+
+	bench := &UperfBenchmark{Cmd: []string{"sh", "-c", script}}
+	exporter := &streamTestExporter{
+		onExport: func([]byte) {
+			ioutil.WriteFile(marker, []byte{}, 0644)
+		},
+	}
+	if err := bench.Run(exporter); err != nil {
+		t.Fatalf("Unexpected error during run: %s", err)
+	}
+
+	names := []string{}
+	for _, payload := range exporter.exported {
+		var stat DetailsStat
+		json.Unmarshal(payload, &stat)
+		if len(stat.Name) > 0 && stat.SectionType != StatSectionTxLatency {
+			names = append(names, fmt.Sprintf("%s/%s", stat.Name, stat.SectionType))
+		}
+	}
+	expected := []string{"Txn1/interval", "Txn1/tx", "Total/tx"}
+	if strings.Join(names, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected stats %v to be exported while uperf ran, instead got %v", expected, names)
+	}
+}
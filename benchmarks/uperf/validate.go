@@ -0,0 +1,464 @@
+//go:build uperf
+// +build uperf
+
+// validate.go defines functionality for checking that a uperf workload xml
+// file uses uperf's vocabulary correctly, before handing it to uperf.
+// References:
+// - http://uperf.org/manual.html
+package uperf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationError describes a single problem within a workload xml file.
+// Line is the line within the file of the element the problem was found in.
+type ValidationError struct {
+	Line    int
+	Element string
+	Message string
+}
+
+func (ve ValidationError) Error() string {
+	if len(ve.Element) == 0 {
+		return fmt.Sprintf("line %d: %s", ve.Line, ve.Message)
+	}
+	return fmt.Sprintf("line %d: <%s>: %s", ve.Line, ve.Element, ve.Message)
+}
+
+// ValidationErrors lists each problem found within a workload xml file, in
+// the order they appear.
+type ValidationErrors []ValidationError
+
+func (ves ValidationErrors) Error() string {
+	messages := []string{}
+	for _, ve := range ves {
+		messages = append(messages, ve.Error())
+	}
+	return fmt.Sprintf(
+		"%d problem(s) found in workload: %s", len(ves), strings.Join(messages, "; "),
+	)
+}
+
+// optionKind describes the values an option of a flowop accepts.
+type optionKind int
+
+const (
+	// optionFlag options are given without a value, ie `tcp_nodelay`.
+	optionFlag optionKind = iota
+	// optionString options accept any non-empty value.
+	optionString
+	// optionSize options accept a number of bytes, with an optional k, m or g suffix.
+	optionSize
+	// optionCount options accept a positive integer.
+	optionCount
+	// optionDuration options accept a positive duration, ie `100ms`.
+	optionDuration
+	// optionProtocol options accept one of uperf's supported protocols.
+	optionProtocol
+	// optionPort options accept a port number.
+	optionPort
+)
+
+// flowOpSpec describes the options a type of flowop accepts, and which of
+// them are required.
+type flowOpSpec struct {
+	options  map[string]optionKind
+	required []string
+}
+
+// UperfProtocols lists each protocol which can be given to a connect or accept flowop.
+var UperfProtocols []string = []string{"tcp", "udp", "sctp", "ssl", "vsock", "rds"}
+
+// commonFlowOpOptions are accepted by every type of flowop.
+var commonFlowOpOptions map[string]optionKind = map[string]optionKind{
+	"count": optionCount,
+}
+
+var connectionFlowOpSpec flowOpSpec = flowOpSpec{
+	options: map[string]optionKind{
+		"remotehost":  optionString,
+		"protocol":    optionProtocol,
+		"port":        optionPort,
+		"wndsz":       optionSize,
+		"tcp_nodelay": optionFlag,
+		"encryption":  optionString,
+		"engine":      optionString,
+	},
+	required: []string{"remotehost"},
+}
+
+var transferFlowOpSpec flowOpSpec = flowOpSpec{
+	options: map[string]optionKind{
+		"size":         optionSize,
+		"rsize":        optionSize,
+		"canfail":      optionFlag,
+		"non_blocking": optionFlag,
+		"poll_timeout": optionDuration,
+	},
+	required: []string{"size"},
+}
+
+var sendFileFlowOpSpec flowOpSpec = flowOpSpec{
+	options: map[string]optionKind{
+		"dir":    optionString,
+		"size":   optionSize,
+		"nfiles": optionCount,
+	},
+	required: []string{"dir"},
+}
+
+// flowOpSpecs maps each type of flowop uperf understands to the options it accepts.
+var flowOpSpecs map[string]flowOpSpec = map[string]flowOpSpec{
+	"connect":    connectionFlowOpSpec,
+	"accept":     connectionFlowOpSpec,
+	"disconnect": {},
+	"read":       transferFlowOpSpec,
+	"write":      transferFlowOpSpec,
+	"recv":       transferFlowOpSpec,
+	"send":       transferFlowOpSpec,
+	"sendto":     transferFlowOpSpec,
+	"recvfrom":   transferFlowOpSpec,
+	"sendfile":   sendFileFlowOpSpec,
+	"sendfilev":  sendFileFlowOpSpec,
+	"think": {
+		options: map[string]optionKind{
+			"duration": optionDuration,
+			"idle":     optionFlag,
+			"busy":     optionFlag,
+		},
+		required: []string{"duration"},
+	},
+	"nop":  {},
+	"redo": {},
+}
+
+// sizeValue matches values accepted by optionSize options.
+var sizeValue *regexp.Regexp = regexp.MustCompile(`^[0-9]+[kKmMgG]?$`)
+
+// FlowOpTypes returns each type of flowop the validator accepts, sorted.
+func FlowOpTypes() []string {
+	types := []string{}
+	for flowOpType := range flowOpSpecs {
+		types = append(types, flowOpType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// validateOptionValue checks that the given value is accepted by the given kind of option.
+func validateOptionValue(kind optionKind, value string) error {
+	switch kind {
+	case optionSize:
+		if !sizeValue.MatchString(value) {
+			return fmt.Errorf("expected a size such as 64 or 16k, got '%s'", value)
+		}
+	case optionCount:
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 1 {
+			return fmt.Errorf("expected a positive integer, got '%s'", value)
+		}
+	case optionDuration:
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("expected a positive duration such as 100ms, got '%s'", value)
+		}
+	case optionProtocol:
+		for _, protocol := range UperfProtocols {
+			if value == protocol {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %v, got '%s'", UperfProtocols, value)
+	case optionPort:
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("expected a port between 1 and 65535, got '%s'", value)
+		}
+	}
+	return nil
+}
+
+// validateFlowOp checks a flowop's type and its options string, returning a
+// message describing each problem found.
+func validateFlowOp(flowOpType string, options string) []string {
+	spec, ok := flowOpSpecs[flowOpType]
+	if !ok {
+		return []string{fmt.Sprintf(
+			"unknown flowop type '%s', expected one of %v", flowOpType, FlowOpTypes(),
+		)}
+	}
+
+	problems := []string{}
+	given := map[string]bool{}
+	for _, token := range strings.Fields(options) {
+		name, value, hasValue := token, "", false
+		if index := strings.Index(token, "="); index >= 0 {
+			name, value, hasValue = token[:index], token[index+1:], true
+		}
+
+		kind, ok := spec.options[name]
+		if !ok {
+			kind, ok = commonFlowOpOptions[name]
+		}
+		if !ok {
+			problems = append(problems, fmt.Sprintf(
+				"unknown option '%s' for flowop type '%s'", name, flowOpType,
+			))
+			continue
+		}
+		if given[name] {
+			problems = append(problems, fmt.Sprintf("option '%s' is given more than once", name))
+			continue
+		}
+		given[name] = true
+
+		switch {
+		case kind == optionFlag && hasValue:
+			problems = append(problems, fmt.Sprintf("option '%s' does not take a value", name))
+		case kind != optionFlag && (!hasValue || len(value) == 0):
+			problems = append(problems, fmt.Sprintf(
+				"option '%s' requires a value, ie %s=<value>", name, name,
+			))
+		case kind != optionFlag:
+			if err := validateOptionValue(kind, value); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid value for option '%s': %s", name, err))
+			}
+		}
+	}
+
+	for _, name := range spec.required {
+		if !given[name] {
+			problems = append(problems, fmt.Sprintf(
+				"flowop type '%s' requires the '%s' option", flowOpType, name,
+			))
+		}
+	}
+	return problems
+}
+
+// validationFrame tracks an element being validated, and how many of its
+// expected child elements have been seen.
+type validationFrame struct {
+	name     string
+	line     int
+	children int
+}
+
+// workloadValidator walks through the tokens of a workload xml file,
+// recording each problem found.
+type workloadValidator struct {
+	raw        []byte
+	lastOffset int64
+	lastLine   int
+	frames     []*validationFrame
+	errors     ValidationErrors
+}
+
+// lineAt returns the line containing the given byte offset.
+// Offsets must be given in increasing order.
+func (wv *workloadValidator) lineAt(offset int64) int {
+	wv.lastLine += bytes.Count(wv.raw[wv.lastOffset:offset], []byte("\n"))
+	wv.lastOffset = offset
+	return wv.lastLine
+}
+
+func (wv *workloadValidator) addError(line int, element string, format string, args ...interface{}) {
+	wv.errors = append(wv.errors, ValidationError{
+		Line:    line,
+		Element: element,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// attrs returns the attributes of the given element as a map, recording an
+// error for any attribute not within allowed.
+func (wv *workloadValidator) attrs(element xml.StartElement, line int, allowed ...string) map[string]string {
+	result := map[string]string{}
+	for _, attr := range element.Attr {
+		known := false
+		for _, name := range allowed {
+			if attr.Name.Local == name {
+				known = true
+			}
+		}
+		if !known {
+			wv.addError(
+				line, element.Name.Local, "unknown attribute '%s', expected one of %v",
+				attr.Name.Local, allowed,
+			)
+			continue
+		}
+		result[attr.Name.Local] = attr.Value
+	}
+	return result
+}
+
+// checkPositiveInt records an error if the given attribute isn't a positive integer.
+func (wv *workloadValidator) checkPositiveInt(line int, element string, attr string, value string) {
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		wv.addError(line, element, "%s must be a positive integer, got '%s'", attr, value)
+	}
+}
+
+// startElement validates the given element against its parent, returning
+// false if the element is unexpected and should be skipped.
+func (wv *workloadValidator) startElement(element xml.StartElement, line int) bool {
+	name := element.Name.Local
+	parent := ""
+	if len(wv.frames) > 0 {
+		parent = wv.frames[len(wv.frames)-1].name
+		wv.frames[len(wv.frames)-1].children++
+	}
+
+	expected := map[string]string{
+		"":            "profile",
+		"profile":     "group",
+		"group":       "transaction",
+		"transaction": "flowop",
+	}[parent]
+	if name != expected {
+		if len(expected) == 0 {
+			wv.addError(line, name, "unexpected element within <%s>", parent)
+		} else if len(parent) == 0 {
+			wv.addError(line, name, "expected the root element to be <profile>")
+		} else {
+			wv.addError(line, name, "unexpected element within <%s>, expected <%s>", parent, expected)
+		}
+		return false
+	}
+
+	switch name {
+	case "profile":
+		attrs := wv.attrs(element, line, "name")
+		if len(strings.TrimSpace(attrs["name"])) == 0 {
+			wv.addError(line, name, "a name attribute is required")
+		}
+	case "group":
+		attrs := wv.attrs(element, line, "nthreads", "nprocs")
+		nthreads, hasThreads := attrs["nthreads"]
+		nprocs, hasProcs := attrs["nprocs"]
+		switch {
+		case hasThreads && hasProcs:
+			wv.addError(line, name, "only one of nthreads or nprocs can be given")
+		case hasThreads:
+			wv.checkPositiveInt(line, name, "nthreads", nthreads)
+		case hasProcs:
+			wv.checkPositiveInt(line, name, "nprocs", nprocs)
+		default:
+			wv.addError(line, name, "one of nthreads or nprocs is required")
+		}
+	case "transaction":
+		attrs := wv.attrs(element, line, "iterations", "duration", "rate")
+		duration, hasDuration := attrs["duration"]
+		iterations, hasIterations := attrs["iterations"]
+		if hasDuration && hasIterations {
+			wv.addError(line, name, "only one of duration or iterations can be given")
+		}
+		if hasDuration {
+			if parsed, err := time.ParseDuration(duration); err != nil || parsed < time.Second {
+				wv.addError(line, name, "duration must be at least 1s, such as 30s, got '%s'", duration)
+			}
+		}
+		if hasIterations {
+			wv.checkPositiveInt(line, name, "iterations", iterations)
+		}
+		if rate, ok := attrs["rate"]; ok {
+			wv.checkPositiveInt(line, name, "rate", rate)
+		}
+	case "flowop":
+		attrs := wv.attrs(element, line, "type", "options")
+		flowOpType, ok := attrs["type"]
+		if !ok {
+			wv.addError(line, name, "a type attribute is required")
+			break
+		}
+		for _, problem := range validateFlowOp(flowOpType, attrs["options"]) {
+			wv.addError(line, name, "%s", problem)
+		}
+	}
+
+	wv.frames = append(wv.frames, &validationFrame{name: name, line: line})
+	return true
+}
+
+// endElement checks that the element which just closed has the children it needs.
+func (wv *workloadValidator) endElement() {
+	frame := wv.frames[len(wv.frames)-1]
+	wv.frames = wv.frames[:len(wv.frames)-1]
+
+	required := map[string]string{
+		"profile":     "group",
+		"group":       "transaction",
+		"transaction": "flowop",
+	}[frame.name]
+	if len(required) > 0 && frame.children == 0 {
+		wv.addError(frame.line, frame.name, "at least one <%s> is required", required)
+	}
+}
+
+// ValidateWorkloadXML checks that the given workload xml file only uses
+// elements, attributes, flowop types and flowop options which uperf
+// understands, and that each of their values is well-formed.
+// Environment variables should be substituted before validating, see
+// PerformEnvSubst.
+// If any problems are found, a ValidationErrors is returned listing each one
+// with the line it was found on.
+func ValidateWorkloadXML(workloadRawBytes []byte) error {
+	wv := &workloadValidator{raw: workloadRawBytes, lastLine: 1}
+	decoder := xml.NewDecoder(bytes.NewReader(workloadRawBytes))
+	sawRoot := false
+
+	for {
+		line := wv.lineAt(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				wv.addError(syntaxErr.Line, "", "invalid xml: %s", syntaxErr.Msg)
+			} else {
+				wv.addError(line, "", "invalid xml: %s", err)
+			}
+			return wv.errors
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if len(wv.frames) == 0 {
+				if sawRoot {
+					wv.addError(line, element.Name.Local, "only a single <profile> is allowed")
+				}
+				sawRoot = true
+			}
+			if !wv.startElement(element, line) {
+				if err := decoder.Skip(); err != nil {
+					wv.addError(line, element.Name.Local, "invalid xml: %s", err)
+					return wv.errors
+				}
+			}
+		case xml.EndElement:
+			wv.endElement()
+		}
+	}
+
+	if !sawRoot {
+		wv.addError(wv.lastLine, "", "no <profile> element found")
+	}
+	if len(wv.errors) > 0 {
+		return wv.errors
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+//go:build uperf_test
+// +build uperf_test
+
+package uperf
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var WORKLOAD_XML_INVALID string = `<?xml version="1.0"?>
+<profile name="invalid">
+  <group nthreads="two">
+    <transaction duration="30s" iterations="1">
+      <flowop type="connect" options="protocol=tcp"/>
+      <flowop type="write" options="size=64q count=0 tcp_nodelay"/>
+      <flowop type="teleport"/>
+    </transaction>
+    <transaction iterations="1">
+      <flowop type="think" options="duration idle=yes"/>
+    </transaction>
+    <transaction iterations="1"/>
+  </group>
+  <group nthreads="1" color="blue">
+    <transaction iterations="1">
+      <flowop type="read" options="size=1k size=2k"/>
+    </transaction>
+  </group>
+</profile>`
+
+// These need to be synced with the problems within WORKLOAD_XML_INVALID.
+var WORKLOAD_XML_INVALID_ERRORS []ValidationError = []ValidationError{
+	{Line: 3, Element: "group", Message: "nthreads must be a positive integer"},
+	{Line: 4, Element: "transaction", Message: "only one of duration or iterations"},
+	{Line: 5, Element: "flowop", Message: "requires the 'remotehost' option"},
+	{Line: 6, Element: "flowop", Message: "invalid value for option 'size'"},
+	{Line: 6, Element: "flowop", Message: "invalid value for option 'count'"},
+	{Line: 6, Element: "flowop", Message: "unknown option 'tcp_nodelay'"},
+	{Line: 7, Element: "flowop", Message: "unknown flowop type 'teleport'"},
+	{Line: 10, Element: "flowop", Message: "option 'duration' requires a value"},
+	{Line: 10, Element: "flowop", Message: "option 'idle' does not take a value"},
+	{Line: 12, Element: "transaction", Message: "at least one <flowop> is required"},
+	{Line: 14, Element: "group", Message: "unknown attribute 'color'"},
+	{Line: 16, Element: "flowop", Message: "option 'size' is given more than once"},
+}
+
+// TestValidateWorkloadXMLValid checks that the sample profiles given by uperf
+// pass validation once their environment variables are substituted.
+func TestValidateWorkloadXMLValid(t *testing.T) {
+	for key, value := range ENV_SUBST_VARS {
+		os.Setenv(key, value)
+	}
+	defer func() {
+		for key := range ENV_SUBST_VARS {
+			os.Unsetenv(key)
+		}
+	}()
+
+	for workload_xml := range WORKLOAD_XML_TO_JSON_TESTS {
+		env_workload_xml, err := PerformEnvSubst([]byte(workload_xml))
+		if err != nil {
+			t.Fatalf("Error while trying to perform env substitutions: %s", err)
+		}
+		if err := ValidateWorkloadXML(env_workload_xml); err != nil {
+			t.Errorf("Expected sample workload to be valid, instead got: %s", err)
+		}
+	}
+
+	for _, preset := range Presets {
+		profile, err := BuildPresetProfile(PresetOptions{
+			Preset: preset, Protocol: "udp", NThreads: 2, Size: "1k",
+			Duration: 30 * time.Second, Remote: "localhost",
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error building preset %s: %s", preset, err)
+		}
+		rendered, err := RenderWorkloadXML(profile)
+		if err != nil {
+			t.Fatalf("Unexpected error rendering preset %s: %s", preset, err)
+		}
+		if err := ValidateWorkloadXML(rendered); err != nil {
+			t.Errorf("Expected workload from preset %s to be valid, instead got: %s", preset, err)
+		}
+	}
+}
+
+// TestValidateWorkloadXMLInvalid checks that each problem within an invalid
+// workload is reported on the line it appears.
+func TestValidateWorkloadXMLInvalid(t *testing.T) {
+	err := ValidateWorkloadXML([]byte(WORKLOAD_XML_INVALID))
+	var problems ValidationErrors
+	if !errors.As(err, &problems) {
+		t.Fatalf("Expected ValidationErrors, instead got: %v", err)
+	}
+
+	if len(problems) != len(WORKLOAD_XML_INVALID_ERRORS) {
+		t.Errorf(
+			"Expected %d problems, instead got %d: %s",
+			len(WORKLOAD_XML_INVALID_ERRORS), len(problems), err,
+		)
+	}
+	for i, expected := range WORKLOAD_XML_INVALID_ERRORS {
+		if i >= len(problems) {
+			break
+		}
+		problem := problems[i]
+		if problem.Line != expected.Line || problem.Element != expected.Element ||
+			!strings.Contains(problem.Message, expected.Message) {
+			t.Errorf("Expected problem %+v, instead got %+v", expected, problem)
+		}
+	}
+}
+
+// TestValidateWorkloadXMLStructure checks that workloads with a broken
+// structure are rejected.
+func TestValidateWorkloadXMLStructure(t *testing.T) {
+	tests := map[string]string{
+		"empty profile":   `<profile name="empty"></profile>`,
+		"missing name":    `<profile><group nthreads="1"><transaction iterations="1"><flowop type="nop"/></transaction></group></profile>`,
+		"wrong root":      `<workload name="x"/>`,
+		"nested flowop":   `<profile name="x"><group nthreads="1"><flowop type="nop"/></group></profile>`,
+		"malformed xml":   `<profile name="x"><group nthreads="1">`,
+		"no root element": ``,
+	}
+	for description, workload := range tests {
+		if err := ValidateWorkloadXML([]byte(workload)); err == nil {
+			t.Errorf("Expected error validating workload with %s, instead got nil", description)
+		}
+	}
+}
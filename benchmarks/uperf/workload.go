@@ -11,16 +11,15 @@ import (
 	"encoding/xml"
 	"fmt"
 	"os"
-	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
 type profileXML struct {
-	Name   string     `xml:"name,attr"`
-	Groups []groupXML `xml:"group"`
+	XMLName xml.Name   `xml:"profile"`
+	Name    string     `xml:"name,attr"`
+	Groups  []groupXML `xml:"group"`
 }
 
 type groupXML struct {
@@ -29,14 +28,14 @@ type groupXML struct {
 }
 
 type transactionXML struct {
-	Duration   string      `xml:"duration,attr"`
-	Iterations string      `xml:"iterations,attr"`
+	Duration   string      `xml:"duration,attr,omitempty"`
+	Iterations string      `xml:"iterations,attr,omitempty"`
 	FlowOps    []flowOpXML `xml:"flowop"`
 }
 
 type flowOpXML struct {
 	Type    string `xml:"type,attr"`
-	Options string `xml:"options,attr"`
+	Options string `xml:"options,attr,omitempty"`
 }
 
 type Profile struct {
@@ -60,37 +59,173 @@ type FlowOp struct {
 	Options *string `json:",omitempty"`
 }
 
-// PerformEnvSubst finds environment variables defined in the workload xml
-// and tries to substitute them with their values within the environment.
-func PerformEnvSubst(workloadRawBytes []byte) ([]byte, error) {
-	workloadRawString := string(workloadRawBytes)
+// isVarNameChar returns true if the given byte can be used within the name of
+// a variable substituted into a workload.
+func isVarNameChar(c byte) bool {
+	return c == '_' ||
+		('a' <= c && c <= 'z') ||
+		('A' <= c && c <= 'Z') ||
+		('0' <= c && c <= '9')
+}
 
-	r := regexp.MustCompile(`\$[a-zA-Z0-9]+`)
-	matches := r.FindAllString(workloadRawString, -1)
-	if matches == nil {
-		return workloadRawBytes, nil
+// lookupWorkloadVar returns the value of the given variable, checking the
+// given vars before the environment.
+func lookupWorkloadVar(name string, vars map[string]string) (string, bool) {
+	if value, ok := vars[name]; ok {
+		return value, true
 	}
+	return os.LookupEnv(name)
+}
 
-	// Need to sort so longer matches get substituted first.
-	// This prevents values such as `$h2` getting turned into `${h}2`
-	sort.Slice(matches, func(i, j int) bool {
-		return len(matches[i]) > len(matches[j])
-	})
+// expandBracedVar resolves the body of a `${...}` reference, which is either
+// `NAME`, `NAME:-default` or `NAME:?message`, returning the variable's name
+// and the value to substitute.
+func expandBracedVar(body string, vars map[string]string) (string, string, error) {
+	nameEnd := 0
+	for nameEnd < len(body) && isVarNameChar(body[nameEnd]) {
+		nameEnd++
+	}
+	name, modifier := body[:nameEnd], body[nameEnd:]
+	if len(name) == 0 {
+		return "", "", fmt.Errorf("invalid variable reference '${%s}', missing a name", body)
+	}
 
-	for _, envVarInXML := range matches {
-		envVar := strings.TrimSpace(envVarInXML)
-		envVar = envVar[1:] // remove the first '$'
-		envVal, ok := os.LookupEnv(envVar)
+	value, ok := lookupWorkloadVar(name, vars)
+	switch {
+	case len(modifier) == 0:
 		if !ok {
-			return workloadRawBytes, fmt.Errorf(
-				"unable to find value for environment variable %s",
-				envVar,
+			return "", "", fmt.Errorf(
+				"unable to find value for environment variable %s", name,
 			)
 		}
-		workloadRawString = strings.ReplaceAll(workloadRawString, envVarInXML, envVal)
+		return name, value, nil
+	case strings.HasPrefix(modifier, ":-"):
+		if !ok || len(value) == 0 {
+			return name, modifier[2:], nil
+		}
+		return name, value, nil
+	case strings.HasPrefix(modifier, ":?"):
+		if !ok || len(value) == 0 {
+			message := modifier[2:]
+			if len(message) == 0 {
+				message = "parameter null or not set"
+			}
+			return "", "", fmt.Errorf("%s: %s", name, message)
+		}
+		return name, value, nil
+	}
+	return "", "", fmt.Errorf(
+		"invalid variable reference '${%s}', expected ${%s}, ${%s:-default} or ${%s:?message}",
+		body, name, name, name,
+	)
+}
+
+// SubstituteWorkloadVars replaces references to variables within the
+// workload xml with their values, taken from the given vars or, if a
+// variable isn't in vars, from the environment.
+// The following forms are supported:
+// - `$NAME` and `${NAME}` are replaced with the variable's value, failing if it is unset.
+// - `${NAME:-default}` uses default if the variable is unset or empty.
+// - `${NAME:?message}` fails with message if the variable is unset or empty.
+// - `$$` is replaced with a literal `$`.
+// Names may contain letters, numbers and underscores. A `$` not followed by
+// any of the above is left as-is.
+// The value used for each variable referenced is returned alongside the result.
+func SubstituteWorkloadVars(
+	workloadRawBytes []byte, vars map[string]string,
+) ([]byte, map[string]string, error) {
+	var result strings.Builder
+	resolved := map[string]string{}
+	raw := string(workloadRawBytes)
+
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '$' || i+1 == len(raw) {
+			result.WriteByte(raw[i])
+			continue
+		}
+
+		next := raw[i+1]
+		switch {
+		case next == '$':
+			result.WriteByte('$')
+			i++
+		case next == '{':
+			end := strings.IndexByte(raw[i+2:], '}')
+			if end < 0 {
+				return workloadRawBytes, nil, fmt.Errorf(
+					"unterminated variable reference starting with '%.20s'", raw[i:],
+				)
+			}
+			name, value, err := expandBracedVar(raw[i+2:i+2+end], vars)
+			if err != nil {
+				return workloadRawBytes, nil, err
+			}
+			resolved[name] = value
+			result.WriteString(value)
+			i += 2 + end
+		case isVarNameChar(next):
+			nameEnd := i + 1
+			for nameEnd < len(raw) && isVarNameChar(raw[nameEnd]) {
+				nameEnd++
+			}
+			name := raw[i+1 : nameEnd]
+			value, ok := lookupWorkloadVar(name, vars)
+			if !ok {
+				return workloadRawBytes, nil, fmt.Errorf(
+					"unable to find value for environment variable %s", name,
+				)
+			}
+			resolved[name] = value
+			result.WriteString(value)
+			i = nameEnd - 1
+		default:
+			result.WriteByte('$')
+		}
+	}
+
+	return []byte(result.String()), resolved, nil
+}
+
+// workloadVarNames returns the name of each variable referenced within the
+// workload xml, in the order they first appear, without resolving them.
+// See SubstituteWorkloadVars for the supported forms.
+func workloadVarNames(workloadRawBytes []byte) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	raw := string(workloadRawBytes)
+
+	for i := 0; i+1 < len(raw); i++ {
+		if raw[i] != '$' {
+			continue
+		}
+		start := i + 1
+		switch {
+		case raw[start] == '$':
+			i++
+			continue
+		case raw[start] == '{':
+			start++
+		}
+		end := start
+		for end < len(raw) && isVarNameChar(raw[end]) {
+			end++
+		}
+		if end > start && !seen[raw[start:end]] {
+			seen[raw[start:end]] = true
+			names = append(names, raw[start:end])
+		}
+		i = end - 1
 	}
 
-	return []byte(workloadRawString), nil
+	return names
+}
+
+// PerformEnvSubst finds environment variables defined in the workload xml
+// and tries to substitute them with their values within the environment.
+// See SubstituteWorkloadVars.
+func PerformEnvSubst(workloadRawBytes []byte) ([]byte, error) {
+	result, _, err := SubstituteWorkloadVars(workloadRawBytes, nil)
+	return result, err
 }
 
 // ParseWorkloadXML parses a uperf workload xml file into a Profile struct.
@@ -6,6 +6,8 @@ package uperf
 import (
 	"encoding/json"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -345,3 +347,72 @@ func TestPerformEnvSubst(t *testing.T) {
 		}
 	}
 }
+
+// TestSubstituteWorkloadVars checks each form of variable reference supported
+// within workloads, and that given vars take precedence over the environment.
+func TestSubstituteWorkloadVars(t *testing.T) {
+	os.Setenv("GOBENCH_TEST_HOST", "env.host")
+	os.Setenv("GOBENCH_TEST_EMPTY", "")
+	defer os.Unsetenv("GOBENCH_TEST_HOST")
+	defer os.Unsetenv("GOBENCH_TEST_EMPTY")
+	vars := map[string]string{"nthr": "4", "GOBENCH_TEST_HOST": "vars.host"}
+
+	tests := []struct {
+		input    string
+		expected string
+		resolved map[string]string
+	}{
+		{`nthreads="$nthr"`, `nthreads="4"`, map[string]string{"nthr": "4"}},
+		{`nthreads="${nthr}0"`, `nthreads="40"`, map[string]string{"nthr": "4"}},
+		{`remotehost=$GOBENCH_TEST_HOST`, `remotehost=vars.host`, map[string]string{"GOBENCH_TEST_HOST": "vars.host"}},
+		{`size=${size:-64k}`, `size=64k`, map[string]string{"size": "64k"}},
+		{`size=${GOBENCH_TEST_EMPTY:-1k}`, `size=1k`, map[string]string{"GOBENCH_TEST_EMPTY": "1k"}},
+		{`nthreads="${nthr:?nthr is required}"`, `nthreads="4"`, map[string]string{"nthr": "4"}},
+		{`cost=$$5 $ and $$nthr`, `cost=$5 $ and $nthr`, map[string]string{}},
+	}
+	for _, test := range tests {
+		result, resolved, err := SubstituteWorkloadVars([]byte(test.input), vars)
+		if err != nil {
+			t.Errorf("Unexpected error substituting '%s': %s", test.input, err)
+			continue
+		}
+		if string(result) != test.expected {
+			t.Errorf("Expected '%s' to become '%s', instead got '%s'", test.input, test.expected, result)
+		}
+		if !reflect.DeepEqual(resolved, test.resolved) {
+			t.Errorf("Expected '%s' to resolve %v, instead got %v", test.input, test.resolved, resolved)
+		}
+	}
+
+	// Environment is used when vars aren't given
+	result, _, err := SubstituteWorkloadVars([]byte(`${GOBENCH_TEST_HOST}`), nil)
+	if err != nil || string(result) != "env.host" {
+		t.Errorf("Expected variable to be taken from the environment, instead got '%s' (%v)", result, err)
+	}
+
+	invalid := map[string]string{
+		`$unset_var`:                     "unset_var",
+		`${unset_var}`:                   "unset_var",
+		`${unset_var:?a host is needed}`: "a host is needed",
+		`${GOBENCH_TEST_EMPTY:?}`:        "not set",
+		`${nthr`:                         "unterminated",
+		`${nthr:+x}`:                     "invalid variable reference",
+		`${:-x}`:                         "missing a name",
+	}
+	for input, message := range invalid {
+		_, _, err := SubstituteWorkloadVars([]byte(input), vars)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("Expected error containing '%s' substituting '%s', instead got %v", message, input, err)
+		}
+	}
+}
+
+// TestWorkloadVarNames checks that every form of variable reference is found
+// without being resolved, and that escaped references are ignored.
+func TestWorkloadVarNames(t *testing.T) {
+	input := `nthreads="$nthr" size=${size:-64k} host=${host:?required} ${nthr}0 cost=$$5 $$escaped $ end$`
+	expected := []string{"nthr", "size", "host"}
+	if names := workloadVarNames([]byte(input)); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected variable names %v, instead got %v", expected, names)
+	}
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/learnitall/gobench/artifacts"
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// CaptureLog starts copying the log into the artifacts directory of a run
+// with the given Config, creating the directory if needed.
+// The returned log file should be closed once the run is finished. It is nil
+// if artifacts are disabled.
+func CaptureLog(cfg *define.Config) (*os.File, error) {
+	dir := artifacts.Dir(cfg)
+	if len(dir) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create artifacts directory %s: %s", dir, err)
+	}
+
+	logPath := filepath.Join(dir, artifacts.LogFile)
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create log file %s: %s", logPath, err)
+	}
+	log.Logger = log.Output(zerolog.MultiLevelWriter(os.Stderr, logFile))
+	log.Info().
+		Str("artifacts_dir", dir).
+		Msg("Saving run artifacts.")
+	return logFile, nil
+}
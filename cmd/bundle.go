@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/learnitall/gobench/artifacts"
+	"github.com/spf13/cobra"
+)
+
+// bundleArtifactsDir is the artifacts directory to bundle.
+var bundleArtifactsDir string
+
+// bundleOutput is the path to write the bundle to.
+var bundleOutput string
+
+func runBundle(cmd *cobra.Command, args []string) {
+	runID := args[0]
+	dir := bundleArtifactsDir
+	if len(dir) == 0 {
+		dir = artifacts.DefaultDir(runID)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		CheckError(fmt.Errorf("no artifacts directory found at %s, give its path with --artifacts-dir", dir))
+	}
+	output := bundleOutput
+	if len(output) == 0 {
+		output = fmt.Sprintf("%s.tar.gz", artifacts.DefaultDir(runID))
+	}
+
+	manifest, err := artifacts.Bundle(dir, runID, output)
+	CheckError(err)
+	fmt.Fprintf(os.Stderr, "Bundled %d artifacts from %s.\n", len(manifest.Files), dir)
+	fmt.Println(output)
+}
+
+// bundleCmd represents the bundle command
+var bundleCmd = &cobra.Command{
+	Use:   "bundle uuid",
+	Short: "Pack the artifacts of a run into a tar.gz.",
+	Long:  `Pack every file within the artifacts directory of the run with the given ID into a tar.gz, to attach to bug reports. The bundle includes a manifest.json listing each file's size and SHA-256 checksum, and a SHA256SUMS file which can be checked with 'sha256sum -c'. The path of the bundle is printed to stdout.`,
+	Args:  cobra.ExactArgs(1),
+	Run:   runBundle,
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.Flags().StringVar(&bundleArtifactsDir, "artifacts-dir", "", "Artifacts directory of the run. Defaults to 'gobench-<uuid>'.")
+	bundleCmd.Flags().StringVarP(&bundleOutput, "output", "o", "", "Path to write the bundle to. Defaults to 'gobench-<uuid>.tar.gz'.")
+}
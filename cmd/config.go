@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/learnitall/gobench/artifacts"
+	"github.com/learnitall/gobench/define"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// configNamespaceAnnotation is the annotation giving the namespace of a
+// command's own options within config files, if it differs from the
+// command's name. See configKey.
+const configNamespaceAnnotation string = "gobench.config.namespace"
+
+// envPrefix is the prefix of environment variables which set options.
+const envPrefix string = "GOBENCH"
+
+// sharedOptions holds the name of each option shared by commands which
+// export benchmark results, being the flags added by addRunFlags.
+var sharedOptions map[string]bool = func() map[string]bool {
+	flags := pflag.NewFlagSet("shared", pflag.ContinueOnError)
+	addRunFlags(flags, &define.Config{})
+	shared := map[string]bool{}
+	flags.VisitAll(func(flag *pflag.Flag) {
+		shared[flag.Name] = true
+	})
+	return shared
+}()
+
+// configNamespace returns the namespace of the given command's own options.
+func configNamespace(cmd *cobra.Command) string {
+	if namespace, ok := cmd.Annotations[configNamespaceAnnotation]; ok {
+		return namespace
+	}
+	return cmd.Name()
+}
+
+// configKey returns the key used to set the given flag of the given command
+// within config files. Options shared by every run, such as
+// `elasticsearch-url`, use the flag's name. Options of a single command are
+// namespaced by the command, such as `uperf.serve`.
+// Environment variables use the same key, uppercased with dots and dashes
+// replaced by underscores and prefixed by GOBENCH_, ie GOBENCH_UPERF_SERVE.
+func configKey(cmd *cobra.Command, flag *pflag.Flag) string {
+	if sharedOptions[flag.Name] {
+		return flag.Name
+	}
+	return configNamespace(cmd) + "." + flag.Name
+}
+
+// configStrings converts the given value from a config file or environment
+// variable into a list of strings. Strings are split on commas.
+func configStrings(value interface{}) []string {
+	switch typed := value.(type) {
+	case string:
+		if len(typed) == 0 {
+			return []string{}
+		}
+		return strings.Split(typed, ",")
+	case []interface{}:
+		values := []string{}
+		for _, item := range typed {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	case []string:
+		return typed
+	default:
+		return []string{fmt.Sprint(typed)}
+	}
+}
+
+// setFlagFromConfig sets the given flag to the given value from a config file
+// or environment variable. Lists and maps replace the flag's default.
+func setFlagFromConfig(flag *pflag.Flag, value interface{}) error {
+	if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+		return sliceValue.Replace(configStrings(value))
+	}
+	if flag.Value.Type() == "stringToString" {
+		entries, ok := value.(map[string]interface{})
+		if !ok {
+			return flag.Value.Set(fmt.Sprint(value))
+		}
+		keys := []string{}
+		for key := range entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := flag.Value.Set(fmt.Sprintf("%s=%v", key, entries[key])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return flag.Value.Set(fmt.Sprint(value))
+}
+
+// applyConfig sets each option of the given command which wasn't given on
+// the command line from the config file or environment, giving the
+// precedence: command line flags, then environment variables, then the
+// config file, then defaults.
+// Options which are set are marked as changed, so they satisfy flags
+// required by the command.
+func applyConfig(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || flag.Name == "help" || flag.Name == "config" {
+			return
+		}
+		key := configKey(cmd, flag)
+		if !viper.IsSet(key) {
+			return
+		}
+		if setErr := setFlagFromConfig(flag, viper.Get(key)); setErr != nil {
+			err = fmt.Errorf("invalid value for %s from config: %s", key, setErr)
+			return
+		}
+		flag.Changed = true
+	})
+	return err
+}
+
+// configValue returns the current value of the given flag, typed so it can
+// be marshalled. Secrets are redacted.
+func configValue(flags *pflag.FlagSet, flag *pflag.Flag) interface{} {
+	switch flag.Value.Type() {
+	case "bool":
+		value, _ := strconv.ParseBool(flag.Value.String())
+		return value
+	case "int":
+		value, _ := strconv.Atoi(flag.Value.String())
+		return value
+	case "stringSlice":
+		value, _ := flags.GetStringSlice(flag.Name)
+		return value
+	case "stringArray":
+		value, _ := flags.GetStringArray(flag.Name)
+		return value
+	case "stringToString":
+		value, _ := flags.GetStringToString(flag.Name)
+		return value
+	}
+	value := flag.Value.String()
+	if strings.Contains(flag.Name, "password") {
+		return artifacts.RedactSecret(value)
+	}
+	if strings.HasSuffix(flag.Name, "-url") {
+		return artifacts.RedactURL(value)
+	}
+	return value
+}
+
+// effectiveConfig returns the value of every option of each given command,
+// keyed as they would be within a config file, after the config file and
+// environment have been applied.
+func effectiveConfig(cmds ...*cobra.Command) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	for _, cmd := range cmds {
+		if err := applyConfig(cmd); err != nil {
+			return nil, err
+		}
+		cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+			if flag.Name == "help" || flag.Name == "config" {
+				return
+			}
+			key := configKey(cmd, flag)
+			value := configValue(cmd.Flags(), flag)
+			if !strings.Contains(key, ".") {
+				settings[key] = value
+				return
+			}
+			fields := strings.SplitN(key, ".", 2)
+			namespace, ok := settings[fields[0]].(map[string]interface{})
+			if !ok {
+				namespace = map[string]interface{}{}
+				settings[fields[0]] = namespace
+			}
+			namespace[fields[1]] = value
+		})
+	}
+	return settings, nil
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) {
+	// Show the options of `gobench run` and each benchmark
+	cmds := []*cobra.Command{cmd}
+	cmds = append(cmds, runCmd.Commands()...)
+	settings, err := effectiveConfig(cmds...)
+	CheckError(err)
+	marshalled, err := yaml.Marshal(settings)
+	CheckError(err)
+	_, err = os.Stdout.Write(marshalled)
+	CheckError(err)
+}
+
+// configCmd groups commands which work with gobench's configuration.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect gobench's configuration.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+		os.Exit(1)
+	},
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration.",
+	Long: `Print the options of 'gobench run' and each benchmark as yaml, after
+merging command line flags, GOBENCH_* environment variables and the config
+file. The output can be used as a config file. Passwords are redacted.`,
+	Args: cobra.NoArgs,
+	Run:  runConfigShow,
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+	addRunFlags(configShowCmd.Flags(), cliConfig)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/learnitall/gobench/define"
+	"github.com/learnitall/gobench/exporters"
+	"github.com/spf13/cobra"
+)
+
+// fetchOptions holds the flags of `gobench fetch`. They are kept apart from
+// the Config bound to `gobench run`, as the commands give shared flags such
+// as `--uuid` different defaults.
+type fetchOptions struct {
+	cfg    define.Config
+	format string
+}
+
+// fetchOpts holds the flags given to `gobench fetch`.
+var fetchOpts fetchOptions = fetchOptions{cfg: *define.NewConfig()}
+
+// fetchCmd represents the fetch command
+var fetchCmd = &cobra.Command{
+	Use:   "fetch",
+	Short: "Fetch the results of a benchmark run from Elasticsearch.",
+	Long: `Pull every document exported for the given run UUID back out of
+Elasticsearch and print them to stdout. With --format json (the default), the
+output is a json array matching what --print-json produces during a run. With
+--format ndjson, each document is printed on its own line. Documents are
+printed in the order they were recorded, by their timestamps.`,
+	Run: runFetch,
+}
+
+func runFetch(cmd *cobra.Command, args []string) {
+	cfg := &fetchOpts.cfg
+	SetLogLevel(cfg)
+
+	switch fetchOpts.format {
+	case "json":
+		exporter := &exporters.JsonExporter{}
+		CheckError(exporter.Setup(cfg))
+		CheckError(
+			exporters.FetchElasticsearchDocuments(
+				cfg, cfg.RunID,
+				func(document json.RawMessage) error {
+					marshalled, err := exporter.Marshal(document)
+					if err != nil {
+						return err
+					}
+					return exporter.Export(marshalled)
+				},
+			),
+		)
+		CheckError(exporter.Teardown())
+	case "ndjson":
+		CheckError(
+			exporters.FetchElasticsearchDocuments(
+				cfg, cfg.RunID,
+				func(document json.RawMessage) error {
+					var compacted bytes.Buffer
+					if err := json.Compact(&compacted, document); err != nil {
+						return err
+					}
+					_, err := fmt.Println(compacted.String())
+					return err
+				},
+			),
+		)
+	default:
+		CheckError(
+			fmt.Errorf("unknown format %s, expected json or ndjson", fetchOpts.format),
+		)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(fetchCmd)
+	cfg := &fetchOpts.cfg
+	fetchCmd.Flags().BoolVarP(&cfg.Verbose, "verbose", "v", false, "Enables verbose debug info.")
+	fetchCmd.Flags().BoolVarP(&cfg.Quiet, "quiet", "q", false, "Disable all log output. Overrides the --verbose/-v.")
+	fetchCmd.Flags().StringVarP(&cfg.RunID, "uuid", "u", "", "UUID of the run to fetch results for.")
+	fetchCmd.MarkFlagRequired("uuid")
+	fetchCmd.Flags().StringVarP(&fetchOpts.format, "format", "f", "json", "Format to print documents in, either json or ndjson.")
+	addElasticsearchFlags(fetchCmd.Flags(), cfg)
+	fetchCmd.MarkFlagRequired("elasticsearch-url")
+}
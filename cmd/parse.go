@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// parseCmd represents the parse command
+var parseCmd = &cobra.Command{
+	Use:   "parse",
+	Short: "Parse and export saved benchmark output.",
+	Long: `Parse output saved from a previous run of a benchmark and export the
+results, without running the benchmark. Results go through the same pipeline
+and exporters as 'gobench run', so history can be backfilled and results
+re-exported after parser fixes. Each subcommand represents a supported
+benchmark whose output can be parsed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+		os.Exit(1)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(parseCmd)
+	addRunFlags(parseCmd.PersistentFlags(), cliConfig)
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// BenchmarkFactory builds a benchmark from the arguments which would be given
+// to its `gobench run` subcommand, ie `--serve iperf.xml -- -R` for uperf.
+type BenchmarkFactory func(args []string) (define.Benchmarkable, error)
+
+// benchmarkFactories holds the BenchmarkFactory of each benchmark compiled
+// into gobench, by name.
+var benchmarkFactories map[string]BenchmarkFactory = map[string]BenchmarkFactory{}
+
+// RegisterBenchmark makes the benchmark with the given name available to
+// scenarios. Benchmarks register themselves within the init function of their
+// command, so only benchmarks enabled by build tags are available.
+func RegisterBenchmark(name string, factory BenchmarkFactory) {
+	benchmarkFactories[name] = factory
+}
+
+// RegisteredBenchmarks returns the name of each registered benchmark, sorted.
+func RegisteredBenchmarks() []string {
+	names := []string{}
+	for name := range benchmarkFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewBenchmark builds the registered benchmark with the given name from the
+// given arguments.
+func NewBenchmark(name string, args []string) (define.Benchmarkable, error) {
+	factory, ok := benchmarkFactories[name]
+	if !ok {
+		registered := "none"
+		if names := RegisteredBenchmarks(); len(names) > 0 {
+			registered = strings.Join(names, ", ")
+		}
+		return nil, fmt.Errorf(
+			"unknown benchmark '%s', gobench was built with: %s", name, registered,
+		)
+	}
+	bench, err := factory(args)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arguments for %s: %s", name, err)
+	}
+	return bench, nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+)
+
+// PrintReports prints a summary table of the given reports to stderr, followed
+// by why any exporter was disabled and the reason each failed document could
+// not be exported.
+// Nothing is printed if the Config has quiet mode enabled.
+func PrintReports(cfg *define.Config, reports []*define.ExportReport) {
+	if cfg.Quiet || len(reports) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nExporter\tAdded\tFlushed\tIndexed\tFailed\tRequests\tLatency")
+	for _, report := range reports {
+		fmt.Fprintf(
+			w, "%s\t%d\t%d\t%d\t%d\t%d\t%.3fs\n",
+			report.Exporter, report.NumAdded, report.NumFlushed,
+			report.NumIndexed, report.NumFailed, report.NumRequests,
+			report.LatencySeconds,
+		)
+	}
+	w.Flush()
+
+	for _, report := range reports {
+		if len(report.Error) > 0 {
+			log.Warn().
+				Str("exporter", report.Exporter).
+				Str("reason", report.Error).
+				Msg("Exporter was disabled during the run.")
+		}
+		for _, failure := range report.Failures {
+			log.Warn().
+				Str("exporter", report.Exporter).
+				Str("reason", failure.Reason).
+				Str("document", failure.Document).
+				Msg("Document failed to export.")
+		}
+	}
+}
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -22,6 +23,9 @@ See https://github.com/learnitall/gobenchmark for more information.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return applyConfig(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -36,7 +40,8 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file")
+	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", `Config file in yaml, toml or json. Defaults to gobench.yaml within
+the working directory or $HOME/.config/gobench, if one exists.`)
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -44,12 +49,23 @@ func initConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
+	} else {
+		viper.SetConfigName("gobench")
+		viper.AddConfigPath(".")
+		viper.AddConfigPath("$HOME/.config/gobench")
 	}
 
-	viper.AutomaticEnv() // read in environment variables that match
+	// Read in environment variables that match, ie GOBENCH_ELASTICSEARCH_URL
+	// for elasticsearch-url and GOBENCH_UPERF_SERVE for uperf.serve
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_", ".", "_"))
+	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
+	err := viper.ReadInConfig()
+	if err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	} else if _, notFound := err.(viper.ConfigFileNotFoundError); !notFound || cfgFile != "" {
+		CheckError(fmt.Errorf("unable to read config file: %s", err))
 	}
 }
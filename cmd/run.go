@@ -6,12 +6,13 @@ import (
 	"runtime/debug"
 
 	"github.com/learnitall/gobench/define"
-	"github.com/learnitall/gobench/exporters"
+	"github.com/learnitall/gobench/runner"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // runCmd represents the run command
@@ -27,18 +28,67 @@ benchmark which can be executed and has its own options.`,
 	},
 }
 
+// cliConfig holds the options given on the command line, which each command
+// binds its flags to.
+var cliConfig *define.Config = define.NewConfig()
+
 func init() {
 	rootCmd.AddCommand(runCmd)
-	cfg := define.GetConfig()
-	runCmd.PersistentFlags().BoolVarP(&cfg.Verbose, "verbose", "v", false, "Enables verbose debug info.")
-	runCmd.PersistentFlags().BoolVarP(&cfg.Quiet, "quiet", "q", false, "Disable all log output. Overrides the --verbose/-v.")
-	runCmd.PersistentFlags().BoolVarP(&cfg.PrintJson, "print-json", "p", false, "Print benchmark results as json documents. Guaranteed that the printed data is jq-pipeable, i.e. gobench run --quiet --print-json ... | jq.")
-	runCmd.PersistentFlags().StringVarP(&cfg.RunID, "uuid", "u", uuid.New().String(), "Set unique run UUID ID to identify benchmark results. If one is not given, one will be generated.")
-	runCmd.PersistentFlags().StringVar(&cfg.ElasticsearchURL, "elasticsearch-url", "", "Set URL of Elasticsearch instance to export results to.")
-	runCmd.PersistentFlags().StringVar(&cfg.ElasticsearchIndex, "elasticsearch-index", "", "Set Elasticsearch Index to send results to.")
-	runCmd.PersistentFlags().BoolVar(&cfg.ElasticsearchInjectProductHeader,
+	addRunFlags(runCmd.PersistentFlags(), cliConfig)
+}
+
+// addRunFlags adds flags shared by commands which export benchmark results,
+// such as the run ID and exporter options, to the given FlagSet, binding them
+// to the given Config.
+func addRunFlags(flags *pflag.FlagSet, cfg *define.Config) {
+	flags.BoolVarP(&cfg.Verbose, "verbose", "v", false, "Enables verbose debug info.")
+	flags.BoolVarP(&cfg.Quiet, "quiet", "q", false, "Disable all log output. Overrides the --verbose/-v.")
+	flags.BoolVarP(&cfg.PrintJson, "print-json", "p", false, "Print benchmark results as json documents. Guaranteed that the printed data is jq-pipeable, i.e. gobench run --quiet --print-json ... | jq.")
+	flags.StringVarP(&cfg.RunID, "uuid", "u", uuid.New().String(), "Set unique run UUID ID to identify benchmark results. If one is not given, one will be generated.")
+	flags.StringToStringVar(&cfg.Tags, "tag", map[string]string{}, `Add a key=value tag to the metadata of every exported document.
+Can be given multiple times.`)
+	flags.StringVar(&cfg.ExportFailurePolicy, "export-failure-policy", string(define.ExportFailurePolicyAny), `Decide when documents which failed to export cause a non-zero
+exit code. One of 'any' (any document failed), 'all' (every document
+given to an exporter failed) or 'never'.`)
+	flags.DurationVar(&cfg.Timeout, "timeout", 0, `Stop the benchmark if it runs for longer than the given duration,
+ie '10m'. Defaults to no limit.`)
+	flags.StringVar(&cfg.ReportPath, "report-path", "", "Write the export report for the run as json to the given path.")
+	flags.StringVar(&cfg.ArtifactsDir, "artifacts-dir", "", `Directory to save the run's artifacts to, such as the benchmark's
+raw output, the resolved config, the log and the exported documents.
+Defaults to 'gobench-<uuid>'. See 'gobench bundle'.`)
+	flags.BoolVar(&cfg.DisableArtifacts, "no-artifacts", false, "Don't save any artifacts for the run.")
+	flags.StringSliceVar(&cfg.BestEffortExporters, "best-effort-exporters", []string{}, `Comma-separated list of exporters whose errors are logged rather
+than failing the run. One or more of 'elasticsearch', 'opensearch' or 'json'.`)
+	addElasticsearchFlags(flags, cfg)
+	flags.StringVar(&cfg.OpenSearchURL, "opensearch-url", "", "Set URL of OpenSearch instance to export results to.")
+	flags.StringVar(&cfg.OpenSearchIndex, "opensearch-index", "", `Set OpenSearch Index to send results to. Supports the same templates
+as --elasticsearch-index.`)
+	flags.BoolVar(&cfg.OpenSearchDataStream, "opensearch-data-stream", false, `Treat the OpenSearch Index as a data stream, indexing
+documents with op_type=create and an injected '@timestamp' field.`)
+	flags.BoolVar(&cfg.OpenSearchSkipVerify, "opensearch-skip-verify", false, "Skip verification of the OpenSearch server's TLS certificate.")
+	flags.StringVar(&cfg.OpenSearchCACert, "opensearch-ca-cert", "", "Path to a PEM-encoded CA certificate used to verify the OpenSearch server.")
+	flags.StringVar(&cfg.OpenSearchUsername, "opensearch-username", "", "Set username for basic authentication with OpenSearch.")
+	flags.StringVar(&cfg.OpenSearchPassword, "opensearch-password", "", "Set password for basic authentication with OpenSearch.")
+	flags.StringVar(&cfg.OpenSearchMappingPath, "opensearch-mapping", "", `Path to an index mapping, such as those in the mappings/ directory,
+used to create the OpenSearch Index if it does not exist.`)
+}
+
+// addElasticsearchFlags adds flags for connecting to Elasticsearch to the
+// given FlagSet, binding them to the given Config.
+func addElasticsearchFlags(flags *pflag.FlagSet, cfg *define.Config) {
+	flags.StringVar(&cfg.ElasticsearchURL, "elasticsearch-url", "", "Set URL of Elasticsearch instance to export results to.")
+	flags.StringVar(&cfg.ElasticsearchIndex, "elasticsearch-index", "", `Set Elasticsearch Index to send results to. Can be a template
+which routes each document based on its fields and date, such as
+'gobench-{benchmark}-{section}-{yyyy.MM}'.`)
+	flags.BoolVar(&cfg.ElasticsearchDataStream, "elasticsearch-data-stream", false, `Treat the Elasticsearch Index as a data stream, indexing
+documents with op_type=create and an injected '@timestamp' field.`)
+	flags.BoolVar(&cfg.ElasticsearchInjectProductHeader,
 		"elasticsearch-iph", true, `Have the Elasticsearch http client inject
 'X-Product-Elastic=ElasticSearch' header into ElasticSearch server responses.`)
+	flags.BoolVar(&cfg.ElasticsearchSkipVerify, "elasticsearch-skip-verify", false, "Skip verification of the Elasticsearch server's TLS certificate.")
+	flags.StringVar(&cfg.ElasticsearchCACert, "elasticsearch-ca-cert", "", "Path to a PEM-encoded CA certificate used to verify the Elasticsearch server.")
+	flags.StringVar(&cfg.ElasticsearchUsername, "elasticsearch-username", "", "Set username for basic authentication with Elasticsearch.")
+	flags.StringVar(&cfg.ElasticsearchPassword, "elasticsearch-password", "", "Set password for basic authentication with Elasticsearch.")
 }
 
 // SetLogLevel sets the current log level based on the given Config.
@@ -64,35 +114,6 @@ func LogVersion() {
 		Msg("Starting gobench.")
 }
 
-// GetExporter takes in the current Config and returns an appropriate Exporterable.
-func GetExporter(config *define.Config) define.Exporterable {
-	configuredExporters := []define.Exporterable{}
-	if config.ElasticsearchURL != "" {
-		log.Info().Msg("Creating ElasticsearchExporter.")
-		configuredExporters = append(
-			configuredExporters, &exporters.ElasticsearchExporter{},
-		)
-	}
-	if config.PrintJson {
-		log.Info().Msg("Creating JsonExporter.")
-		configuredExporters = append(
-			configuredExporters, &exporters.JsonExporter{},
-		)
-	}
-
-	if len(configuredExporters) == 0 {
-		log.Warn().Msg("No exporter configured, using dummy exporter.")
-		return &exporters.DummyExporter{}
-	} else if len(configuredExporters) == 1 {
-		return configuredExporters[0]
-	} else {
-		return &exporters.ChainExporter{
-			Exporters:  configuredExporters,
-			Marshalled: make([][]byte, len(configuredExporters)),
-		}
-	}
-}
-
 // CheckError wraps a function call which returns an error.
 // If an error is returned, then `os.Exit(1)` is called
 func CheckError(err error) {
@@ -102,23 +123,36 @@ func CheckError(err error) {
 	}
 }
 
-// RunBenchmark actually performs the task of running a benchmark.
-func RunBenchmark(bench define.Benchmarkable) {
-	var (
-		cfg      *define.Config = define.GetConfig()
-		exporter define.Exporterable
-	)
+// RunBenchmark runs the given benchmark with the options given on the
+// command line, exiting with a non-zero code if it fails. See runBenchmark.
+func RunBenchmark(name string, bench define.Benchmarkable) {
+	CheckError(runBenchmark(cliConfig, name, bench))
+}
+
+// runBenchmark runs the given benchmark with the given Config using a
+// runner.Runner, logging the run into its artifacts directory and printing
+// its export reports.
+// The log is restored once the run is finished, so runs can be performed one
+// after another.
+func runBenchmark(cfg *define.Config, name string, bench define.Benchmarkable) error {
 	SetLogLevel(cfg)
+	logger := log.Logger
+	defer func() { log.Logger = logger }()
+	logFile, err := CaptureLog(cfg)
+	if err != nil {
+		return err
+	}
+	if logFile != nil {
+		defer logFile.Close()
+	}
 	LogVersion()
-	exporter = GetExporter(cfg)
 
-	CheckError(exporter.Setup(cfg))
-	CheckError(exporter.Healthcheck())
-	CheckError(bench.Setup(cfg))
-	CheckError(bench.Run(exporter))
-
-	// Don't want to exit on these, as doing so
-	// would interrupt other cleanup tasks
-	bench.Teardown(cfg)
-	exporter.Teardown()
+	result, err := runner.New(runner.WithConfig(cfg)).Run(name, bench)
+	PrintReports(cfg, result.Reports)
+	if len(result.ArtifactsDir) > 0 {
+		log.Info().
+			Str("artifacts_dir", result.ArtifactsDir).
+			Msgf("Saved run artifacts, bundle them with 'gobench bundle %s'.", result.RunID)
+	}
+	return err
 }
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/learnitall/gobench/define"
+	"github.com/learnitall/gobench/scenario"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// scenarioCampaignID is the campaign ID given on the command line.
+var scenarioCampaignID string
+
+// applyRunArgs parses the given `gobench run` flags onto the given Config.
+// Options not given within the flags are left as they are.
+func applyRunArgs(cfg *define.Config, args []string) error {
+	resolved := *cfg
+	flags := pflag.NewFlagSet("exporters", pflag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	addRunFlags(flags, cfg)
+	// Adding the flags resets the Config to their defaults
+	*cfg = resolved
+	return flags.Parse(args)
+}
+
+// checkScenario builds the benchmark and Config of each step within the given
+// Scenario, so mistakes are caught before anything is run.
+func checkScenario(s *scenario.Scenario, base *define.Config) error {
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if _, err := NewBenchmark(step.Benchmark, step.Args); err != nil {
+			return fmt.Errorf("step %s: %s", step.Name, err)
+		}
+		cfg := *base
+		if err := applyRunArgs(&cfg, s.ExporterArgs(step)); err != nil {
+			return fmt.Errorf("step %s: invalid exporters: %s", step.Name, err)
+		}
+	}
+	return nil
+}
+
+// runScenarioStep runs a single sample of the given step of the given Scenario.
+func runScenarioStep(s *scenario.Scenario, cfg *define.Config, step *scenario.Step) error {
+	bench, err := NewBenchmark(step.Benchmark, step.Args)
+	if err != nil {
+		return err
+	}
+	if err := applyRunArgs(cfg, s.ExporterArgs(step)); err != nil {
+		return err
+	}
+	return runBenchmark(cfg, step.Benchmark, bench)
+}
+
+// PrintStepResults prints a summary table of the given scenario results to
+// stderr. Nothing is printed if the Config has quiet mode enabled.
+func PrintStepResults(cfg *define.Config, campaignID string, results []scenario.StepResult) {
+	if cfg.Quiet {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "\nCampaign %s\n", campaignID)
+	fmt.Fprintln(w, "Step\tSample\tRunID\tStatus\tDuration")
+	for _, result := range results {
+		status := "passed"
+		if result.Skipped {
+			status = "skipped"
+		} else if result.Err != nil {
+			status = fmt.Sprintf("failed: %s", result.Err)
+		}
+		duration := "-"
+		if !result.StartTime.IsZero() {
+			duration = result.EndTime.Sub(result.StartTime).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(
+			w, "%s\t%d\t%s\t%s\t%s\n",
+			result.Step, result.Sample, result.RunID, status, duration,
+		)
+	}
+	w.Flush()
+}
+
+func runScenario(cmd *cobra.Command, args []string) {
+	cfg := cliConfig
+	SetLogLevel(cfg)
+	s, err := scenario.Load(args[0])
+	CheckError(err)
+	if len(scenarioCampaignID) > 0 {
+		s.CampaignID = scenarioCampaignID
+	} else if len(s.CampaignID) == 0 {
+		s.CampaignID = uuid.New().String()
+	}
+	CheckError(checkScenario(s, cfg))
+
+	log.Info().
+		Str("campaign_id", s.CampaignID).
+		Str("scenario", s.Name).
+		Int("steps", len(s.Steps)).
+		Msg("Starting scenario.")
+	results, err := s.Run(cfg, func(stepCfg *define.Config, step *scenario.Step) error {
+		return runScenarioStep(s, stepCfg, step)
+	})
+	PrintStepResults(cfg, s.CampaignID, results)
+	CheckError(err)
+}
+
+// scenarioCmd groups commands which work with scenario files.
+var scenarioCmd = &cobra.Command{
+	Use:   "scenario",
+	Short: "Run campaigns of benchmarks described by scenario files.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+		os.Exit(1)
+	},
+}
+
+// scenarioRunCmd represents the scenario run command
+var scenarioRunCmd = &cobra.Command{
+	Use: "run scenario.yaml",
+	Annotations: map[string]string{
+		configNamespaceAnnotation: "scenario",
+	},
+	Short: "Run each step of a scenario file.",
+	Long: `Run each benchmark step within the given yaml scenario file in order,
+under a shared campaign ID. Each run of a step is given its own run ID, and
+its documents are tagged with the step's name and sample number. Exporter
+options given on the command line apply to every step, unless overridden
+within the scenario. Each step's benchmark and arguments are checked before
+anything is run. See the README for the scenario format.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runScenario,
+}
+
+func init() {
+	rootCmd.AddCommand(scenarioCmd)
+	scenarioCmd.AddCommand(scenarioRunCmd)
+	addRunFlags(scenarioRunCmd.Flags(), cliConfig)
+	scenarioRunCmd.Flags().StringVar(&scenarioCampaignID, "campaign-id", "", `ID shared by every run within the scenario. Defaults to the
+scenario's campaign-id, or a generated UUID.`)
+}
@@ -4,32 +4,283 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/learnitall/gobench/benchmarks/uperf"
+	"github.com/learnitall/gobench/define"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// uperfRunOptions holds the flags of `gobench run uperf`, so they can be
+// parsed both from the command line and from the steps of a scenario.
+// The bench field holds flags which map directly onto UperfBenchmark fields.
+type uperfRunOptions struct {
+	bench  uperf.UperfBenchmark
+	preset uperf.PresetOptions
+	sweep  []string
+	vars   map[string]string
+}
+
+// uperfRun holds the flags given to `gobench run uperf`.
+var uperfRun uperfRunOptions
+
+// uperfOptions holds flags of the parse command which map directly onto
+// UperfBenchmark fields.
+var uperfOptions uperf.UperfBenchmark
+
+// uperfPresetOptions holds flags for generating a workload from a preset.
+var uperfPresetOptions uperf.PresetOptions
+
+// uperfVars holds values for variables referenced within the uperf workload.
+var uperfVars map[string]string
+
+// uperfReplayOptions holds flags for parsing saved uperf output.
+var uperfReplayOptions uperf.UperfReplayBenchmark
+
+// uperfReplayStartTime is the time the saved uperf run started, in RFC3339 format.
+var uperfReplayStartTime string
+
+// addUperfVarsFlag adds the flag for setting workload variables to the given
+// FlagSet, binding it to the given map.
+func addUperfVarsFlag(flags *pflag.FlagSet, vars *map[string]string) {
+	flags.StringToStringVar(vars, "set", map[string]string{}, `Set a NAME=value variable to substitute into the workload, taking
+precedence over the environment. Can be given multiple times.`)
+}
+
+// addUperfPresetFlags adds flags for generating a uperf workload from a preset
+// to the given FlagSet, binding them to the given PresetOptions.
+func addUperfPresetFlags(flags *pflag.FlagSet, opts *uperf.PresetOptions) {
+	flags.StringVar(&opts.Preset, "preset", "", fmt.Sprintf(`Generate the workload from a preset rather than a workload file.
+One of %s.`, strings.Join(uperf.Presets, ", ")))
+	flags.StringVar(&opts.Protocol, "proto", "tcp", "Protocol used by the preset workload, either tcp or udp.")
+	flags.IntVar(&opts.NThreads, "nthr", 1, "Number of threads used by the preset workload.")
+	flags.StringVar(&opts.Size, "size", "64k", "Size of each message sent by the preset workload.")
+	flags.DurationVar(&opts.Duration, "duration", 30*time.Second, "How long the preset workload's main transaction runs for.")
+	flags.StringVar(&opts.Remote, "remote", "localhost", "Remote host the preset workload connects to.")
+}
+
+// addUperfRunFlags adds the flags of `gobench run uperf` to the given FlagSet,
+// binding them to the given uperfRunOptions.
+func addUperfRunFlags(flags *pflag.FlagSet, opts *uperfRunOptions) {
+	flags.BoolVar(&opts.bench.Serve, "serve", false, `Start a local uperf server ('uperf -s') before running the
+benchmark and stop it afterwards.`)
+	flags.IntVar(&opts.bench.ServerPort, "server-port", 0, `Port for the local uperf server to listen on. Defaults to
+uperf's default of 20000. Pass the same port to uperf with '-P'.`)
+	flags.StringVar(&opts.bench.ServerNetns, "server-netns", "", "Start the local uperf server within the given network namespace.")
+	flags.StringVar(&opts.bench.ServerLogPath, "server-log", "", `Path to write the local uperf server's output to. Defaults to
+'uperf-server.log' within the artifacts directory.`)
+	addUperfPresetFlags(flags, &opts.preset)
+	addUperfVarsFlag(flags, &opts.vars)
+	flags.BoolVar(&opts.bench.TolerantParsing, "tolerant-parsing", false, `Skip lines of uperf's output which can't be parsed, rather than
+failing the run. The number of skipped lines is recorded in the run info.`)
+	flags.StringArrayVar(&opts.sweep, "sweep", []string{}, `Run uperf once for each combination of the given parameters, with
+the format name=value1,value2,... Can be given multiple times, ie
+'--sweep size=64,1k,16k --sweep nthr=1,4,16'. Each parameter is set as
+a variable for the workload, overriding --set, and overrides the matching
+preset option. Can also be set with the 'uperf.sweep' list in the config file.`)
+}
+
+// buildUperfBenchmark builds the uperf benchmark described by the given
+// options and positional arguments, being the workload file followed by
+// arguments for uperf. A workload file is required unless a preset is given.
+// If a sweep is given, then an UperfSweepBenchmark is returned.
+// Arguments are checked here rather than by cobra, as options such as the
+// preset may come from the config file, which is applied after cobra checks
+// arguments.
+func buildUperfBenchmark(opts *uperfRunOptions, args []string) (define.Benchmarkable, error) {
+	if len(opts.preset.Preset) == 0 && len(args) < 1 {
+		return nil, fmt.Errorf("a workload file is required when --preset is not given")
+	}
+	bench := &uperf.UperfBenchmark{
+		Vars:            opts.vars,
+		TolerantParsing: opts.bench.TolerantParsing,
+		Serve:           opts.bench.Serve,
+		ServerPort:      opts.bench.ServerPort,
+		ServerNetns:     opts.bench.ServerNetns,
+		ServerLogPath:   opts.bench.ServerLogPath,
+	}
+	if len(opts.preset.Preset) > 0 {
+		bench.Preset = &opts.preset
+		bench.Args = args
+	} else {
+		bench.WorkloadPath = args[0]
+		bench.Args = args[1:]
+	}
+
+	if len(opts.sweep) > 0 {
+		sweep, err := uperf.ParseSweepSpec(opts.sweep)
+		if err != nil {
+			return nil, err
+		}
+		return &uperf.UperfSweepBenchmark{
+			Benchmark: *bench,
+			Sweep:     sweep,
+		}, nil
+	}
+	return bench, nil
+}
+
+// newUperfBenchmark builds a uperf benchmark from the arguments which would
+// be given to `gobench run uperf`. It is the BenchmarkFactory for uperf.
+func newUperfBenchmark(args []string) (define.Benchmarkable, error) {
+	opts := &uperfRunOptions{}
+	flags := pflag.NewFlagSet("uperf", pflag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	addUperfRunFlags(flags, opts)
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	return buildUperfBenchmark(opts, flags.Args())
+}
+
 func runUperf(cmd *cobra.Command, args []string) {
-	uperfCmdArgs := []string{
-		"uperf", "-m", args[0],
+	bench, err := buildUperfBenchmark(&uperfRun, args)
+	CheckError(err)
+	RunBenchmark("uperf", bench)
+}
+
+func runUperfParse(cmd *cobra.Command, args []string) {
+	if len(uperfReplayOptions.StdoutPath) == 0 && len(uperfReplayOptions.RunInfoPath) == 0 {
+		CheckError(fmt.Errorf("one of --stdout or --run-info is required"))
+	}
+	bench := &uperf.UperfReplayBenchmark{
+		Benchmark: uperf.UperfBenchmark{
+			WorkloadPath:    uperfOptions.WorkloadPath,
+			Vars:            uperfVars,
+			TolerantParsing: uperfOptions.TolerantParsing,
+		},
+		StdoutPath:  uperfReplayOptions.StdoutPath,
+		RunInfoPath: uperfReplayOptions.RunInfoPath,
+	}
+	if len(uperfReplayStartTime) > 0 {
+		start, err := time.Parse(time.RFC3339Nano, uperfReplayStartTime)
+		CheckError(err)
+		bench.StartTime = start
 	}
-	uperfCmdArgs = append(uperfCmdArgs, args[1:]...)
+	RunBenchmark("uperf", bench)
+}
+
+func runUperfRender(cmd *cobra.Command, args []string) {
+	profile, err := uperf.BuildPresetProfile(uperfPresetOptions)
+	CheckError(err)
+	rendered, err := uperf.RenderWorkloadXML(profile)
+	CheckError(err)
+	_, err = os.Stdout.Write(rendered)
+	CheckError(err)
+}
 
-	uperf := &uperf.UperfBenchmark{
-		WorkloadPath: args[0],
-		Cmd:          uperfCmdArgs,
+func runUperfValidate(cmd *cobra.Command, args []string) {
+	invalid := false
+	for _, workloadPath := range args {
+		workloadBytes, err := ioutil.ReadFile(workloadPath)
+		if err == nil {
+			workloadBytes, _, err = uperf.SubstituteWorkloadVars(workloadBytes, uperfVars)
+		}
+		if err == nil {
+			err = uperf.ValidateWorkloadXML(workloadBytes)
+		}
+		if err == nil {
+			fmt.Printf("%s: valid\n", workloadPath)
+			continue
+		}
+
+		invalid = true
+		var problems uperf.ValidationErrors
+		if errors.As(err, &problems) {
+			for _, problem := range problems {
+				location := fmt.Sprintf("%s:%d", workloadPath, problem.Line)
+				if len(problem.Element) > 0 {
+					location = fmt.Sprintf("%s: <%s>", location, problem.Element)
+				}
+				fmt.Fprintf(os.Stderr, "%s: %s\n", location, problem.Message)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", workloadPath, err)
+		}
+	}
+	if invalid {
+		os.Exit(1)
 	}
-	RunBenchmark(uperf)
 }
 
 // uperfCmd represents the uperf command
 var uperfCmd = &cobra.Command{
-	Use:   "uperf workload options ...",
+	Use:   "uperf [workload] options ...",
 	Short: "Run the uperf networking benchmark.",
-	Long:  `Uperf requires an xml file to define the workloads to run. This must be provided as the positional argument "workload". If you would like to pass CLI arguments to uperf, place them after the workload filename.`,
-	Args:  cobra.MinimumNArgs(1),
+	Long:  `Uperf requires an xml file to define the workloads to run. This must be provided as the positional argument "workload", unless a workload is generated with --preset. If you would like to pass CLI arguments to uperf, place them after the workload filename, or after '--' when using a preset.`,
+	Args:  cobra.ArbitraryArgs,
 	Run:   runUperf,
 }
 
+// uperfParseCmd represents the parse uperf command
+var uperfParseCmd = &cobra.Command{
+	Use:   "uperf",
+	Short: "Parse and export saved uperf output.",
+	Long:  `Parse uperf stdout saved from a previous run, given with --stdout, and export the results without running uperf. Alternatively, give a run info document exported by a previous run with --run-info, such as the output of --print-json or 'gobench fetch', to re-parse its stdout using the workload, variables and times it recorded. Giving the workload with --workload lets stats be attributed to the workload's groups and improves latency estimates. Pass --uuid to export the results under the original run's ID.`,
+	Args:  cobra.NoArgs,
+	Run:   runUperfParse,
+}
+
+// uperfToolsCmd groups uperf commands which don't run the benchmark.
+var uperfToolsCmd = &cobra.Command{
+	Use:   "uperf",
+	Short: "Work with uperf workloads without running the benchmark.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+		os.Exit(1)
+	},
+}
+
+// uperfRenderCmd represents the uperf render command
+var uperfRenderCmd = &cobra.Command{
+	Use: "render",
+	Annotations: map[string]string{
+		configNamespaceAnnotation: "uperf",
+	},
+	Short: "Print the workload xml generated from a preset.",
+	Long:  `Generate a uperf workload from the given preset options and print it to stdout, without running uperf.`,
+	Args:  cobra.NoArgs,
+	Run:   runUperfRender,
+}
+
+// uperfValidateCmd represents the uperf validate command
+var uperfValidateCmd = &cobra.Command{
+	Use: "validate workload ...",
+	Annotations: map[string]string{
+		configNamespaceAnnotation: "uperf",
+	},
+	Short: "Check uperf workload files for problems.",
+	Long:  `Check that each given workload file only uses flowops and options which uperf understands, printing each problem found along with its line number. Variables within the workload are substituted from --set and the environment before it is checked. Exits with a non-zero code if any workload is invalid.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run:   runUperfValidate,
+}
+
 func init() {
+	RegisterBenchmark("uperf", newUperfBenchmark)
 	runCmd.AddCommand(uperfCmd)
+	addUperfRunFlags(uperfCmd.Flags(), &uperfRun)
+
+	parseCmd.AddCommand(uperfParseCmd)
+	uperfParseCmd.Flags().StringVar(&uperfReplayOptions.StdoutPath, "stdout", "", "Path to uperf stdout saved from a previous run.")
+	uperfParseCmd.Flags().StringVar(&uperfReplayOptions.RunInfoPath, "run-info", "", `Path to json holding a run info document exported by a previous
+run, whose stdout, workload, variables and times are used.`)
+	uperfParseCmd.Flags().StringVar(&uperfOptions.WorkloadPath, "workload", "", "Path to the workload file the saved output was produced with.")
+	uperfParseCmd.Flags().StringVar(&uperfReplayStartTime, "start-time", "", `Time the saved run started, in RFC3339 format. Used to timestamp
+intervals which uperf printed without the raw format (-R).`)
+	addUperfVarsFlag(uperfParseCmd.Flags(), &uperfVars)
+	uperfParseCmd.Flags().BoolVar(&uperfOptions.TolerantParsing, "tolerant-parsing", false, `Skip lines of uperf's output which can't be parsed, rather than
+failing. The number of skipped lines is recorded in the run info.`)
+
+	rootCmd.AddCommand(uperfToolsCmd)
+	uperfToolsCmd.AddCommand(uperfRenderCmd)
+	addUperfPresetFlags(uperfRenderCmd.Flags(), &uperfPresetOptions)
+	uperfRenderCmd.MarkFlagRequired("preset")
+	uperfToolsCmd.AddCommand(uperfValidateCmd)
+	addUperfVarsFlag(uperfValidateCmd.Flags(), &uperfVars)
 }
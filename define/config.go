@@ -2,35 +2,54 @@
 package define
 
 import (
-	"sync"
+	"time"
 )
 
-// Config defines common runtime objects which need to be accessed by
-// other objects within gobench.
-// It uses a singleton pattern.
-// Reference: https://refactoring.guru/design-patterns/singleton/go/example
+// Config defines common runtime options which need to be accessed by
+// other objects within gobench, such as exporter settings. Create one with
+// NewConfig.
+// CampaignID groups together runs which were started by the same scenario.
+// Timeout bounds how long a benchmark may run for, with zero meaning no
+// limit. Benchmarks stop their run once it has passed.
 type Config struct {
 	Verbose                          bool
 	Quiet                            bool
 	RunID                            string
+	CampaignID                       string
+	Timeout                          time.Duration
+	Tags                             map[string]string
 	PrintJson                        bool
+	ExportFailurePolicy              string
+	ReportPath                       string
+	ArtifactsDir                     string
+	DisableArtifacts                 bool
+	BestEffortExporters              []string
 	ElasticsearchURL                 string
 	ElasticsearchIndex               string
+	ElasticsearchDataStream          bool
 	ElasticsearchSkipVerify          bool
+	ElasticsearchCACert              string
+	ElasticsearchUsername            string
+	ElasticsearchPassword            string
 	ElasticsearchInjectProductHeader bool
+	OpenSearchURL                    string
+	OpenSearchIndex                  string
+	OpenSearchDataStream             bool
+	OpenSearchSkipVerify             bool
+	OpenSearchCACert                 string
+	OpenSearchUsername               string
+	OpenSearchPassword               string
+	OpenSearchMappingPath            string
 }
 
-var configLock = &sync.Mutex{}
-var configInstance *Config
-
-// Get returns the current Config instance.
-func GetConfig() *Config {
-	if configInstance == nil {
-		configLock.Lock()
-		defer configLock.Unlock()
-		if configInstance == nil {
-			configInstance = &Config{}
-		}
+// NewConfig returns a new Config holding gobench's defaults, which match the
+// defaults of its command line flags. Each run can be given its own Config,
+// so runs with different options can happen within the same process.
+func NewConfig() *Config {
+	return &Config{
+		Tags:                             map[string]string{},
+		ExportFailurePolicy:              string(ExportFailurePolicyAny),
+		BestEffortExporters:              []string{},
+		ElasticsearchInjectProductHeader: true,
 	}
-	return configInstance
 }
@@ -2,23 +2,23 @@ package define
 
 import "testing"
 
-// TestGetConfig tests that GetConfig always returns the same object,
-// enforcing the single pattern. It does this by calling GetConfig,
-// modifying the returned object, then calling GetConfig again to see if
-// the modifications stuck.
-func TestGetConfig(t *testing.T) {
-	var ctx *Config = GetConfig()
-	if ctx == nil {
-		t.Fatal("First call to GetConfig() is nil, want Config Object.")
+// TestNewConfig tests that NewConfig returns a separate Config each time,
+// holding the defaults of gobench's command line flags. It does this by
+// modifying the first Config returned, then checking that the second still
+// holds the defaults.
+func TestNewConfig(t *testing.T) {
+	first := NewConfig()
+	if first == nil {
+		t.Fatal("First call to NewConfig() is nil, want Config Object.")
 	}
-	var verboseBefore bool = ctx.Verbose
-	ctx.Verbose = !verboseBefore
-	ctx = GetConfig()
-	if ctx.Verbose == verboseBefore {
-		t.Fatalf(
-			"Expected changing Config.Verbose from %t to %t would stick across calls to GetConfig()",
-			verboseBefore,
-			!verboseBefore,
-		)
+	first.Verbose = true
+	first.Tags["team"] = "perf"
+
+	second := NewConfig()
+	if second.Verbose || len(second.Tags) != 0 {
+		t.Fatalf("Expected changes to one Config to not affect another, instead got %+v", second)
+	}
+	if second.ExportFailurePolicy != string(ExportFailurePolicyAny) || !second.ElasticsearchInjectProductHeader {
+		t.Errorf("Expected Config to hold the default options, instead got %+v", second)
 	}
 }
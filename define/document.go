@@ -0,0 +1,65 @@
+// document.go defines items which describe the payloads benchmarks export.
+package define
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Document defines methods needed by payloads which benchmarks hand to an Exporterable.
+// Exporters which can't work with arbitrary nested json, such as those for
+// csv or time-series databases, can rely on these methods rather than
+// inspecting payloads themselves.
+type Document interface {
+	// BenchmarkName returns the name of the benchmark which produced the Document.
+	BenchmarkName() string
+	// DocumentKind returns the kind of data held within the Document, such as
+	// the section of benchmark output it was parsed from.
+	DocumentKind() string
+	// DocumentTimestamp returns when the data within the Document was recorded.
+	// If this isn't known, then the zero time is returned.
+	DocumentTimestamp() time.Time
+	// SetMetadata attaches the given Metadata to the Document.
+	SetMetadata(*Metadata)
+	// Fields returns the data within the Document as a flat map, with the
+	// keys of nested objects joined by dots, ie `Metadata.RunID`.
+	Fields() (map[string]interface{}, error)
+}
+
+// FlattenFields marshals the given payload to json and flattens the result
+// into a map, joining the keys of nested objects with dots.
+// Numbers are returned as a json.Number to avoid losing precision.
+// Arrays are kept as-is.
+func FlattenFields(payload interface{}) (map[string]interface{}, error) {
+	marshalled, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(marshalled))
+	decoder.UseNumber()
+	var decoded map[string]interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	flattenInto(fields, "", decoded)
+	return fields, nil
+}
+
+// flattenInto adds each value in the given map into fields, prefixing its key
+// with the given prefix. Nested maps are flattened recursively.
+func flattenInto(fields map[string]interface{}, prefix string, nested map[string]interface{}) {
+	for key, value := range nested {
+		if len(prefix) > 0 {
+			key = prefix + "." + key
+		}
+		if child, ok := value.(map[string]interface{}); ok {
+			flattenInto(fields, key, child)
+			continue
+		}
+		fields[key] = value
+	}
+}
@@ -0,0 +1,43 @@
+package define
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestFlattenFields checks that nested objects are flattened into dotted
+// keys, and that numbers and arrays are kept intact.
+func TestFlattenFields(t *testing.T) {
+	payload := struct {
+		Name     string
+		Metadata *Metadata
+		Bytes    int64
+		Hosts    []string
+	}{
+		Name:     "Txn2",
+		Metadata: &Metadata{RunID: "abc-123", Benchmark: "uperf"},
+		Bytes:    79955230720,
+		Hosts:    []string{"a", "b"},
+	}
+
+	fields, err := FlattenFields(payload)
+	if err != nil {
+		t.Fatalf("Unexpected error while flattening fields: %s", err)
+	}
+
+	if fields["Name"] != "Txn2" {
+		t.Errorf("Expected Name to be Txn2, instead got %v", fields["Name"])
+	}
+	if fields["Metadata.RunID"] != "abc-123" {
+		t.Errorf("Expected Metadata.RunID to be abc-123, instead got %v", fields["Metadata.RunID"])
+	}
+	if _, ok := fields["Metadata"]; ok {
+		t.Errorf("Expected Metadata to be flattened, instead got %v", fields["Metadata"])
+	}
+	if fields["Bytes"] != json.Number("79955230720") {
+		t.Errorf("Expected Bytes to be 79955230720, instead got %v", fields["Bytes"])
+	}
+	if hosts, ok := fields["Hosts"].([]interface{}); !ok || len(hosts) != 2 {
+		t.Errorf("Expected Hosts to be kept as an array, instead got %v", fields["Hosts"])
+	}
+}
@@ -5,24 +5,42 @@ import "time"
 
 // Metadata is a struct intended to be used by benchmarks to apply
 // common metadata options to their payloads.
+// Timestamp is marshalled in RFC3339 format with nanoseconds, and TimestampMS
+// holds the same time as milliseconds since the unix epoch.
+// Tags holds user-defined labels for the run, such as the parameters of a sweep.
+// CampaignID is shared by every run within a scenario, see `gobench scenario run`.
 type Metadata struct {
-	RunID     string
-	Timestamp int64
+	RunID       string
+	CampaignID  string `json:",omitempty"`
+	Benchmark   string
+	Timestamp   time.Time
+	TimestampMS int64
+	Tags        map[string]string `json:",omitempty"`
 }
 
 // GetMetadataPayload constructs a new Metadata struct from the given Config instance.
 func GetMetadataPayload(cfg *Config) Metadata {
-	return Metadata{
-		RunID:     cfg.RunID,
-		Timestamp: time.Now().Unix(),
+	now := time.Now().UTC()
+	metadata := Metadata{
+		RunID:       cfg.RunID,
+		CampaignID:  cfg.CampaignID,
+		Timestamp:   now,
+		TimestampMS: now.UnixMilli(),
 	}
+	if len(cfg.Tags) > 0 {
+		metadata.Tags = map[string]string{}
+		for key, value := range cfg.Tags {
+			metadata.Tags[key] = value
+		}
+	}
+	return metadata
 }
 
 // Exporterable defines methods needed by concrete Exporter objects.
-// It is assumed that Exporterable objects are created with the intention
-// of being added into the current runtime's Config.
+// Exporterable objects are given the Config of the run they export results
+// for within Setup.
 type Exporterable interface {
-	// Setup takes current Config and gets the Exporter ready to export data.
+	// Setup takes the run's Config and gets the Exporter ready to export data.
 	// As an example, this could create a goroutine and some channels to
 	// perform async export in the background.
 	Setup(*Config) error
@@ -36,4 +54,10 @@ type Exporterable interface {
 	// Export takes the given byte string (assumed to be marshaled) and exports
 	// it. Differenc exporters can choose whether to make this async or sync.
 	Export([]byte) error
+	// Flush blocks until every payload given to Export so far has been
+	// handled, without closing the Exporter down.
+	Flush() error
+	// Report summarizes the payloads the Exporter has handled so far.
+	// Exporters which wrap other exporters return one report for each.
+	Report() []*ExportReport
 }
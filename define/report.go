@@ -0,0 +1,114 @@
+// report.go defines items which summarize how the export of benchmark data went.
+package define
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExportFailure describes a single document which could not be exported.
+type ExportFailure struct {
+	Document string
+	Reason   string
+}
+
+// ExportReport summarizes the documents handled by an exporter.
+// BestEffort is set for exporters whose errors are logged rather than
+// failing the run, so their failed documents are ignored by every
+// ExportFailurePolicy. Error is set for exporters which were disabled during
+// the run, such as a best-effort exporter which failed to setup.
+type ExportReport struct {
+	Exporter          string
+	BestEffort        bool   `json:",omitempty"`
+	Error             string `json:",omitempty"`
+	Metadata          *Metadata
+	NumAdded          uint64
+	NumFlushed        uint64
+	NumIndexed        uint64
+	NumFailed         uint64
+	NumRequests       uint64
+	LatencySeconds    float64
+	MaxLatencySeconds float64
+	Failures          []ExportFailure `json:",omitempty"`
+}
+
+// AddLatency records the time it took for a request sending documents to finish.
+func (er *ExportReport) AddLatency(latency time.Duration) {
+	er.NumRequests++
+	er.LatencySeconds += latency.Seconds()
+	if latency.Seconds() > er.MaxLatencySeconds {
+		er.MaxLatencySeconds = latency.Seconds()
+	}
+}
+
+// AddFailure records a document which could not be exported.
+func (er *ExportReport) AddFailure(document []byte, reason string) {
+	er.Failures = append(
+		er.Failures,
+		ExportFailure{
+			Document: string(document),
+			Reason:   reason,
+		},
+	)
+}
+
+// ExportFailurePolicy determines whether or not failing to export documents
+// should be treated as an error.
+type ExportFailurePolicy string
+
+const (
+	// ExportFailurePolicyAny fails if any document could not be exported.
+	ExportFailurePolicyAny ExportFailurePolicy = "any"
+	// ExportFailurePolicyAll fails only if an exporter could not export
+	// any of its documents.
+	ExportFailurePolicyAll ExportFailurePolicy = "all"
+	// ExportFailurePolicyNever never fails due to documents which could not
+	// be exported.
+	ExportFailurePolicyNever ExportFailurePolicy = "never"
+)
+
+// ParseExportFailurePolicy checks that the given string is a known ExportFailurePolicy.
+// If the given string is empty, ExportFailurePolicyAny is returned.
+func ParseExportFailurePolicy(policy string) (ExportFailurePolicy, error) {
+	switch ExportFailurePolicy(policy) {
+	case "":
+		return ExportFailurePolicyAny, nil
+	case ExportFailurePolicyAny, ExportFailurePolicyAll, ExportFailurePolicyNever:
+		return ExportFailurePolicy(policy), nil
+	default:
+		return "", fmt.Errorf(
+			"unknown export failure policy %s, expected one of %s, %s or %s",
+			policy, ExportFailurePolicyAny, ExportFailurePolicyAll, ExportFailurePolicyNever,
+		)
+	}
+}
+
+// Check returns an error if the given reports violate the policy. Reports
+// from best-effort exporters are skipped.
+func (p ExportFailurePolicy) Check(reports []*ExportReport) error {
+	failed := []string{}
+	for _, report := range reports {
+		if report.NumFailed == 0 || report.BestEffort {
+			continue
+		}
+		if p == ExportFailurePolicyAny ||
+			(p == ExportFailurePolicyAll && report.NumFailed >= report.NumAdded) {
+			failed = append(
+				failed,
+				fmt.Sprintf(
+					"%s (%d/%d failed)",
+					report.Exporter, report.NumFailed, report.NumAdded,
+				),
+			)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf(
+			"documents failed to export under the '%s' failure policy: %s",
+			p, strings.Join(failed, ", "),
+		)
+	}
+	return nil
+}
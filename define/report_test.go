@@ -0,0 +1,62 @@
+package define
+
+import "testing"
+
+// TestExportFailurePolicyCheck checks that each ExportFailurePolicy only
+// returns an error for the reports it considers failed.
+func TestExportFailurePolicyCheck(t *testing.T) {
+	noFailures := []*ExportReport{{Exporter: "json", NumAdded: 2, NumIndexed: 2}}
+	someFailures := []*ExportReport{{Exporter: "elasticsearch", NumAdded: 2, NumIndexed: 1, NumFailed: 1}}
+	allFailures := []*ExportReport{{Exporter: "elasticsearch", NumAdded: 2, NumFailed: 2}}
+	bestEffortFailures := []*ExportReport{{Exporter: "elasticsearch", BestEffort: true, NumAdded: 2, NumFailed: 2}}
+
+	tests := []struct {
+		policy    ExportFailurePolicy
+		reports   []*ExportReport
+		expectErr bool
+	}{
+		{ExportFailurePolicyAny, noFailures, false},
+		{ExportFailurePolicyAny, someFailures, true},
+		{ExportFailurePolicyAny, allFailures, true},
+		{ExportFailurePolicyAll, noFailures, false},
+		{ExportFailurePolicyAll, someFailures, false},
+		{ExportFailurePolicyAll, allFailures, true},
+		{ExportFailurePolicyNever, noFailures, false},
+		{ExportFailurePolicyNever, someFailures, false},
+		{ExportFailurePolicyNever, allFailures, false},
+		{ExportFailurePolicyAny, bestEffortFailures, false},
+		{ExportFailurePolicyAll, bestEffortFailures, false},
+	}
+
+	for _, test := range tests {
+		err := test.policy.Check(test.reports)
+		if test.expectErr && err == nil {
+			t.Errorf(
+				"Expected policy %s to return error for reports %+v, instead got nil",
+				test.policy, *test.reports[0],
+			)
+		} else if !test.expectErr && err != nil {
+			t.Errorf(
+				"Expected policy %s to not return error for reports %+v, instead got: %s",
+				test.policy, *test.reports[0], err,
+			)
+		}
+	}
+}
+
+// TestParseExportFailurePolicy checks that known policies are parsed, an empty
+// policy defaults to ExportFailurePolicyAny and unknown policies return an error.
+func TestParseExportFailurePolicy(t *testing.T) {
+	policy, err := ParseExportFailurePolicy("")
+	if err != nil || policy != ExportFailurePolicyAny {
+		t.Errorf("Expected empty policy to default to any, instead got %s, %v", policy, err)
+	}
+	policy, err = ParseExportFailurePolicy("never")
+	if err != nil || policy != ExportFailurePolicyNever {
+		t.Errorf("Expected policy never to be parsed, instead got %s, %v", policy, err)
+	}
+	_, err = ParseExportFailurePolicy("sometimes")
+	if err == nil {
+		t.Error("Expected error parsing unknown policy, instead got nil")
+	}
+}
@@ -0,0 +1,86 @@
+// timeline.go defines items which record when each stage of a run happened.
+package define
+
+import (
+	"sync"
+	"time"
+)
+
+// TimelineEventType names a point within the lifecycle of a run.
+type TimelineEventType string
+
+const (
+	TimelineSetupStart       TimelineEventType = "setup_start"
+	TimelineSetupEnd         TimelineEventType = "setup_end"
+	TimelineBenchmarkStart   TimelineEventType = "benchmark_start"
+	TimelineBenchmarkEnd     TimelineEventType = "benchmark_end"
+	TimelineExportFlushStart TimelineEventType = "export_flush_start"
+	TimelineExportFlushEnd   TimelineEventType = "export_flush_end"
+)
+
+// DocumentKindTimeline is the kind given to TimelineEvent documents.
+const DocumentKindTimeline string = "timeline"
+
+// TimelineEvent records the time a point within the lifecycle of a run was reached.
+// It implements the Document interface, so it can be exported alongside
+// benchmark results and lined up against external metrics.
+type TimelineEvent struct {
+	Metadata    *Metadata
+	SectionType string
+	Event       TimelineEventType
+	Timestamp   time.Time
+	TimestampMS int64
+}
+
+// BenchmarkName returns the benchmark within the event's Metadata, or an
+// empty string if the Metadata hasn't been set.
+func (te *TimelineEvent) BenchmarkName() string {
+	if te.Metadata == nil {
+		return ""
+	}
+	return te.Metadata.Benchmark
+}
+
+// DocumentKind returns DocumentKindTimeline.
+func (te *TimelineEvent) DocumentKind() string { return DocumentKindTimeline }
+
+// DocumentTimestamp returns the time the event was recorded.
+func (te *TimelineEvent) DocumentTimestamp() time.Time { return te.Timestamp }
+
+// SetMetadata attaches the run's Metadata to the event.
+func (te *TimelineEvent) SetMetadata(metadata *Metadata) { te.Metadata = metadata }
+
+// Fields returns the event flattened by FlattenFields.
+func (te *TimelineEvent) Fields() (map[string]interface{}, error) {
+	return FlattenFields(te)
+}
+
+// Timeline collects TimelineEvents in the order they are recorded.
+// It is safe to record events from multiple goroutines.
+type Timeline struct {
+	events []*TimelineEvent
+	lock   sync.Mutex
+}
+
+// Record adds a new TimelineEvent of the given type, using the current time.
+func (tl *Timeline) Record(event TimelineEventType) *TimelineEvent {
+	now := time.Now().UTC()
+	timelineEvent := &TimelineEvent{
+		SectionType: DocumentKindTimeline,
+		Event:       event,
+		Timestamp:   now,
+		TimestampMS: now.UnixMilli(),
+	}
+
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+	tl.events = append(tl.events, timelineEvent)
+	return timelineEvent
+}
+
+// Events returns each TimelineEvent recorded so far.
+func (tl *Timeline) Events() []*TimelineEvent {
+	tl.lock.Lock()
+	defer tl.lock.Unlock()
+	return append([]*TimelineEvent{}, tl.events...)
+}
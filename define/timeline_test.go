@@ -0,0 +1,36 @@
+package define
+
+import (
+	"testing"
+)
+
+// TestTimelineRecord checks that events are kept in the order they are
+// recorded, with matching RFC3339 and millisecond timestamps.
+func TestTimelineRecord(t *testing.T) {
+	timeline := Timeline{}
+	expected := []TimelineEventType{
+		TimelineSetupStart, TimelineSetupEnd, TimelineBenchmarkStart, TimelineBenchmarkEnd,
+	}
+	for _, event := range expected {
+		timeline.Record(event)
+	}
+
+	events := timeline.Events()
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, instead got %d", len(expected), len(events))
+	}
+	for i, event := range events {
+		if event.Event != expected[i] {
+			t.Errorf("Expected event %d to be %s, instead got %s", i, expected[i], event.Event)
+		}
+		if event.TimestampMS != event.Timestamp.UnixMilli() {
+			t.Errorf(
+				"Expected TimestampMS %d to match Timestamp %s",
+				event.TimestampMS, event.Timestamp,
+			)
+		}
+		if i > 0 && event.Timestamp.Before(events[i-1].Timestamp) {
+			t.Errorf("Expected event %s to be recorded after %s", event.Event, events[i-1].Event)
+		}
+	}
+}
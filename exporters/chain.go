@@ -1,36 +1,163 @@
 package exporters
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
 	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+)
+
+// ChainPolicy determines how the ChainExporter treats errors returned by one of its exporters.
+type ChainPolicy string
+
+const (
+	// ChainPolicyRequired causes errors from the exporter to be returned by the ChainExporter.
+	ChainPolicyRequired ChainPolicy = "required"
+	// ChainPolicyBestEffort causes errors from the exporter to be logged and ignored.
+	// If the exporter fails to setup or pass its healthcheck, it is skipped for the rest of the run.
+	ChainPolicyBestEffort ChainPolicy = "best-effort"
 )
 
+// ChainMemberError holds the error returned by a single exporter within a ChainExporter.
+type ChainMemberError struct {
+	Exporter string
+	Err      error
+}
+
+// ChainError lists each exporter within a ChainExporter which returned an error.
+type ChainError struct {
+	Errors []ChainMemberError
+}
+
+// Error joins together the error of each failed exporter.
+func (ce *ChainError) Error() string {
+	messages := []string{}
+	for _, memberErr := range ce.Errors {
+		messages = append(
+			messages, fmt.Sprintf("%s: %s", memberErr.Exporter, memberErr.Err),
+		)
+	}
+	return fmt.Sprintf(
+		"%d exporter(s) failed: %s", len(ce.Errors), strings.Join(messages, "; "),
+	)
+}
+
 // ChainExporter is used to allow for multiple exporters to function through one Expoerterable interface.
-// It's important to initiate Exporters and marshalled appropriately
+// Each exporter is given a ChainPolicy through the Policies field, matched by index.
+// Exporters without a policy are treated as ChainPolicyRequired.
 type ChainExporter struct {
 	Exporters  []define.Exporterable
-	Marshalled [][]byte
+	Policies   []ChainPolicy
+	marshalled [][]byte
+	disabled   []error
+	// lock guards marshalled and disabled
+	lock sync.Mutex
 }
 
-// doLoop loops through each Exporterable the ChainExporter is configured with and passes it to the given function.
-// If an error is returned by the function, then the loop breaks and the error is returned.
+// exporterName returns a human-readable name for the given exporter, based on its type.
+func exporterName(e define.Exporterable) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", e), "*exporters.")
+}
+
+// policy returns the ChainPolicy for the exporter at the given index.
+func (ce *ChainExporter) policy(i int) ChainPolicy {
+	if i < len(ce.Policies) && ce.Policies[i] == ChainPolicyBestEffort {
+		return ChainPolicyBestEffort
+	}
+	return ChainPolicyRequired
+}
+
+// disabledErr returns the error which caused the exporter at the given index
+// to be skipped, such as a failure during setup, or nil if it is enabled.
+func (ce *ChainExporter) disabledErr(i int) error {
+	ce.lock.Lock()
+	defer ce.lock.Unlock()
+	if i < len(ce.disabled) {
+		return ce.disabled[i]
+	}
+	return nil
+}
+
+// doLoop passes each enabled Exporterable the ChainExporter is configured with to the given function.
+// Every exporter is visited, even if one returns an error. If concurrent is true,
+// then the function is called for each exporter at the same time.
+// Errors from best-effort exporters are logged, and if disableOnError is true,
+// the exporter is skipped from then on. Errors from required exporters are
+// returned together as a ChainError.
 func (ce *ChainExporter) doLoop(
-	loopFunc func(define.Exporterable, int) error,
+	loopFunc func(define.Exporterable, int) error, concurrent bool, disableOnError bool,
 ) error {
-	for i, exporter := range ce.Exporters {
+	var (
+		wg       sync.WaitGroup
+		errsLock sync.Mutex
+		errs     []ChainMemberError = []ChainMemberError{}
+	)
+
+	ce.lock.Lock()
+	if len(ce.disabled) != len(ce.Exporters) {
+		ce.disabled = make([]error, len(ce.Exporters))
+	}
+	ce.lock.Unlock()
+
+	visit := func(exporter define.Exporterable, i int) {
 		err := loopFunc(exporter, i)
-		if err != nil {
-			return err
+		if err == nil {
+			return
+		}
+
+		name := exporterName(exporter)
+		if ce.policy(i) == ChainPolicyBestEffort {
+			log.Warn().
+				Err(err).
+				Str("exporter", name).
+				Bool("disabled", disableOnError).
+				Msg("Best-effort exporter failed, continuing without it.")
+			if disableOnError {
+				ce.lock.Lock()
+				ce.disabled[i] = err
+				ce.lock.Unlock()
+			}
+			return
 		}
+
+		errsLock.Lock()
+		defer errsLock.Unlock()
+		errs = append(errs, ChainMemberError{Exporter: name, Err: err})
+	}
+
+	for i, exporter := range ce.Exporters {
+		if ce.disabledErr(i) != nil {
+			continue
+		}
+		if concurrent {
+			wg.Add(1)
+			go func(exporter define.Exporterable, i int) {
+				defer wg.Done()
+				visit(exporter, i)
+			}(exporter, i)
+		} else {
+			visit(exporter, i)
+		}
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &ChainError{Errors: errs}
 	}
 	return nil
 }
 
 // Setup calls the Setup method on each Exporterable the ChainExporter is configured with.
 func (ce *ChainExporter) Setup(cfg *define.Config) error {
+	ce.lock.Lock()
+	ce.disabled = make([]error, len(ce.Exporters))
+	ce.lock.Unlock()
 	return ce.doLoop(
 		func(e define.Exporterable, i int) error {
 			return e.Setup(cfg)
-		},
+		}, false, true,
 	)
 }
 
@@ -39,7 +166,7 @@ func (ce *ChainExporter) Healthcheck() error {
 	return ce.doLoop(
 		func(e define.Exporterable, i int) error {
 			return e.Healthcheck()
-		},
+		}, true, true,
 	)
 }
 
@@ -48,37 +175,83 @@ func (ce *ChainExporter) Teardown() error {
 	return ce.doLoop(
 		func(e define.Exporterable, i int) error {
 			return e.Teardown()
-		},
+		}, false, false,
 	)
 }
 
 // Marshal calls the Marshal method on each Exporterable the ChainExporter is configured with.
 // Rather than returning the results of each marshal, they are saved in a slice within the ChainExporter.
 // An empty byte array is returned.
-// The Exporter function will use these results while exporting payloads.
-// This function is ripe for a runtime panic if the `marshalled` field is not
-// preallocated to match the length of the number of configured exporters.
+// The Export function will use these results while exporting payloads. Only
+// the last results are kept, so each call to Marshal must be followed by its
+// call to Export before the next payload is marshalled, even if they are
+// called from different goroutines.
 func (ce *ChainExporter) Marshal(payload interface{}) ([]byte, error) {
+	marshalled := make([][]byte, len(ce.Exporters))
 	err := ce.doLoop(
 		func(e define.Exporterable, i int) error {
-			marshalled, _err := e.Marshal(payload)
+			result, _err := e.Marshal(payload)
 			if _err != nil {
 				return _err
 			}
-			ce.Marshalled[i] = marshalled
+			marshalled[i] = result
 			return nil
-		},
+		}, false, false,
 	)
+	ce.lock.Lock()
+	ce.marshalled = marshalled
+	ce.lock.Unlock()
 	return []byte{}, err
 }
 
-// Export calls the Export method on each Exporterable the ChainExporter is configured with, using the saved payloads from Marshal.
-// This assumes that the ChainExporter's Marshal method has already been called.
-// Otherwise, an out-of-bound slice error might be raised.
+// Export calls the Export method on each Exporterable the ChainExporter is configured with
+// concurrently, using the saved payloads from Marshal.
+// Exporters which do not have a saved payload, such as when Marshal failed for
+// a best-effort exporter, are skipped.
 func (ce *ChainExporter) Export(payload []byte) error {
+	ce.lock.Lock()
+	marshalled := ce.marshalled
+	ce.lock.Unlock()
 	return ce.doLoop(
 		func(e define.Exporterable, i int) error {
-			return e.Export(ce.Marshalled[i])
-		},
+			if i >= len(marshalled) || marshalled[i] == nil {
+				return nil
+			}
+			return e.Export(marshalled[i])
+		}, true, false,
 	)
 }
+
+// Flush calls the Flush method on each Exporterable the ChainExporter is configured with concurrently.
+func (ce *ChainExporter) Flush() error {
+	return ce.doLoop(
+		func(e define.Exporterable, i int) error {
+			return e.Flush()
+		}, true, false,
+	)
+}
+
+// Report joins together the reports of each Exporterable the ChainExporter is configured with.
+// Reports from best-effort exporters are marked as BestEffort, so their failed
+// documents don't fail the run.
+// Exporters which were disabled are still reported, with the error which
+// disabled them. If such an exporter has no report of its own, then an empty
+// one is given in its place.
+func (ce *ChainExporter) Report() []*define.ExportReport {
+	reports := []*define.ExportReport{}
+	for i, exporter := range ce.Exporters {
+		exporterReports := exporter.Report()
+		disabledErr := ce.disabledErr(i)
+		if disabledErr != nil && len(exporterReports) == 0 {
+			exporterReports = []*define.ExportReport{{Exporter: exporterName(exporter)}}
+		}
+		for _, report := range exporterReports {
+			report.BestEffort = ce.policy(i) == ChainPolicyBestEffort
+			if disabledErr != nil {
+				report.Error = disabledErr.Error()
+			}
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
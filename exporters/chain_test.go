@@ -1,6 +1,10 @@
 package exporters
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/learnitall/gobench/define"
@@ -21,3 +25,180 @@ func TestChainExporterImplementsExporterInterface(t *testing.T) {
 		)
 	}
 }
+
+// chainTestExporter is a simple Exporterable used to test the ChainExporter.
+// If err is set, then every method which returns an error returns it.
+type chainTestExporter struct {
+	err      error
+	lock     sync.Mutex
+	exported [][]byte
+}
+
+func (cte *chainTestExporter) Setup(cfg *define.Config) error {
+	return cte.err
+}
+
+func (cte *chainTestExporter) Healthcheck() error {
+	return cte.err
+}
+
+func (cte *chainTestExporter) Marshal(payload interface{}) ([]byte, error) {
+	return []byte(fmt.Sprintf("%v", payload)), nil
+}
+
+func (cte *chainTestExporter) Export(payload []byte) error {
+	cte.lock.Lock()
+	defer cte.lock.Unlock()
+	cte.exported = append(cte.exported, payload)
+	return cte.err
+}
+
+func (cte *chainTestExporter) Flush() error {
+	return cte.err
+}
+
+func (cte *chainTestExporter) Report() []*define.ExportReport {
+	return []*define.ExportReport{{Exporter: "test"}}
+}
+
+func (cte *chainTestExporter) Teardown() error {
+	return cte.err
+}
+
+// TestChainExporterDoesNotNeedPreallocation checks that the ChainExporter
+// can marshal and export payloads without any buffers being given to it.
+func TestChainExporterDoesNotNeedPreallocation(t *testing.T) {
+	first := &chainTestExporter{}
+	second := &chainTestExporter{}
+	ce := &ChainExporter{Exporters: []define.Exporterable{first, second}}
+
+	if _, err := ce.Marshal("payload"); err != nil {
+		t.Errorf("Expected no error from Marshal, instead got %s", err)
+	}
+	if err := ce.Export([]byte{}); err != nil {
+		t.Errorf("Expected no error from Export, instead got %s", err)
+	}
+	for _, exporter := range []*chainTestExporter{first, second} {
+		if len(exporter.exported) != 1 || string(exporter.exported[0]) != "payload" {
+			t.Errorf(
+				"Expected each exporter to export 'payload', instead got %q",
+				exporter.exported,
+			)
+		}
+	}
+}
+
+// TestChainExporterContinuesAfterRequiredError checks that an error from one
+// exporter doesn't stop the others, and that the returned ChainError lists
+// the exporter which failed.
+func TestChainExporterContinuesAfterRequiredError(t *testing.T) {
+	failing := &chainTestExporter{err: errors.New("node unavailable")}
+	working := &chainTestExporter{}
+	ce := &ChainExporter{Exporters: []define.Exporterable{failing, working}}
+
+	ce.Marshal("payload")
+	err := ce.Export([]byte{})
+	if err == nil {
+		t.Fatalf("Expected an error from Export, instead got nil")
+	}
+	chainErr, ok := err.(*ChainError)
+	if !ok {
+		t.Fatalf("Expected a *ChainError, instead got %T", err)
+	}
+	if len(chainErr.Errors) != 1 || chainErr.Errors[0].Exporter != "chainTestExporter" {
+		t.Errorf(
+			"Expected one error from chainTestExporter, instead got %v",
+			chainErr.Errors,
+		)
+	}
+	if !strings.Contains(err.Error(), "node unavailable") {
+		t.Errorf("Expected error to contain cause, instead got %s", err)
+	}
+	if len(working.exported) != 1 {
+		t.Errorf(
+			"Expected working exporter to still export, instead got %d payloads",
+			len(working.exported),
+		)
+	}
+}
+
+// TestChainExporterBestEffort checks that errors from best-effort exporters
+// are not returned, and that a best-effort exporter which fails setup is
+// skipped afterwards, but still reported.
+func TestChainExporterBestEffort(t *testing.T) {
+	failing := &chainTestExporter{err: errors.New("node unavailable")}
+	working := &chainTestExporter{}
+	ce := &ChainExporter{
+		Exporters: []define.Exporterable{failing, working},
+		Policies:  []ChainPolicy{ChainPolicyBestEffort},
+	}
+
+	if err := ce.Setup(&define.Config{}); err != nil {
+		t.Errorf("Expected no error from Setup, instead got %s", err)
+	}
+	ce.Marshal("payload")
+	if err := ce.Export([]byte{}); err != nil {
+		t.Errorf("Expected no error from Export, instead got %s", err)
+	}
+	if len(failing.exported) != 0 {
+		t.Errorf(
+			"Expected disabled exporter to be skipped, instead got %d payloads",
+			len(failing.exported),
+		)
+	}
+	if len(working.exported) != 1 {
+		t.Errorf(
+			"Expected working exporter to export, instead got %d payloads",
+			len(working.exported),
+		)
+	}
+	reports := ce.Report()
+	if len(reports) != 2 {
+		t.Fatalf("Expected a report for each exporter, instead got %d", len(reports))
+	}
+	if !reports[0].BestEffort || reports[0].Error != "node unavailable" {
+		t.Errorf("Expected disabled exporter's report to be best-effort with its error, instead got %+v", reports[0])
+	}
+	if reports[1].Error != "" {
+		t.Errorf("Expected working exporter's report to have no error, instead got %+v", reports[1])
+	}
+}
+
+// TestChainExporterReportMarksBestEffort checks that reports from best-effort
+// exporters are marked, so their failed documents don't fail the run.
+func TestChainExporterReportMarksBestEffort(t *testing.T) {
+	ce := &ChainExporter{
+		Exporters: []define.Exporterable{&chainTestExporter{}, &chainTestExporter{}},
+		Policies:  []ChainPolicy{ChainPolicyRequired, ChainPolicyBestEffort},
+	}
+	reports := ce.Report()
+	if len(reports) != 2 || reports[0].BestEffort || !reports[1].BestEffort {
+		t.Errorf("Expected only the second report to be best-effort, instead got %+v, %+v", reports[0], reports[1])
+	}
+}
+
+// chainTestUnreportedExporter is a chainTestExporter without a report.
+type chainTestUnreportedExporter struct {
+	chainTestExporter
+}
+
+func (ctue *chainTestUnreportedExporter) Report() []*define.ExportReport {
+	return nil
+}
+
+// TestChainExporterReportDisabledWithoutReport checks that a disabled
+// exporter without a report of its own is still reported.
+func TestChainExporterReportDisabledWithoutReport(t *testing.T) {
+	failing := &chainTestUnreportedExporter{}
+	failing.err = errors.New("node unavailable")
+	ce := &ChainExporter{
+		Exporters: []define.Exporterable{failing},
+		Policies:  []ChainPolicy{ChainPolicyBestEffort},
+	}
+	ce.Setup(&define.Config{})
+	reports := ce.Report()
+	if len(reports) != 1 || reports[0].Exporter != "chainTestUnreportedExporter" ||
+		!reports[0].BestEffort || reports[0].Error != "node unavailable" {
+		t.Errorf("Expected a best-effort report with the setup error, instead got %+v", reports)
+	}
+}
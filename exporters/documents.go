@@ -0,0 +1,97 @@
+package exporters
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// DocumentsExporter writes each document to the file at Path, one compact json
+// document per line, so the documents exported during a run are kept
+// alongside its other artifacts.
+type DocumentsExporter struct {
+	Path       string
+	file       *os.File
+	writer     *bufio.Writer
+	numAdded   uint64
+	numFlushed uint64
+}
+
+// Setup creates the file documents are written to, replacing any existing file.
+func (de *DocumentsExporter) Setup(cfg *define.Config) error {
+	file, err := os.Create(de.Path)
+	if err != nil {
+		return fmt.Errorf("unable to create documents file %s: %s", de.Path, err)
+	}
+	de.file = file
+	de.writer = bufio.NewWriter(file)
+	de.numAdded = 0
+	de.numFlushed = 0
+	return nil
+}
+
+// Healthcheck returns nil, the file is checked when it is created during Setup.
+func (de *DocumentsExporter) Healthcheck() error {
+	return nil
+}
+
+// Marshal turns the given payload into compact json, so it fits on one line.
+func (de *DocumentsExporter) Marshal(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+// Export writes the given document to the file, followed by a newline.
+func (de *DocumentsExporter) Export(payload []byte) error {
+	de.numAdded++
+	if _, err := de.writer.Write(payload); err != nil {
+		return fmt.Errorf("unable to write document to %s: %s", de.Path, err)
+	}
+	if err := de.writer.WriteByte('\n'); err != nil {
+		return fmt.Errorf("unable to write document to %s: %s", de.Path, err)
+	}
+	return nil
+}
+
+// Flush writes any buffered documents to the file.
+func (de *DocumentsExporter) Flush() error {
+	if err := de.writer.Flush(); err != nil {
+		return fmt.Errorf("unable to flush documents to %s: %s", de.Path, err)
+	}
+	de.numFlushed = de.numAdded
+	return nil
+}
+
+// Report returns a summary of the documents given to the exporter.
+// Documents are counted as flushed and indexed once they have been written
+// to the file.
+func (de *DocumentsExporter) Report() []*define.ExportReport {
+	return []*define.ExportReport{
+		{
+			Exporter:   "documents",
+			NumAdded:   de.numAdded,
+			NumFlushed: de.numFlushed,
+			NumIndexed: de.numFlushed,
+		},
+	}
+}
+
+// Teardown flushes any documents exported since the last Flush, such as the
+// run's export reports, and closes the file.
+func (de *DocumentsExporter) Teardown() error {
+	if de.file == nil {
+		return nil
+	}
+	flushErr := de.Flush()
+	closeErr := de.file.Close()
+	de.file = nil
+	if flushErr != nil {
+		return flushErr
+	}
+	if closeErr != nil {
+		return fmt.Errorf("unable to close documents file %s: %s", de.Path, closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package exporters
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/learnitall/gobench/define"
+)
+
+// TestDocumentsExporterImplementsExporterInterface does a quick check to make sure
+// that the DocumentsExporter can successfully be type asserted as a define.Exporterable.
+func TestDocumentsExporterImplementsExporterInterface(t *testing.T) {
+	var ed interface{} = &DocumentsExporter{}
+	_, ok := ed.(define.Exporterable)
+
+	// Can use this line to help debug problems within IDE
+	// var _ define.Exporterable = &DocumentsExporter{}
+
+	if !ok {
+		t.Errorf(
+			"DocumentsExporter failed Exporterable type assertion",
+		)
+	}
+}
+
+// TestDocumentsExporterWritesLines checks that each document is written on its
+// own line, including documents exported after the last flush.
+func TestDocumentsExporterWritesLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "documents.ndjson")
+	exporter := &DocumentsExporter{Path: path}
+	if err := exporter.Setup(&define.Config{}); err != nil {
+		t.Fatalf("Unexpected error during setup: %s", err)
+	}
+
+	for _, payload := range []interface{}{
+		map[string]int{"a": 1},
+		map[string][]string{"b": {"c", "d"}},
+	} {
+		marshalled, err := exporter.Marshal(payload)
+		if err != nil {
+			t.Fatalf("Unexpected error during marshal: %s", err)
+		}
+		if err := exporter.Export(marshalled); err != nil {
+			t.Fatalf("Unexpected error during export: %s", err)
+		}
+		if err := exporter.Flush(); err != nil {
+			t.Fatalf("Unexpected error during flush: %s", err)
+		}
+	}
+	if err := exporter.Export([]byte(`{"e":true}`)); err != nil {
+		t.Fatalf("Unexpected error during export: %s", err)
+	}
+	if report := exporter.Report()[0]; report.NumAdded != 3 || report.NumFlushed != 2 {
+		t.Errorf("Expected 3 documents added and 2 flushed, instead got %+v", report)
+	}
+	if err := exporter.Teardown(); err != nil {
+		t.Fatalf("Unexpected error during teardown: %s", err)
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unable to read documents file: %s", err)
+	}
+	expected := "{\"a\":1}\n{\"b\":[\"c\",\"d\"]}\n{\"e\":true}\n"
+	if string(written) != expected {
+		t.Errorf("Expected documents file %q, instead got %q", expected, string(written))
+	}
+	if report := exporter.Report()[0]; report.NumFlushed != 3 || report.NumIndexed != 3 {
+		t.Errorf("Expected all 3 documents to be flushed after teardown, instead got %+v", report)
+	}
+}
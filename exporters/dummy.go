@@ -28,6 +28,16 @@ func (de *DummyExporter) Export(payload []byte) error {
 	return nil
 }
 
+// Flush returns nil, there is nothing to flush.
+func (de *DummyExporter) Flush() error {
+	return nil
+}
+
+// Report returns nil, the dummy exporter does not track any documents.
+func (de *DummyExporter) Report() []*define.ExportReport {
+	return nil
+}
+
 // Teardown joins all the given documents to export into an array and prints the result.
 func (de *DummyExporter) Teardown() error {
 	return nil
@@ -5,152 +5,103 @@ package exporters
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"math"
-	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/elastic/go-elasticsearch/v8/esutil"
 	"github.com/learnitall/gobench/define"
 	"github.com/rs/zerolog/log"
-	"github.com/valyala/fasthttp"
 )
 
-// fasthttpTransport replaces elasticsearch's http client, based on net/http,
-// with the http client provided by github.com/valyala/fasthttp
-// Reference: https://github.com/elastic/go-elasticsearch/blob/main/_examples/fasthttp/fasthttp.go
-type fasthttpTransport struct {
-	_client              *fasthttp.Client
-	_injectProductHeader bool
-}
-
-// copyRequest converts a http.Request to fasthttp.Request
-func (t *fasthttpTransport) copyRequest(dst *fasthttp.Request, src *http.Request) *fasthttp.Request {
-	if src.Method == "GET" && src.Body != nil {
-		src.Method = "POST"
-	}
-
-	dst.SetHost(src.Host)
-	dst.SetRequestURI(src.URL.String())
-
-	dst.Header.SetRequestURI(src.URL.String())
-	dst.Header.SetMethod(src.Method)
-
-	for k, vv := range src.Header {
-		for _, v := range vv {
-			dst.Header.Set(k, v)
-		}
-	}
-
-	if src.Body != nil {
-		dst.SetBodyStream(src.Body, -1)
-	}
-
-	return dst
-}
-
-// copyResponse converts a fasthttp.Response to a http.Response
-func (t *fasthttpTransport) copyResponse(dst *http.Response, src *fasthttp.Response) *http.Response {
-	dst.StatusCode = src.StatusCode()
-
-	src.Header.VisitAll(func(k, v []byte) {
-		dst.Header.Set(string(k), string(v))
-	})
-
-	// https://towardsaws.com/elasticsearch-the-server-is-not-a-supported-distribution-of-elasticsearch-252abc1bd92
-	if t._injectProductHeader {
-		dst.Header.Set("X-Elastic-Product", "Elasticsearch")
-	}
-
-	// Cast to a string to make a copy seeing as src.Body() won't
-	// be valid after the response is released back to the pool (fasthttp.ReleaseResponse).
-	dst.Body = ioutil.NopCloser(strings.NewReader(string(src.Body())))
-
-	return dst
-}
-
-// RoundTrip performs the request and returns a response or error
-func (t *fasthttpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	freq := fasthttp.AcquireRequest()
-	defer fasthttp.ReleaseRequest(freq)
-
-	fres := fasthttp.AcquireResponse()
-	defer fasthttp.ReleaseResponse(fres)
-
-	t.copyRequest(freq, req)
-
-	err := t._client.Do(freq, fres)
-	if err != nil {
-		return nil, err
-	}
-
-	res := &http.Response{Header: make(http.Header)}
-	t.copyResponse(res, fres)
-
-	return res, nil
-}
-
 // ElasticsearchExporter is used to export benchmark results into Elasticsearch
 type ElasticsearchExporter struct {
 	cfg         *elasticsearch.Config
 	client      *elasticsearch.Client
 	bulkIndexer *esutil.BulkIndexer
 	bulkCfg     *esutil.BulkIndexerConfig
-	index       string
+	index       *IndexTemplate
+	dataStream  bool
 	clusterInfo map[string]interface{}
+	report      define.ExportReport
+	reportLock  sync.Mutex
+	// inflight holds documents which have been added to the bulk indexer but
+	// haven't been reported as a success or failure. The bulk indexer doesn't
+	// call an item's callbacks if the whole flush fails, so this is used to
+	// find which documents were lost.
+	inflight  map[uint64][]byte
+	nextID    uint64
+	lastError error
 }
 
-func (es *ElasticsearchExporter) Setup(cfg *define.Config) error {
-	fasthttpClient := fasthttp.Client{
-		TLSConfig: &tls.Config{
-			InsecureSkipVerify: cfg.ElasticsearchSkipVerify,
-		},
+// flushStartKey is used to store the time a flush started within the
+// context given to the bulk indexer's flush callbacks.
+type flushStartKey struct{}
+
+// newElasticsearchClient creates a new Elasticsearch client using the connection
+// options within the given Config.
+func newElasticsearchClient(cfg *define.Config) (*elasticsearch.Client, *elasticsearch.Config, error) {
+	fasthttpClient, err := newFasthttpClient(
+		cfg.ElasticsearchSkipVerify, cfg.ElasticsearchCACert,
+	)
+	if err != nil {
+		return nil, nil, err
 	}
 	esCfg := elasticsearch.Config{
 		Addresses: []string{
 			cfg.ElasticsearchURL,
 		},
+		Username: cfg.ElasticsearchUsername,
+		Password: cfg.ElasticsearchPassword,
 		Transport: &fasthttpTransport{
-			_client:              &fasthttpClient,
+			_client:              fasthttpClient,
 			_injectProductHeader: cfg.ElasticsearchInjectProductHeader,
 		},
 		// These options are references from
 		// https://github.com/elastic/go-elasticsearch/blob/main/_examples/bulk/indexer.go
-		RetryOnStatus: []int{502, 503, 504, 429},
-		MaxRetries:    5,
-		RetryBackoff: func(i int) time.Duration {
-			log.Warn().
-				Int("total_retries", i-1).
-				Msg("Backing off before retrying connecting to ElasticSearch")
-			// use binary exponential backoff
-			return time.Duration(
-				math.Floor(
-					math.Pow(2, float64(i)),
-				),
-			) * time.Second
-		},
+		RetryOnStatus: retryOnStatus,
+		MaxRetries:    maxRetries,
+		RetryBackoff:  exponentialBackoff,
 	}
-	es.cfg = &esCfg
 
 	client, err := elasticsearch.NewClient(esCfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, &esCfg, nil
+}
+
+func (es *ElasticsearchExporter) Setup(cfg *define.Config) error {
+	client, esCfg, err := newElasticsearchClient(cfg)
 	if err != nil {
 		log.Error().
 			Err(err).
 			Msg("Unable to create new client for ElasticsearchExporter.")
 		return err
 	}
+	es.cfg = esCfg
 	es.client = client
-	es.index = cfg.ElasticsearchIndex
+	es.dataStream = cfg.ElasticsearchDataStream
+
+	index, err := ParseIndexTemplate(cfg.ElasticsearchIndex)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Unable to parse index template for ElasticsearchExporter.")
+		return err
+	}
+	es.index = index
+
+	es.report = define.ExportReport{Exporter: "elasticsearch"}
+	es.inflight = map[uint64][]byte{}
+	es.nextID = 0
+	es.lastError = nil
 
 	// https://github.com/elastic/go-elasticsearch/blob/main/_examples/bulk/indexer.go
 	bulkCfg := esutil.BulkIndexerConfig{
-		Index:  es.index,
 		Client: es.client,
 		// Just using sane defaults for now, can be modified as needed
 		NumWorkers:    3,
@@ -160,7 +111,25 @@ func (es *ElasticsearchExporter) Setup(cfg *define.Config) error {
 			log.Warn().
 				Err(err).
 				Msg("Received error while indexing item through the bulk indexer")
+			es.reportLock.Lock()
+			defer es.reportLock.Unlock()
+			es.lastError = err
+		},
+		OnFlushStart: func(ctx context.Context) context.Context {
+			return context.WithValue(ctx, flushStartKey{}, time.Now())
 		},
+		OnFlushEnd: func(ctx context.Context) {
+			start, ok := ctx.Value(flushStartKey{}).(time.Time)
+			if !ok {
+				return
+			}
+			es.reportLock.Lock()
+			defer es.reportLock.Unlock()
+			es.report.AddLatency(time.Since(start))
+		},
+	}
+	if es.index.IsStatic() {
+		bulkCfg.Index = es.index.String()
 	}
 	es.bulkCfg = &bulkCfg
 
@@ -169,11 +138,15 @@ func (es *ElasticsearchExporter) Setup(cfg *define.Config) error {
 		log.Error().
 			Err(err).
 			Msg("Unable to create new bulk indexer for ElasticsearchExporter.")
+		return err
 	}
 	es.bulkIndexer = &bi
 
+	// Avoid logging the whole config, as it contains credentials.
 	log.Info().
-		Interface("cfg", cfg).
+		Str("url", cfg.ElasticsearchURL).
+		Str("index", es.index.String()).
+		Bool("data_stream", es.dataStream).
 		Msg("Created new ElasticsearchExporter")
 
 	return nil
@@ -247,15 +220,74 @@ func (es *ElasticsearchExporter) Healthcheck() error {
 	return nil
 }
 
-func (es *ElasticsearchExporter) Teardown() error {
+// closeBulkIndexer closes the current bulk indexer, waiting for all of its
+// items to be flushed, and adds its stats into the exporter's report.
+func (es *ElasticsearchExporter) closeBulkIndexer() (esutil.BulkIndexerStats, error) {
 	indexer := *es.bulkIndexer
 	if err := indexer.Close(context.Background()); err != nil {
+		return esutil.BulkIndexerStats{}, err
+	}
+	stats := indexer.Stats()
+
+	es.reportLock.Lock()
+	defer es.reportLock.Unlock()
+	es.report.NumAdded += stats.NumAdded
+	es.report.NumFlushed += stats.NumFlushed
+	// Documents sent to a data stream are counted as created rather than indexed.
+	es.report.NumIndexed += stats.NumIndexed + stats.NumCreated
+	es.report.NumFailed += stats.NumFailed
+
+	reason := "document was not flushed by the bulk indexer"
+	if es.lastError != nil {
+		reason = es.lastError.Error()
+	}
+	for id, document := range es.inflight {
+		es.report.AddFailure(document, reason)
+		delete(es.inflight, id)
+	}
+
+	return stats, nil
+}
+
+// Flush closes the current bulk indexer, which sends any queued items to
+// Elasticsearch, then replaces it with a new one.
+func (es *ElasticsearchExporter) Flush() error {
+	if _, err := es.closeBulkIndexer(); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Unexpected error while flushing bulk indexer.")
+		return err
+	}
+
+	bi, err := esutil.NewBulkIndexer(*es.bulkCfg)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Unable to create new bulk indexer for ElasticsearchExporter.")
+		return err
+	}
+	es.bulkIndexer = &bi
+	return nil
+}
+
+// Report returns a summary of the documents handled by the exporter, as of
+// the last call to Flush or Teardown.
+func (es *ElasticsearchExporter) Report() []*define.ExportReport {
+	es.reportLock.Lock()
+	defer es.reportLock.Unlock()
+	report := es.report
+	report.Failures = append([]define.ExportFailure{}, es.report.Failures...)
+	return []*define.ExportReport{&report}
+}
+
+func (es *ElasticsearchExporter) Teardown() error {
+	stats, err := es.closeBulkIndexer()
+	if err != nil {
 		log.Error().
 			Err(err).
 			Msg("Unexpected error while closing out bulk indexer.")
 		return err
 	}
-	stats := (*es.bulkIndexer).Stats()
 	if stats.NumFailed > 0 {
 		err := errors.New(
 			"one or more documents were not exported successfully",
@@ -263,8 +295,8 @@ func (es *ElasticsearchExporter) Teardown() error {
 		log.Error().
 			Err(err).
 			Uint64("num_failed", stats.NumFailed).
-			Uint64("num_success", stats.NumCreated).
-			Uint64("num_total", stats.NumCreated).
+			Uint64("num_success", stats.NumIndexed+stats.NumCreated).
+			Uint64("num_total", stats.NumAdded).
 			Interface("stats_raw", stats).
 			Msg("Unable to teardown Elasticsearch Exporter.")
 		return err
@@ -279,33 +311,74 @@ func (es *ElasticsearchExporter) Marshal(payload interface{}) ([]byte, error) {
 }
 
 func (es *ElasticsearchExporter) Export(payload []byte) error {
+	index, routed, err := routeDocument(es.index, es.dataStream, payload)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Bytes("payload", payload).
+			Msg("Unable to route payload to an index")
+		return err
+	}
+
+	action := "index"
+	if es.dataStream {
+		// Data streams are append-only, and only accept the create action.
+		action = "create"
+	}
+
+	es.reportLock.Lock()
+	id := es.nextID
+	es.nextID++
+	es.inflight[id] = routed
+	es.reportLock.Unlock()
+
 	indexer := *es.bulkIndexer
-	err := indexer.Add(
+	err = indexer.Add(
 		context.Background(),
 		esutil.BulkIndexerItem{
-			Action: "index",
-			Body:   bytes.NewReader(payload),
+			Index:  index,
+			Action: action,
+			Body:   bytes.NewReader(routed),
+			OnSuccess: func(
+				c context.Context,
+				bii esutil.BulkIndexerItem,
+				biri esutil.BulkIndexerResponseItem,
+			) {
+				es.reportLock.Lock()
+				defer es.reportLock.Unlock()
+				delete(es.inflight, id)
+			},
 			OnFailure: func(
 				c context.Context,
 				bii esutil.BulkIndexerItem,
 				biri esutil.BulkIndexerResponseItem,
 				e error,
 			) {
+				var reason string
 				if e != nil {
+					reason = e.Error()
 					log.Warn().
 						Err(e).
 						Msg("go-level error while indexing with bulk indexer.")
 				} else {
+					reason = fmt.Sprintf("%s: %s", biri.Error.Type, biri.Error.Reason)
 					log.Warn().
 						Str("error_type", biri.Error.Type).
 						Str("error_reason", biri.Error.Reason).
 						Msg("es-level error while indexing with bulk indexer.")
 				}
+				es.reportLock.Lock()
+				defer es.reportLock.Unlock()
+				delete(es.inflight, id)
+				es.report.AddFailure(routed, reason)
 			},
 		},
 	)
 
 	if err != nil {
+		es.reportLock.Lock()
+		delete(es.inflight, id)
+		es.reportLock.Unlock()
 		log.Error().
 			Err(err).
 			RawJSON("payload", payload).
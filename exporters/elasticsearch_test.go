@@ -1,11 +1,15 @@
 package exporters
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/learnitall/gobench/define"
 )
@@ -89,7 +93,7 @@ func TestElasticProductHeaderIsInjected(t *testing.T) {
 	)
 	defer testServer.Close()
 
-	cfg := define.GetConfig()
+	cfg := define.NewConfig()
 	cfg.ElasticsearchURL = testServerURL.String()
 	cfg.ElasticsearchSkipVerify = true
 	cfg.ElasticsearchInjectProductHeader = false
@@ -147,7 +151,7 @@ func TestElasticsearchExporterCanExportPayloads(t *testing.T) {
 	)
 	defer testServer.Close()
 
-	cfg := define.GetConfig()
+	cfg := define.NewConfig()
 	cfg.ElasticsearchURL = testServerURL.String()
 	// ensure this is synced with BULK_INDEX_RESPONSE_SUCCESS_STR
 	cfg.ElasticsearchIndex = "myIndex"
@@ -209,7 +213,7 @@ func TestElasticsearchExporterFailsGracefullyOnExportFail(t *testing.T) {
 	)
 	defer testServer.Close()
 
-	cfg := define.GetConfig()
+	cfg := define.NewConfig()
 	cfg.ElasticsearchURL = testServerURL.String()
 	cfg.ElasticsearchIndex = "myIndex"
 	cfg.ElasticsearchSkipVerify = true
@@ -251,4 +255,96 @@ func TestElasticsearchExporterFailsGracefullyOnExportFail(t *testing.T) {
 		)
 	}
 
+	report := es.Report()[0]
+	if report.NumAdded != 1 || report.NumFailed != 1 || len(report.Failures) != 1 {
+		t.Errorf(
+			"Expected report to show 1 document added and failed, instead got: %+v", report,
+		)
+	} else if report.Failures[0].Document != string(payload) {
+		t.Errorf(
+			"Expected report to contain failed document %s, instead got: %s",
+			payload, report.Failures[0].Document,
+		)
+	}
+}
+
+// TestElasticsearchExporterRoutesDataStreamDocuments mocks an ElasticSearch server
+// to determine if documents are sent with the create action, an injected
+// @timestamp field and an index resolved from the configured index template.
+func TestElasticsearchExporterRoutesDataStreamDocuments(t *testing.T) {
+	var bulkBody []byte
+	testServer, testServerURL := getTestServer(
+		t,
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				bulkBody, _ = ioutil.ReadAll(r.Body)
+				fmt.Fprint(w, BULK_INDEX_RESPONSE_SUCCESS_STR)
+			},
+		),
+	)
+	defer testServer.Close()
+
+	cfg := define.NewConfig()
+	cfg.ElasticsearchURL = testServerURL.String()
+	cfg.ElasticsearchIndex = "gobench-{benchmark}-{yyyy.MM}"
+	cfg.ElasticsearchDataStream = true
+	cfg.ElasticsearchSkipVerify = true
+	cfg.ElasticsearchInjectProductHeader = true
+	defer func() { cfg.ElasticsearchDataStream = false }()
+	es := ElasticsearchExporter{}
+
+	err := es.Setup(cfg)
+	if err != nil {
+		t.Fatalf("Got error during setup: %s", err)
+	}
+
+	payload, err := es.Marshal(
+		map[string]interface{}{
+			"Key": "value",
+			"Metadata": define.Metadata{
+				RunID:       "abc-123",
+				Benchmark:   "uperf",
+				Timestamp:   time.Date(2022, time.February, 7, 17, 23, 46, 0, time.UTC),
+				TimestampMS: 1644254626000,
+			},
+		},
+	)
+	if err != nil {
+		t.Fatalf("Got error during marshal: %s", err)
+	}
+
+	err = es.Export(payload)
+	if err != nil {
+		t.Fatalf("Received error while calling Export: %s", err)
+	}
+
+	err = es.Teardown()
+	if err != nil {
+		t.Fatalf("Received error while calling Teardown: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(bulkBody)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected bulk request with two lines, instead got: %s", bulkBody)
+	}
+
+	var meta map[string]map[string]string
+	if err := json.Unmarshal([]byte(lines[0]), &meta); err != nil {
+		t.Fatalf("Unable to unmarshal bulk request meta line %s: %s", lines[0], err)
+	}
+	create, ok := meta["create"]
+	if !ok {
+		t.Errorf("Expected bulk request to use the create action, instead got: %s", lines[0])
+	}
+	if create["_index"] != "gobench-uperf-2022.02" {
+		t.Errorf("Expected document to be routed to gobench-uperf-2022.02, instead got: %s", lines[0])
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &document); err != nil {
+		t.Fatalf("Unable to unmarshal bulk request body line %s: %s", lines[1], err)
+	}
+	if document["@timestamp"] != "2022-02-07T17:23:46Z" {
+		t.Errorf("Expected injected @timestamp of 2022-02-07T17:23:46Z, instead got: %v", document["@timestamp"])
+	}
 }
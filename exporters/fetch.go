@@ -0,0 +1,207 @@
+// fetch.go implements functionality for pulling exported benchmark results
+// back out of Elasticsearch.
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+)
+
+// fetchPageSize is the number of documents requested from Elasticsearch per page.
+const fetchPageSize int = 500
+
+// fetchScrollTimeout is how long Elasticsearch keeps the search context alive
+// between pages.
+const fetchScrollTimeout time.Duration = time.Minute
+
+// fetchSort orders fetched documents by when they were exported, so output
+// is deterministic. Documents are sorted by the timestamp within their
+// Metadata, then by their own TimestampMS, such as the time of a uperf
+// interval or timeline event. Fields missing from an index are treated as
+// unmapped rather than failing the search.
+var fetchSort []interface{} = []interface{}{
+	map[string]interface{}{
+		"Metadata.TimestampMS": map[string]interface{}{"order": "asc", "unmapped_type": "long"},
+	},
+	map[string]interface{}{
+		"TimestampMS": map[string]interface{}{"order": "asc", "unmapped_type": "double", "missing": "_first"},
+	},
+	"_doc",
+}
+
+// fetchResponse represents the parts of a search or scroll response needed
+// to page through results.
+type fetchResponse struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			Source json.RawMessage `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// decodeFetchResponse checks the given response for errors and decodes its body.
+func decodeFetchResponse(isError bool, status string, body *bytes.Buffer) (*fetchResponse, error) {
+	if isError {
+		return nil, fmt.Errorf(
+			"es-level error while fetching documents: %s %s", status, body.String(),
+		)
+	}
+	var response fetchResponse
+	if err := json.NewDecoder(body).Decode(&response); err != nil {
+		return nil, fmt.Errorf(
+			"unable to decode response while fetching documents: %s", err,
+		)
+	}
+	return &response, nil
+}
+
+// stripDataStreamTimestamp removes the @timestamp field added to documents
+// routed to a data stream, see routeDocument, so fetched documents match what
+// was exported.
+func stripDataStreamTimestamp(source json.RawMessage) (json.RawMessage, error) {
+	var document map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(source))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf(
+			"unable to decode fetched document: %s", err,
+		)
+	}
+	if _, ok := document["@timestamp"]; !ok {
+		return source, nil
+	}
+	delete(document, "@timestamp")
+	return json.Marshal(document)
+}
+
+// FetchElasticsearchDocuments pulls every document belonging to the given run ID
+// out of Elasticsearch, using the scroll API to page through results.
+// The search targets the index configured in the given Config. If the index
+// is a template, then every index the template can route to is searched.
+// The callback is called with the source of each document, ordered by
+// timestamp, see fetchSort. If the Config targets a data stream, then the
+// @timestamp field added while exporting is removed first. If the callback
+// returns an error, then fetching stops and the error is returned.
+func FetchElasticsearchDocuments(
+	cfg *define.Config, runID string, callback func(json.RawMessage) error,
+) error {
+	if len(runID) == 0 {
+		return errors.New("a run ID is required to fetch documents")
+	}
+
+	client, _, err := newElasticsearchClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	index, err := ParseIndexTemplate(cfg.ElasticsearchIndex)
+	if err != nil {
+		return err
+	}
+
+	query, err := json.Marshal(
+		map[string]interface{}{
+			"query": map[string]interface{}{
+				"match_phrase": map[string]interface{}{
+					"Metadata.RunID": runID,
+				},
+			},
+			"sort": fetchSort,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	searchOpts := []func(*esapi.SearchRequest){
+		client.Search.WithBody(bytes.NewReader(query)),
+		client.Search.WithScroll(fetchScrollTimeout),
+		client.Search.WithSize(fetchPageSize),
+	}
+	if len(index.String()) > 0 {
+		searchOpts = append(searchOpts, client.Search.WithIndex(index.Pattern()))
+	}
+
+	res, err := client.Search(searchOpts...)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	_, err = body.ReadFrom(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return err
+	}
+	response, err := decodeFetchResponse(res.IsError(), res.Status(), &body)
+	if err != nil {
+		return err
+	}
+
+	scrollID := response.ScrollID
+	defer func() {
+		if len(scrollID) == 0 {
+			return
+		}
+		res, err := client.ClearScroll(client.ClearScroll.WithScrollID(scrollID))
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Msg("Unable to clear scroll context after fetching documents.")
+			return
+		}
+		res.Body.Close()
+	}()
+
+	numFetched := 0
+	for len(response.Hits.Hits) > 0 {
+		for _, hit := range response.Hits.Hits {
+			source := hit.Source
+			if cfg.ElasticsearchDataStream {
+				source, err = stripDataStreamTimestamp(source)
+				if err != nil {
+					return err
+				}
+			}
+			if err := callback(source); err != nil {
+				return err
+			}
+			numFetched++
+		}
+
+		res, err := client.Scroll(
+			client.Scroll.WithScrollID(scrollID),
+			client.Scroll.WithScroll(fetchScrollTimeout),
+		)
+		if err != nil {
+			return err
+		}
+		body.Reset()
+		_, err = body.ReadFrom(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		response, err = decodeFetchResponse(res.IsError(), res.Status(), &body)
+		if err != nil {
+			return err
+		}
+		if len(response.ScrollID) > 0 {
+			scrollID = response.ScrollID
+		}
+	}
+
+	log.Info().
+		Str("run_id", runID).
+		Int("num_fetched", numFetched).
+		Msg("Finished fetching documents from Elasticsearch.")
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/learnitall/gobench/define"
+)
+
+var FETCH_SEARCH_RESPONSE_STR string = `{
+	"_scroll_id": "scroll-1",
+	"hits": {
+		"hits": [
+			{"_index": "myindex", "_source": {"Key": "one", "Metadata": {"RunID": "abc-123"}}},
+			{"_index": "myindex", "_source": {"Key": "two", "Metadata": {"RunID": "abc-123"}}}
+		]
+	}
+}`
+
+var FETCH_SCROLL_RESPONSE_STR string = `{
+	"_scroll_id": "scroll-2",
+	"hits": {
+		"hits": [
+			{"_index": "myindex", "_source": {"Key": "three", "Metadata": {"RunID": "abc-123"}}}
+		]
+	}
+}`
+
+var FETCH_SCROLL_EMPTY_RESPONSE_STR string = `{
+	"_scroll_id": "scroll-2",
+	"hits": {
+		"hits": []
+	}
+}`
+
+var FETCH_DATA_STREAM_RESPONSE_STR string = `{
+	"_scroll_id": "scroll-1",
+	"hits": {
+		"hits": [
+			{"_index": ".ds-gobench", "_source": {"@timestamp": "2022-01-02T00:00:00Z", "Key": "one", "Metadata": {"RunID": "abc-123", "TimestampMS": 1641081600000}}}
+		]
+	}
+}`
+
+// TestFetchElasticsearchDocuments mocks an ElasticSearch server to determine if
+// FetchElasticsearchDocuments pages through every result using the scroll API,
+// queries for the given run ID sorted by timestamp and clears the scroll context when finished.
+func TestFetchElasticsearchDocuments(t *testing.T) {
+	var (
+		searchPath   string
+		searchQuery  string
+		numScrolls   int
+		scrollClears int
+	)
+	testServer, testServerURL := getTestServer(
+		t,
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == "DELETE":
+					scrollClears++
+					fmt.Fprint(w, `{"succeeded": true}`)
+				case strings.HasSuffix(r.URL.Path, "/_search/scroll"):
+					numScrolls++
+					if numScrolls == 1 {
+						fmt.Fprint(w, FETCH_SCROLL_RESPONSE_STR)
+					} else {
+						fmt.Fprint(w, FETCH_SCROLL_EMPTY_RESPONSE_STR)
+					}
+				case strings.HasSuffix(r.URL.Path, "/_search"):
+					searchPath = r.URL.Path
+					body, _ := ioutil.ReadAll(r.Body)
+					searchQuery = string(body)
+					fmt.Fprint(w, FETCH_SEARCH_RESPONSE_STR)
+				default:
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			},
+		),
+	)
+	defer testServer.Close()
+
+	cfg := define.NewConfig()
+	cfg.ElasticsearchURL = testServerURL.String()
+	cfg.ElasticsearchIndex = "gobench-{benchmark}-{yyyy.MM}"
+	cfg.ElasticsearchSkipVerify = true
+	cfg.ElasticsearchInjectProductHeader = true
+
+	keys := []string{}
+	err := FetchElasticsearchDocuments(
+		cfg, "abc-123",
+		func(document json.RawMessage) error {
+			var payload MockPayload
+			if err := json.Unmarshal(document, &payload); err != nil {
+				return err
+			}
+			keys = append(keys, payload.Key)
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while fetching documents: %s", err)
+	}
+
+	if strings.Join(keys, ",") != "one,two,three" {
+		t.Errorf("Expected to fetch documents one, two and three in order, instead got: %v", keys)
+	}
+	if searchPath != "/gobench-*-*/_search" {
+		t.Errorf("Expected search against index pattern gobench-*-*, instead got path: %s", searchPath)
+	}
+	if !strings.Contains(searchQuery, "abc-123") {
+		t.Errorf("Expected search query to contain the run ID, instead got: %s", searchQuery)
+	}
+	if !strings.Contains(searchQuery, `"sort":[{"Metadata.TimestampMS"`) {
+		t.Errorf("Expected search query to sort by timestamp, instead got: %s", searchQuery)
+	}
+	if scrollClears != 1 {
+		t.Errorf("Expected scroll context to be cleared once, instead got %d", scrollClears)
+	}
+}
+
+// TestFetchElasticsearchDocumentsDataStream checks that the @timestamp field
+// added to documents routed to a data stream is removed when fetching them.
+func TestFetchElasticsearchDocumentsDataStream(t *testing.T) {
+	testServer, testServerURL := getTestServer(
+		t,
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == "DELETE":
+					fmt.Fprint(w, `{"succeeded": true}`)
+				case strings.HasSuffix(r.URL.Path, "/_search/scroll"):
+					fmt.Fprint(w, FETCH_SCROLL_EMPTY_RESPONSE_STR)
+				case strings.HasSuffix(r.URL.Path, "/_search"):
+					fmt.Fprint(w, FETCH_DATA_STREAM_RESPONSE_STR)
+				default:
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			},
+		),
+	)
+	defer testServer.Close()
+
+	cfg := define.NewConfig()
+	cfg.ElasticsearchURL = testServerURL.String()
+	cfg.ElasticsearchIndex = "gobench"
+	cfg.ElasticsearchDataStream = true
+	cfg.ElasticsearchSkipVerify = true
+	cfg.ElasticsearchInjectProductHeader = true
+
+	documents := []string{}
+	err := FetchElasticsearchDocuments(
+		cfg, "abc-123",
+		func(document json.RawMessage) error {
+			documents = append(documents, string(document))
+			return nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("Unexpected error while fetching documents: %s", err)
+	}
+
+	expected := `{"Key":"one","Metadata":{"RunID":"abc-123","TimestampMS":1641081600000}}`
+	if len(documents) != 1 || documents[0] != expected {
+		t.Errorf("Expected fetched documents to be [%s], instead got %v", expected, documents)
+	}
+}
@@ -0,0 +1,207 @@
+// index.go implements the IndexTemplate object, which is used to route
+// exported documents into different indices based on their fields.
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// indexFieldAliases maps short, user-friendly placeholder names onto the
+// dotted field paths they refer to within a document.
+var indexFieldAliases map[string]string = map[string]string{
+	"benchmark": "Metadata.Benchmark",
+	"section":   "SectionType",
+	"uuid":      "Metadata.RunID",
+}
+
+// indexDateLayouts translates the java-style date tokens used by
+// Elasticsearch's date math into go's reference time layout.
+// Longer tokens need to come first so they are replaced first.
+var indexDateLayouts []string = []string{
+	"yyyy", "2006",
+	"yy", "06",
+	"MM", "01",
+	"dd", "02",
+	"HH", "15",
+}
+
+// indexDateTokenRegex matches placeholders which only contain date tokens
+// and separators, ie `yyyy.MM.dd`.
+var indexDateTokenRegex *regexp.Regexp = regexp.MustCompile(`^(yyyy|yy|MM|dd|HH|[.\-_])+$`)
+
+// indexPlaceholderRegex matches placeholders within an index template, ie `{section}`.
+var indexPlaceholderRegex *regexp.Regexp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// indexUnknownValue is substituted for placeholders whose field cannot be found.
+const indexUnknownValue string = "unknown"
+
+// IndexTemplate is used to determine the index a document should be sent to.
+// Templates can contain placeholders surrounded by curly braces, which are
+// replaced by the value of a field in the document being routed, or by the
+// document's date. For instance, `gobench-{benchmark}-{section}-{yyyy.MM}`.
+// The following placeholders are supported:
+// - `{benchmark}`: the Metadata.Benchmark field.
+// - `{section}`: the SectionType field.
+// - `{uuid}`: the Metadata.RunID field.
+// - `{yyyy.MM.dd}`: the document's timestamp, using the given java-style format.
+// - `{Some.Field}`: any other field, given as a dotted path.
+type IndexTemplate struct {
+	template string
+}
+
+// ParseIndexTemplate creates a new IndexTemplate from the given string.
+// An error is returned if the template contains unbalanced braces.
+func ParseIndexTemplate(template string) (*IndexTemplate, error) {
+	stripped := indexPlaceholderRegex.ReplaceAllString(template, "")
+	if strings.ContainsAny(stripped, "{}") {
+		return nil, fmt.Errorf(
+			"unbalanced braces in index template: %s", template,
+		)
+	}
+	return &IndexTemplate{template: template}, nil
+}
+
+// IsStatic returns true if the template does not contain any placeholders, meaning
+// every document is sent to the same index.
+func (it *IndexTemplate) IsStatic() bool {
+	return !indexPlaceholderRegex.MatchString(it.template)
+}
+
+// String returns the raw template.
+func (it *IndexTemplate) String() string {
+	return it.template
+}
+
+// Pattern returns the template with each placeholder replaced by a wildcard,
+// which can be used to search across every index the template routes to.
+func (it *IndexTemplate) Pattern() string {
+	return indexPlaceholderRegex.ReplaceAllString(it.template, "*")
+}
+
+// Resolve returns the name of the index the given document should be sent to.
+// The timestamp is used for any date placeholders.
+// Index names are lowercased, as Elasticsearch does not allow uppercase index names.
+func (it *IndexTemplate) Resolve(document map[string]interface{}, timestamp time.Time) string {
+	resolved := indexPlaceholderRegex.ReplaceAllStringFunc(
+		it.template,
+		func(placeholder string) string {
+			name := placeholder[1 : len(placeholder)-1]
+			if indexDateTokenRegex.MatchString(name) {
+				return timestamp.UTC().Format(
+					strings.NewReplacer(indexDateLayouts...).Replace(name),
+				)
+			}
+			if alias, ok := indexFieldAliases[name]; ok {
+				name = alias
+			}
+			value, ok := lookupDocumentField(document, name)
+			if !ok {
+				return indexUnknownValue
+			}
+			return value
+		},
+	)
+	return strings.ToLower(resolved)
+}
+
+// lookupDocumentField finds the value of a field within the given document
+// using a dotted path, ie `Metadata.RunID`.
+// The value is returned as a string, alongside whether or not it was found.
+func lookupDocumentField(document map[string]interface{}, path string) (string, bool) {
+	var current interface{} = document
+	for _, key := range strings.Split(path, ".") {
+		asMap, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		current, ok = asMap[key]
+		if !ok || current == nil {
+			return "", false
+		}
+	}
+
+	switch value := current.(type) {
+	case string:
+		if len(value) == 0 {
+			return "", false
+		}
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case float64, bool:
+		return fmt.Sprintf("%v", value), true
+	default:
+		return "", false
+	}
+}
+
+// documentTimestamp returns the time the given document was created at.
+// Documents which record their own time in epoch milliseconds through a
+// top-level TimestampMS field use it, otherwise the document's
+// Metadata.TimestampMS or RFC3339 Metadata.Timestamp field is used.
+// If the document does not have a timestamp, then the current time is returned.
+func documentTimestamp(document map[string]interface{}) time.Time {
+	for _, field := range []string{"TimestampMS", "Metadata.TimestampMS"} {
+		value, ok := lookupDocumentField(document, field)
+		if !ok {
+			continue
+		}
+		milliseconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || milliseconds <= 0 {
+			continue
+		}
+		return time.Unix(0, int64(milliseconds*float64(time.Millisecond)))
+	}
+
+	value, ok := lookupDocumentField(document, "Metadata.Timestamp")
+	if !ok {
+		return time.Now()
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Now()
+	}
+	return timestamp
+}
+
+// routeDocument determines the index the given payload should be sent to.
+// If data streams are enabled, then the payload is given an `@timestamp`
+// field, which is required by Elasticsearch for documents within a data stream.
+// The returned index is empty if the exporter's default index should be used.
+func routeDocument(indexTemplate *IndexTemplate, dataStream bool, payload []byte) (string, []byte, error) {
+	if indexTemplate.IsStatic() && !dataStream {
+		return "", payload, nil
+	}
+
+	var document map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return "", nil, fmt.Errorf(
+			"unable to decode payload to determine its index: %s", err,
+		)
+	}
+
+	timestamp := documentTimestamp(document)
+	index := ""
+	if !indexTemplate.IsStatic() {
+		index = indexTemplate.Resolve(document, timestamp)
+	}
+
+	if dataStream {
+		document["@timestamp"] = timestamp.UTC().Format(time.RFC3339Nano)
+		routed, err := json.Marshal(document)
+		if err != nil {
+			return "", nil, err
+		}
+		payload = routed
+	}
+
+	return index, payload, nil
+}
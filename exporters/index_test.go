@@ -0,0 +1,106 @@
+package exporters
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+var INDEX_TEST_DOCUMENT string = `{
+	"Name": "Txn2",
+	"SectionType": "tx",
+	"Metadata": {
+		"RunID": "abc-123",
+		"Benchmark": "uperf",
+		"Timestamp": "2022-02-07T17:23:46.628Z",
+		"TimestampMS": 1644254626628
+	}
+}`
+
+// TestIndexTemplateResolve checks that placeholders within an index template
+// are replaced by the appropriate document fields and dates.
+func TestIndexTemplateResolve(t *testing.T) {
+	var document map[string]interface{}
+	err := json.Unmarshal([]byte(INDEX_TEST_DOCUMENT), &document)
+	if err != nil {
+		t.Fatalf("Unable to unmarshal test document: %s", err)
+	}
+	timestamp := time.Date(2022, time.February, 7, 17, 23, 46, 0, time.UTC)
+
+	tests := map[string]string{
+		"myIndex": "myindex",
+		"gobench-{benchmark}-{section}-{yyyy.MM}": "gobench-uperf-tx-2022.02",
+		"gobench-{uuid}-{yyyy.MM.dd}":             "gobench-abc-123-2022.02.07",
+		"gobench-{Name}-{yy-MM-dd-HH}":            "gobench-txn2-22-02-07-17",
+		"gobench-{Metadata.Benchmark}":            "gobench-uperf",
+		"gobench-{DoesNotExist}":                  "gobench-unknown",
+		"gobench-{Metadata.RunID.Nested}":         "gobench-unknown",
+	}
+
+	for template, expected := range tests {
+		indexTemplate, err := ParseIndexTemplate(template)
+		if err != nil {
+			t.Errorf("Unexpected error parsing index template %s: %s", template, err)
+			continue
+		}
+		result := indexTemplate.Resolve(document, timestamp)
+		if result != expected {
+			t.Errorf(
+				"Expected index template %s to resolve to %s, instead got %s",
+				template, expected, result,
+			)
+		}
+	}
+}
+
+// TestIndexTemplatePattern checks that the wildcard pattern for an index template
+// replaces each placeholder.
+func TestIndexTemplatePattern(t *testing.T) {
+	indexTemplate, err := ParseIndexTemplate("gobench-{benchmark}-{section}-{yyyy.MM}")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing index template: %s", err)
+	}
+	if indexTemplate.IsStatic() {
+		t.Error("Expected index template with placeholders to not be static")
+	}
+	if pattern := indexTemplate.Pattern(); pattern != "gobench-*-*-*" {
+		t.Errorf("Expected pattern gobench-*-*-*, instead got %s", pattern)
+	}
+}
+
+// TestParseIndexTemplateUnbalanced checks that an error is returned when
+// an index template contains unbalanced braces.
+func TestParseIndexTemplateUnbalanced(t *testing.T) {
+	for _, template := range []string{"gobench-{section", "gobench-section}", "gobench-{{section}"} {
+		_, err := ParseIndexTemplate(template)
+		if err == nil {
+			t.Errorf("Expected error parsing index template %s, instead got nil", template)
+		}
+	}
+}
+
+// TestDocumentTimestamp checks that a document's own timestamp is preferred
+// over the timestamp within its metadata, and that both are parsed with
+// millisecond precision.
+func TestDocumentTimestamp(t *testing.T) {
+	tests := map[string]time.Time{
+		`{"TimestampMS": 1644254626628.9016, "Metadata": {"TimestampMS": 1}}`: time.Unix(1644254626, 628901600),
+		`{"Metadata": {"TimestampMS": 1644254626628}}`:                        time.Unix(1644254626, 628000000),
+		`{"Metadata": {"Timestamp": "2022-02-07T17:23:46.628123456Z"}}`:       time.Unix(1644254626, 628123456),
+	}
+
+	for document, expected := range tests {
+		var decoded map[string]interface{}
+		if err := json.Unmarshal([]byte(document), &decoded); err != nil {
+			t.Fatalf("Unable to unmarshal test document %s: %s", document, err)
+		}
+		result := documentTimestamp(decoded)
+		difference := result.Sub(expected)
+		if difference > time.Microsecond || difference < -time.Microsecond {
+			t.Errorf(
+				"Expected timestamp of document %s to be %s, instead got %s",
+				document, expected.UTC(), result.UTC(),
+			)
+		}
+	}
+}
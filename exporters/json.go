@@ -10,11 +10,13 @@ import (
 
 type JsonExporter struct {
 	documents []string
+	printed   bool
 }
 
 // Setup creates a new array to hold json documents to-be-printed.
 func (je *JsonExporter) Setup(cfg *define.Config) error {
 	je.documents = []string{}
+	je.printed = false
 	return nil
 }
 
@@ -34,8 +36,28 @@ func (je *JsonExporter) Export(payload []byte) error {
 	return nil
 }
 
+// Flush returns nil, documents are held until Teardown so they can be printed as one array.
+func (je *JsonExporter) Flush() error {
+	return nil
+}
+
+// Report returns a summary of the documents given to the exporter.
+// Documents are only counted as flushed and indexed once they have been printed.
+func (je *JsonExporter) Report() []*define.ExportReport {
+	report := &define.ExportReport{
+		Exporter: "json",
+		NumAdded: uint64(len(je.documents)),
+	}
+	if je.printed {
+		report.NumFlushed = report.NumAdded
+		report.NumIndexed = report.NumAdded
+	}
+	return []*define.ExportReport{report}
+}
+
 // Teardown joins all the given documents to export into an array and prints the result.
 func (je *JsonExporter) Teardown() error {
 	_, err := fmt.Printf("[%s]", strings.Join(je.documents, ","))
+	je.printed = err == nil
 	return err
 }
@@ -0,0 +1,445 @@
+// opensearch.go implements the OpenSearchExporter object, which is used to
+// export benchmark results to OpenSearch.
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+// openSearchFlushBytes is the size the bulk request buffer needs to reach
+// before it is sent to OpenSearch.
+const openSearchFlushBytes int = 1e+6 // ~ 1024 KiB or 1 MiB
+
+// openSearchTemplateNameRegex matches characters which cannot be used
+// within the name of an index template.
+var openSearchTemplateNameRegex *regexp.Regexp = regexp.MustCompile(`[^a-z0-9_\-]+`)
+
+// openSearchBulkResponse represents the response given by the OpenSearch bulk API.
+type openSearchBulkResponse struct {
+	Errors bool                                    `json:"errors"`
+	Items  []map[string]openSearchBulkResponseItem `json:"items"`
+}
+
+// openSearchBulkResponseItem represents the result of a single action within a bulk request.
+type openSearchBulkResponseItem struct {
+	Index  string `json:"_index"`
+	Status int    `json:"status"`
+	Error  struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// OpenSearchExporter is used to export benchmark results into OpenSearch.
+// Unlike the ElasticsearchExporter, it talks to OpenSearch's REST API directly
+// using its own bulk client, rather than relying on the Elasticsearch client library.
+type OpenSearchExporter struct {
+	client       *fasthttp.Client
+	url          string
+	username     string
+	password     string
+	index        *IndexTemplate
+	dataStream   bool
+	mappingPath  string
+	buffer       bytes.Buffer
+	pending      [][]byte
+	report       define.ExportReport
+	distribution string
+	version      string
+}
+
+// Setup creates the http client used to talk to OpenSearch.
+func (ose *OpenSearchExporter) Setup(cfg *define.Config) error {
+	client, err := newFasthttpClient(
+		cfg.OpenSearchSkipVerify, cfg.OpenSearchCACert,
+	)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Unable to create http client for OpenSearchExporter.")
+		return err
+	}
+	ose.client = client
+
+	index, err := ParseIndexTemplate(cfg.OpenSearchIndex)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Msg("Unable to parse index template for OpenSearchExporter.")
+		return err
+	}
+	if index.IsStatic() && len(index.String()) == 0 {
+		return errors.New("an index is required for the OpenSearchExporter")
+	}
+	ose.index = index
+
+	ose.url = strings.TrimRight(cfg.OpenSearchURL, "/")
+	ose.username = cfg.OpenSearchUsername
+	ose.password = cfg.OpenSearchPassword
+	ose.dataStream = cfg.OpenSearchDataStream
+	ose.mappingPath = cfg.OpenSearchMappingPath
+	ose.buffer.Reset()
+	ose.pending = [][]byte{}
+	ose.report = define.ExportReport{Exporter: "opensearch"}
+
+	log.Info().
+		Str("url", ose.url).
+		Str("index", ose.index.String()).
+		Msg("Created new OpenSearchExporter")
+
+	return nil
+}
+
+// do sends a request to OpenSearch with the given method, path and body,
+// returning the response's status code and body.
+// Requests which fail with a retryable status code are retried using
+// exponential backoff.
+func (ose *OpenSearchExporter) do(method string, path string, contentType string, body []byte) (int, []byte, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(res)
+
+	req.SetRequestURI(ose.url + path)
+	req.Header.SetMethod(method)
+	if len(ose.username) > 0 {
+		req.URI().SetUsername(ose.username)
+		req.URI().SetPassword(ose.password)
+	}
+	if body != nil {
+		req.Header.SetContentType(contentType)
+		req.SetBody(body)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := ose.client.Do(req, res)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		retry := false
+		for _, status := range retryOnStatus {
+			if res.StatusCode() == status {
+				retry = true
+			}
+		}
+		if !retry || attempt > maxRetries {
+			break
+		}
+		time.Sleep(exponentialBackoff(attempt))
+	}
+
+	// Copy the body, as it won't be valid after the response is released.
+	resBody := make([]byte, len(res.Body()))
+	copy(resBody, res.Body())
+
+	return res.StatusCode(), resBody, nil
+}
+
+// bootstrapMapping creates the index or index template for the exporter
+// using the configured mapping file, if one was given.
+// If the index template contains placeholders or data streams are enabled,
+// then an index template is created to match every index the exporter may
+// send documents to. Otherwise the index itself is created if it doesn't exist.
+func (ose *OpenSearchExporter) bootstrapMapping() error {
+	if len(ose.mappingPath) == 0 {
+		return nil
+	}
+
+	mappingBytes, err := ioutil.ReadFile(ose.mappingPath)
+	if err != nil {
+		return fmt.Errorf(
+			"unable to read mapping file at %s: %s", ose.mappingPath, err,
+		)
+	}
+	var mapping map[string]interface{}
+	if err := json.Unmarshal(mappingBytes, &mapping); err != nil {
+		return fmt.Errorf(
+			"unable to parse mapping file at %s: %s", ose.mappingPath, err,
+		)
+	}
+
+	var (
+		path string
+		body map[string]interface{}
+	)
+	if ose.index.IsStatic() && !ose.dataStream {
+		status, _, err := ose.do("HEAD", "/"+ose.index.String(), "", nil)
+		if err != nil {
+			return err
+		}
+		if status == fasthttp.StatusOK {
+			log.Info().
+				Str("index", ose.index.String()).
+				Msg("Index already exists, skipping mapping bootstrap.")
+			return nil
+		}
+		path = "/" + ose.index.String()
+		body = map[string]interface{}{
+			"mappings": mapping,
+		}
+	} else {
+		name := openSearchTemplateNameRegex.ReplaceAllString(
+			strings.ToLower(ose.index.String()), "-",
+		)
+		path = "/_index_template/" + strings.Trim(name, "-")
+		body = map[string]interface{}{
+			"index_patterns": []string{ose.index.Pattern()},
+			"template": map[string]interface{}{
+				"mappings": mapping,
+			},
+		}
+		if ose.dataStream {
+			body["data_stream"] = map[string]interface{}{}
+		}
+	}
+
+	marshalled, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	status, resBody, err := ose.do("PUT", path, "application/json", marshalled)
+	if err != nil {
+		return err
+	}
+	if status != fasthttp.StatusOK {
+		return fmt.Errorf(
+			"unable to bootstrap mapping at %s, got status %d: %s",
+			path, status, resBody,
+		)
+	}
+
+	log.Info().
+		Str("path", path).
+		Msg("Bootstrapped mapping for OpenSearchExporter.")
+	return nil
+}
+
+// Healthcheck gets information about the OpenSearch cluster, reporting its
+// distribution and version, then bootstraps the index mapping.
+func (ose *OpenSearchExporter) Healthcheck() error {
+	_healthcheck_failed_str := "Healthcheck failed for OpenSearchExporter"
+
+	if ose.client == nil {
+		err := errors.New(
+			"Healthcheck called on OpenSearchExporter which hasn't been setup yet",
+		)
+		log.Warn().
+			Err(err).
+			Msg("Was Setup called on the OpenSearchExporter?")
+		return err
+	}
+
+	status, body, err := ose.do("GET", "/", "", nil)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Msgf("%s, go-level error when getting cluster info", _healthcheck_failed_str)
+		return err
+	}
+	if status != fasthttp.StatusOK {
+		log.Warn().
+			Int("status", status).
+			Bytes("response", body).
+			Msgf("%s, opensearch-level error when getting cluster info", _healthcheck_failed_str)
+		return fmt.Errorf("%s: %d %s", _healthcheck_failed_str, status, body)
+	}
+
+	var clusterInfo struct {
+		Version struct {
+			Distribution string `json:"distribution"`
+			Number       string `json:"number"`
+		} `json:"version"`
+	}
+	if err := json.Unmarshal(body, &clusterInfo); err != nil {
+		log.Warn().
+			Bytes("response_body", body).
+			Msgf("%s, unable to decode response body", _healthcheck_failed_str)
+		return fmt.Errorf("%s: %s", _healthcheck_failed_str, err)
+	}
+
+	ose.distribution = clusterInfo.Version.Distribution
+	ose.version = clusterInfo.Version.Number
+	if ose.distribution != "opensearch" {
+		log.Warn().
+			Str("distribution", ose.distribution).
+			Msg("Server does not report itself as an OpenSearch distribution.")
+	}
+
+	if err := ose.bootstrapMapping(); err != nil {
+		log.Warn().
+			Err(err).
+			Msgf("%s, unable to bootstrap mapping", _healthcheck_failed_str)
+		return err
+	}
+
+	log.Info().
+		Str("distribution", ose.distribution).
+		Str("server_version", ose.version).
+		Msg("Healthcheck for OpenSearchExporter successful!")
+	return nil
+}
+
+// Marshal turns the given payload into json.
+func (ose *OpenSearchExporter) Marshal(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+// Export adds the given payload to the bulk request buffer, flushing the
+// buffer to OpenSearch if it has grown large enough.
+func (ose *OpenSearchExporter) Export(payload []byte) error {
+	index, routed, err := routeDocument(ose.index, ose.dataStream, payload)
+	if err != nil {
+		log.Error().
+			Err(err).
+			Bytes("payload", payload).
+			Msg("Unable to route payload to an index")
+		return err
+	}
+	if len(index) == 0 {
+		index = ose.index.String()
+	}
+
+	action := "index"
+	if ose.dataStream {
+		// Data streams are append-only, and only accept the create action.
+		action = "create"
+	}
+
+	meta, err := json.Marshal(
+		map[string]map[string]string{
+			action: {"_index": index},
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	ose.buffer.Write(meta)
+	ose.buffer.WriteByte('\n')
+	ose.buffer.Write(routed)
+	ose.buffer.WriteByte('\n')
+	ose.pending = append(ose.pending, routed)
+	ose.report.NumAdded++
+
+	log.Debug().
+		Int("size", len(routed)).
+		Msg("Successfully queued item for export")
+
+	if ose.buffer.Len() >= openSearchFlushBytes {
+		return ose.Flush()
+	}
+	return nil
+}
+
+// failPending marks every pending document as failed with the given reason.
+func (ose *OpenSearchExporter) failPending(reason string) {
+	for _, document := range ose.pending {
+		ose.report.NumFailed++
+		ose.report.AddFailure(document, reason)
+	}
+}
+
+// Flush sends the contents of the bulk request buffer to OpenSearch.
+func (ose *OpenSearchExporter) Flush() error {
+	if ose.buffer.Len() == 0 {
+		return nil
+	}
+
+	body := make([]byte, ose.buffer.Len())
+	copy(body, ose.buffer.Bytes())
+	ose.buffer.Reset()
+	defer func() { ose.pending = [][]byte{} }()
+
+	start := time.Now()
+	status, resBody, err := ose.do("POST", "/_bulk", "application/x-ndjson", body)
+	ose.report.AddLatency(time.Since(start))
+	if err != nil {
+		ose.failPending(err.Error())
+		log.Warn().
+			Err(err).
+			Msg("go-level error while sending bulk request.")
+		return err
+	}
+	if status != fasthttp.StatusOK {
+		ose.failPending(fmt.Sprintf("bulk request failed with status %d: %s", status, resBody))
+		log.Warn().
+			Int("status", status).
+			Bytes("response", resBody).
+			Msg("opensearch-level error while sending bulk request.")
+		return fmt.Errorf("bulk request failed with status %d", status)
+	}
+
+	var bulkResponse openSearchBulkResponse
+	if err := json.Unmarshal(resBody, &bulkResponse); err != nil {
+		ose.failPending(fmt.Sprintf("unable to decode bulk response: %s", err))
+		return fmt.Errorf("unable to decode bulk response: %s", err)
+	}
+
+	ose.report.NumFlushed += uint64(len(ose.pending))
+	for i, item := range bulkResponse.Items {
+		for _, result := range item {
+			if result.Status > 201 {
+				ose.report.NumFailed++
+				if i < len(ose.pending) {
+					ose.report.AddFailure(
+						ose.pending[i],
+						fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason),
+					)
+				}
+				log.Warn().
+					Str("error_type", result.Error.Type).
+					Str("error_reason", result.Error.Reason).
+					Msg("opensearch-level error while indexing with bulk request.")
+			} else {
+				ose.report.NumIndexed++
+			}
+		}
+	}
+	return nil
+}
+
+// Report returns a summary of the documents handled by the exporter, as of
+// the last call to Flush or Teardown.
+func (ose *OpenSearchExporter) Report() []*define.ExportReport {
+	report := ose.report
+	report.Failures = append([]define.ExportFailure{}, ose.report.Failures...)
+	return []*define.ExportReport{&report}
+}
+
+// Teardown flushes any remaining documents to OpenSearch.
+// An error is returned if any document failed to be indexed.
+func (ose *OpenSearchExporter) Teardown() error {
+	if err := ose.Flush(); err != nil {
+		log.Error().
+			Err(err).
+			Msg("Unexpected error while flushing bulk request.")
+		return err
+	}
+	if ose.report.NumFailed > 0 {
+		err := errors.New(
+			"one or more documents were not exported successfully",
+		)
+		log.Error().
+			Err(err).
+			Uint64("num_failed", ose.report.NumFailed).
+			Uint64("num_indexed", ose.report.NumIndexed).
+			Uint64("num_added", ose.report.NumAdded).
+			Msg("Unable to teardown OpenSearch Exporter.")
+		return err
+	}
+	log.Info().
+		Msg("Teardown for OpenSearchExporter successful!")
+	return nil
+}
@@ -0,0 +1,207 @@
+package exporters
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/learnitall/gobench/define"
+)
+
+var OPENSEARCH_HEALTHCHECK_RESPONSE_STR string = `{
+	"name" : "opensearch-node1",
+	"cluster_name" : "opensearch-cluster",
+	"cluster_uuid" : "W0B8EuZsQfq8IkiN1VbUuQ",
+	"version" : {
+	  "distribution" : "opensearch",
+	  "number" : "1.2.4",
+	  "build_type" : "tar",
+	  "build_hash" : "e505b10357c03ae8d26d675172402f2f2144ef0f",
+	  "build_date" : "2022-01-14T03:38:06.881862Z",
+	  "build_snapshot" : false,
+	  "lucene_version" : "8.10.1",
+	  "minimum_wire_compatibility_version" : "6.8.0",
+	  "minimum_index_compatibility_version" : "6.0.0-beta1"
+	},
+	"tagline" : "The OpenSearch Project: https://opensearch.org/"
+  }`
+
+var OPENSEARCH_BULK_RESPONSE_PARTIAL_FAILURE_STR string = `{
+	"took": 5,
+	"errors": true,
+	"items": [
+		{"index": {"_index": "myindex", "_id": "1", "status": 201}},
+		{"index": {"_index": "myindex", "_id": "2", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse"}}}
+	]
+}`
+
+// getOpenSearchConfig returns a Config pointing at the given test server.
+func getOpenSearchConfig(url string) *define.Config {
+	return &define.Config{
+		OpenSearchURL:        url,
+		OpenSearchIndex:      "myIndex",
+		OpenSearchSkipVerify: true,
+		OpenSearchUsername:   "admin",
+		OpenSearchPassword:   "admin",
+	}
+}
+
+// TestOpenSearchExporterImplementsExporterInterface does a quick check to make sure
+// that the OpenSearchExporter can successfully be type asserted as a define.Exporterable.
+func TestOpenSearchExporterImplementsExporterInterface(t *testing.T) {
+	var ose interface{} = &OpenSearchExporter{}
+	_, ok := ose.(define.Exporterable)
+
+	// Can use this line to help debug problems within IDE
+	// var _ define.Exporterable = &OpenSearchExporter{}
+
+	if !ok {
+		t.Errorf(
+			"OpenSearchExporter failed Exporterable type assertion",
+		)
+	}
+}
+
+// TestOpenSearchExporterHealthcheck mocks an OpenSearch server to determine
+// if the healthcheck reports the server's distribution, sends credentials
+// and bootstraps the configured mapping.
+func TestOpenSearchExporterHealthcheck(t *testing.T) {
+	var mappingBody string
+	testServer, testServerURL := getTestServer(
+		t,
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				username, password, ok := r.BasicAuth()
+				if !ok || username != "admin" || password != "admin" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				switch {
+				case r.Method == "GET" && r.URL.Path == "/":
+					fmt.Fprint(w, OPENSEARCH_HEALTHCHECK_RESPONSE_STR)
+				case r.Method == "HEAD" && r.URL.Path == "/myIndex":
+					w.WriteHeader(http.StatusNotFound)
+				case r.Method == "PUT" && r.URL.Path == "/myIndex":
+					body, _ := ioutil.ReadAll(r.Body)
+					mappingBody = string(body)
+					fmt.Fprint(w, `{"acknowledged": true}`)
+				default:
+					w.WriteHeader(http.StatusBadRequest)
+				}
+			},
+		),
+	)
+	defer testServer.Close()
+
+	cfg := getOpenSearchConfig(testServerURL.String())
+	cfg.OpenSearchMappingPath = filepath.Join("..", "mappings", "uperf.json")
+	ose := OpenSearchExporter{}
+	if err := ose.Setup(cfg); err != nil {
+		t.Fatalf("Got error during setup: %s", err)
+	}
+	if err := ose.Healthcheck(); err != nil {
+		t.Fatalf("Got error during healthcheck: %s", err)
+	}
+
+	if ose.distribution != "opensearch" || ose.version != "1.2.4" {
+		t.Errorf(
+			"Expected distribution opensearch and version 1.2.4, instead got %s and %s",
+			ose.distribution, ose.version,
+		)
+	}
+	if !strings.Contains(mappingBody, `"mappings"`) || !strings.Contains(mappingBody, `"SectionType"`) {
+		t.Errorf("Expected mapping to be bootstrapped, instead got body: %s", mappingBody)
+	}
+}
+
+// TestOpenSearchExporterCountsFailures mocks an OpenSearch server which fails
+// to index one of two documents, making sure that the failure is counted
+// and Teardown returns an error.
+func TestOpenSearchExporterCountsFailures(t *testing.T) {
+	var bulkBody string
+	testServer, testServerURL := getTestServer(
+		t,
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				bulkBody = string(body)
+				fmt.Fprint(w, OPENSEARCH_BULK_RESPONSE_PARTIAL_FAILURE_STR)
+			},
+		),
+	)
+	defer testServer.Close()
+
+	ose := OpenSearchExporter{}
+	if err := ose.Setup(getOpenSearchConfig(testServerURL.String())); err != nil {
+		t.Fatalf("Got error during setup: %s", err)
+	}
+
+	for _, value := range []string{"one", "two"} {
+		payload, err := ose.Marshal(MockPayload{Key: value})
+		if err != nil {
+			t.Fatalf("Got error during marshal: %s", err)
+		}
+		if err := ose.Export(payload); err != nil {
+			t.Fatalf("Got error during export: %s", err)
+		}
+	}
+
+	if err := ose.Teardown(); err == nil {
+		t.Error("Expected error while calling Teardown, instead got nil")
+	}
+
+	if strings.Count(bulkBody, `{"index":{"_index":"myIndex"}}`) != 2 {
+		t.Errorf("Expected two index actions within bulk request, instead got: %s", bulkBody)
+	}
+	report := ose.Report()[0]
+	if report.NumAdded != 2 || report.NumIndexed != 1 || report.NumFailed != 1 {
+		t.Errorf(
+			"Expected report to show 2 documents added, 1 indexed and 1 failed, instead got: %+v",
+			report,
+		)
+	}
+	if len(report.Failures) != 1 || !strings.Contains(report.Failures[0].Document, "two") ||
+		!strings.Contains(report.Failures[0].Reason, "mapper_parsing_exception") {
+		t.Errorf(
+			"Expected report to contain the failed document and reason, instead got: %+v",
+			report.Failures,
+		)
+	}
+}
+
+// TestOpenSearchExporterFlushBadStatus mocks an OpenSearch server which
+// rejects bulk requests, making sure that Flush returns an error and every
+// pending document is counted as failed.
+func TestOpenSearchExporterFlushBadStatus(t *testing.T) {
+	testServer, testServerURL := getTestServer(
+		t,
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+			},
+		),
+	)
+	defer testServer.Close()
+
+	ose := OpenSearchExporter{}
+	if err := ose.Setup(getOpenSearchConfig(testServerURL.String())); err != nil {
+		t.Fatalf("Got error during setup: %s", err)
+	}
+	payload, err := ose.Marshal(MockPayload{Key: "one"})
+	if err != nil {
+		t.Fatalf("Got error during marshal: %s", err)
+	}
+	if err := ose.Export(payload); err != nil {
+		t.Fatalf("Got error during export: %s", err)
+	}
+
+	if err := ose.Flush(); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("Expected error with the response status from Flush, instead got: %v", err)
+	}
+	if report := ose.Report()[0]; report.NumFailed != 1 {
+		t.Errorf("Expected report to show 1 document failed, instead got: %+v", report)
+	}
+}
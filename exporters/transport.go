@@ -0,0 +1,141 @@
+// transport.go implements the http transport shared between the exporters
+// which send benchmark results to a search engine over http.
+package exporters
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+// retryOnStatus lists the http status codes which cause a request to be retried.
+// These options are referenced from
+// https://github.com/elastic/go-elasticsearch/blob/main/_examples/bulk/indexer.go
+var retryOnStatus []int = []int{502, 503, 504, 429}
+
+// maxRetries is the maximum number of times a request will be retried.
+const maxRetries int = 5
+
+// fasthttpTransport replaces elasticsearch's http client, based on net/http,
+// with the http client provided by github.com/valyala/fasthttp
+// Reference: https://github.com/elastic/go-elasticsearch/blob/main/_examples/fasthttp/fasthttp.go
+type fasthttpTransport struct {
+	_client              *fasthttp.Client
+	_injectProductHeader bool
+}
+
+// copyRequest converts a http.Request to fasthttp.Request
+func (t *fasthttpTransport) copyRequest(dst *fasthttp.Request, src *http.Request) *fasthttp.Request {
+	if src.Method == "GET" && src.Body != nil {
+		src.Method = "POST"
+	}
+
+	dst.SetHost(src.Host)
+	dst.SetRequestURI(src.URL.String())
+
+	dst.Header.SetRequestURI(src.URL.String())
+	dst.Header.SetMethod(src.Method)
+
+	for k, vv := range src.Header {
+		for _, v := range vv {
+			dst.Header.Set(k, v)
+		}
+	}
+
+	if src.Body != nil {
+		dst.SetBodyStream(src.Body, -1)
+	}
+
+	return dst
+}
+
+// copyResponse converts a fasthttp.Response to a http.Response
+func (t *fasthttpTransport) copyResponse(dst *http.Response, src *fasthttp.Response) *http.Response {
+	dst.StatusCode = src.StatusCode()
+
+	src.Header.VisitAll(func(k, v []byte) {
+		dst.Header.Set(string(k), string(v))
+	})
+
+	// https://towardsaws.com/elasticsearch-the-server-is-not-a-supported-distribution-of-elasticsearch-252abc1bd92
+	if t._injectProductHeader {
+		dst.Header.Set("X-Elastic-Product", "Elasticsearch")
+	}
+
+	// Cast to a string to make a copy seeing as src.Body() won't
+	// be valid after the response is released back to the pool (fasthttp.ReleaseResponse).
+	dst.Body = ioutil.NopCloser(strings.NewReader(string(src.Body())))
+
+	return dst
+}
+
+// RoundTrip performs the request and returns a response or error
+func (t *fasthttpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	freq := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(freq)
+
+	fres := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(fres)
+
+	t.copyRequest(freq, req)
+
+	err := t._client.Do(freq, fres)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &http.Response{Header: make(http.Header)}
+	t.copyResponse(res, fres)
+
+	return res, nil
+}
+
+// newFasthttpClient creates a new fasthttp.Client with the given TLS options.
+// If caCertPath is not empty, the PEM-encoded certificates within the file
+// are used to verify the server's certificate.
+func newFasthttpClient(skipVerify bool, caCertPath string) (*fasthttp.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: skipVerify,
+	}
+
+	if caCertPath != "" {
+		caCert, err := ioutil.ReadFile(caCertPath)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"unable to read CA certificate at %s: %s", caCertPath, err,
+			)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf(
+				"unable to parse CA certificate at %s", caCertPath,
+			)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &fasthttp.Client{
+		TLSConfig: tlsConfig,
+	}, nil
+}
+
+// exponentialBackoff returns how long to wait before the given retry attempt,
+// using binary exponential backoff.
+func exponentialBackoff(attempt int) time.Duration {
+	log.Warn().
+		Int("total_retries", attempt-1).
+		Msg("Backing off before retrying request")
+	return time.Duration(
+		math.Floor(
+			math.Pow(2, float64(attempt)),
+		),
+	) * time.Second
+}
@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"path/filepath"
+
+	"github.com/learnitall/gobench/artifacts"
+	"github.com/learnitall/gobench/define"
+	"github.com/learnitall/gobench/exporters"
+	"github.com/rs/zerolog/log"
+)
+
+// ConfiguredExporters returns the exporters configured within the given
+// Config, along with the ChainPolicy of each. Exporters named within the
+// Config's BestEffortExporters are given the best-effort policy.
+func ConfiguredExporters(config *define.Config) ([]define.Exporterable, []exporters.ChainPolicy) {
+	configuredExporters := []define.Exporterable{}
+	policies := []exporters.ChainPolicy{}
+	bestEffort := map[string]bool{}
+	for _, name := range config.BestEffortExporters {
+		switch name {
+		case "elasticsearch", "opensearch", "json":
+			bestEffort[name] = true
+		default:
+			log.Warn().
+				Str("exporter", name).
+				Msg("Unknown exporter given as best-effort, ignoring.")
+		}
+	}
+	addExporter := func(name string, exporter define.Exporterable) {
+		configuredExporters = append(configuredExporters, exporter)
+		if bestEffort[name] {
+			policies = append(policies, exporters.ChainPolicyBestEffort)
+		} else {
+			policies = append(policies, exporters.ChainPolicyRequired)
+		}
+	}
+
+	if config.ElasticsearchURL != "" {
+		log.Info().Msg("Creating ElasticsearchExporter.")
+		addExporter("elasticsearch", &exporters.ElasticsearchExporter{})
+	}
+	if config.OpenSearchURL != "" {
+		log.Info().Msg("Creating OpenSearchExporter.")
+		addExporter("opensearch", &exporters.OpenSearchExporter{})
+	}
+	if config.PrintJson {
+		log.Info().Msg("Creating JsonExporter.")
+		addExporter("json", &exporters.JsonExporter{})
+	}
+	return configuredExporters, policies
+}
+
+// exporter returns the Exporterable for a run with the given Config, being
+// the Runner's exporters or those configured within the Config if it has
+// none.
+// If the Config has an artifacts directory, then every document is also
+// written into it by a best-effort DocumentsExporter.
+func (r *Runner) exporter(config *define.Config) define.Exporterable {
+	configuredExporters := append([]define.Exporterable{}, r.exporters...)
+	policies := append([]exporters.ChainPolicy{}, r.policies...)
+	if len(configuredExporters) == 0 {
+		configuredExporters, policies = ConfiguredExporters(config)
+	}
+
+	if len(configuredExporters) == 0 {
+		log.Warn().Msg("No exporter configured, using dummy exporter.")
+		if config.ArtifactsDir == "" {
+			return &exporters.DummyExporter{}
+		}
+	}
+	if config.ArtifactsDir != "" {
+		configuredExporters = append(configuredExporters, &exporters.DocumentsExporter{
+			Path: filepath.Join(config.ArtifactsDir, artifacts.DocumentsFile),
+		})
+		policies = append(policies, exporters.ChainPolicyBestEffort)
+	}
+
+	if len(configuredExporters) == 1 && policies[0] == exporters.ChainPolicyRequired {
+		return configuredExporters[0]
+	} else {
+		return &exporters.ChainExporter{
+			Exporters: configuredExporters,
+			Policies:  policies,
+		}
+	}
+}
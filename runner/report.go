@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/learnitall/gobench/artifacts"
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+)
+
+// ExportReports sends the given reports through the given exporter, so they
+// are stored alongside the benchmark's results.
+func ExportReports(cfg *define.Config, exporter define.Exporterable, reports []*define.ExportReport) error {
+	metadata := define.GetMetadataPayload(cfg)
+	for _, report := range reports {
+		report.Metadata = &metadata
+		marshalled, err := exporter.Marshal(report)
+		if err != nil {
+			return err
+		}
+		if err := exporter.Export(marshalled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportTimeline sends each event within the given Timeline through the given
+// exporter, so the stages of the run can be lined up against its results.
+func ExportTimeline(cfg *define.Config, name string, exporter define.Exporterable, timeline *define.Timeline) error {
+	metadata := define.GetMetadataPayload(cfg)
+	metadata.Benchmark = name
+	for _, event := range timeline.Events() {
+		event.SetMetadata(&metadata)
+		marshalled, err := exporter.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err := exporter.Export(marshalled); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteReports writes the given reports as a json array to the given path.
+func WriteReports(path string, reports []*define.ExportReport) error {
+	marshalled, err := json.MarshalIndent(reports, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, marshalled, 0644)
+}
+
+// writeRunReports writes the given reports to the Config's ReportPath and
+// artifacts directory, if they are set. Failing to save the reports into the
+// artifacts directory is only logged.
+func writeRunReports(cfg *define.Config, reports []*define.ExportReport) error {
+	if len(cfg.ArtifactsDir) > 0 {
+		if err := WriteReports(filepath.Join(cfg.ArtifactsDir, artifacts.ReportFile), reports); err != nil {
+			log.Warn().
+				Err(err).
+				Msg("Unable to save export report to the artifacts directory.")
+		}
+	}
+	if cfg.ReportPath != "" {
+		return WriteReports(cfg.ReportPath, reports)
+	}
+	return nil
+}
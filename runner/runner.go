@@ -0,0 +1,225 @@
+// Package runner runs benchmarks and exports their results, allowing gobench
+// to be used as a library. Each Runner holds its own Config, so runs with
+// different options can happen within the same process.
+package runner
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/learnitall/gobench/artifacts"
+	"github.com/learnitall/gobench/define"
+	"github.com/learnitall/gobench/exporters"
+	"github.com/rs/zerolog/log"
+)
+
+// Runner runs benchmarks with a Config and a set of exporters. Create one
+// with New.
+// If no exporters are given, then the exporters configured within the Config
+// are used, such as Elasticsearch if it has an ElasticsearchURL.
+type Runner struct {
+	config    define.Config
+	exporters []define.Exporterable
+	policies  []exporters.ChainPolicy
+}
+
+// Option configures a Runner created by New.
+type Option func(*Runner)
+
+// Result describes a single run of a benchmark.
+// Reports summarizes each exporter, and is nil if the run failed during
+// setup. It is still set if exporting failed. ArtifactsDir is empty if
+// artifacts are disabled.
+type Result struct {
+	RunID        string
+	ArtifactsDir string
+	Reports      []*define.ExportReport
+	Timeline     []*define.TimelineEvent
+}
+
+// New creates a Runner with the given Options applied, in order, on top of
+// the defaults given by define.NewConfig.
+func New(opts ...Option) *Runner {
+	r := &Runner{config: *define.NewConfig()}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// WithConfig uses a copy of the given Config, replacing any options given
+// before it.
+func WithConfig(cfg *define.Config) Option {
+	return func(r *Runner) {
+		r.config = copyConfig(cfg)
+	}
+}
+
+// WithRunID sets the ID of the next run. If it isn't set, then each run is
+// given its own generated ID.
+func WithRunID(runID string) Option {
+	return func(r *Runner) {
+		r.config.RunID = runID
+	}
+}
+
+// WithTags adds the given tags to the metadata of every exported document.
+func WithTags(tags map[string]string) Option {
+	return func(r *Runner) {
+		for key, value := range tags {
+			r.config.Tags[key] = value
+		}
+	}
+}
+
+// WithTimeout stops benchmarks which run for longer than the given duration.
+func WithTimeout(timeout time.Duration) Option {
+	return func(r *Runner) {
+		r.config.Timeout = timeout
+	}
+}
+
+// WithArtifactsDir saves the artifacts of each run to the given directory.
+func WithArtifactsDir(dir string) Option {
+	return func(r *Runner) {
+		r.config.ArtifactsDir = dir
+		r.config.DisableArtifacts = false
+	}
+}
+
+// WithoutArtifacts disables saving artifacts for each run.
+func WithoutArtifacts() Option {
+	return func(r *Runner) {
+		r.config.DisableArtifacts = true
+	}
+}
+
+// WithExporter exports results to the given exporter. Errors from it fail the
+// run. It replaces the exporters configured within the Config. The exporter
+// is setup and torn down by each run.
+func WithExporter(exporter define.Exporterable) Option {
+	return func(r *Runner) {
+		r.exporters = append(r.exporters, exporter)
+		r.policies = append(r.policies, exporters.ChainPolicyRequired)
+	}
+}
+
+// WithBestEffortExporter is like WithExporter, but errors from the given
+// exporter are logged rather than failing the run.
+func WithBestEffortExporter(exporter define.Exporterable) Option {
+	return func(r *Runner) {
+		r.exporters = append(r.exporters, exporter)
+		r.policies = append(r.policies, exporters.ChainPolicyBestEffort)
+	}
+}
+
+// copyConfig returns a copy of the given Config which doesn't share its tags
+// or exporter lists.
+func copyConfig(cfg *define.Config) define.Config {
+	copied := *cfg
+	copied.Tags = map[string]string{}
+	for key, value := range cfg.Tags {
+		copied.Tags[key] = value
+	}
+	copied.BestEffortExporters = append([]string{}, cfg.BestEffortExporters...)
+	return copied
+}
+
+// Config returns a copy of the Runner's Config.
+func (r *Runner) Config() define.Config {
+	return copyConfig(&r.config)
+}
+
+// Run runs the given benchmark and exports its results, returning a Result
+// describing the run.
+// The given name is attached to the timeline events recorded during the run.
+// Each run works on its own copy of the Runner's Config, given its own RunID
+// if one isn't set. If artifacts aren't disabled, then the artifacts
+// directory is created and the resolved config is saved within it.
+// Once the benchmark has been setup, it and the exporter are always torn
+// down, even if the run fails. If the benchmark or the export fails, then
+// the export is still reported before its error is returned. Otherwise,
+// an error is returned if failed documents break the Config's
+// ExportFailurePolicy.
+func (r *Runner) Run(name string, bench define.Benchmarkable) (*Result, error) {
+	var timeline define.Timeline
+	cfg := copyConfig(&r.config)
+	if len(cfg.RunID) == 0 {
+		cfg.RunID = uuid.New().String()
+	}
+	cfg.ArtifactsDir = artifacts.Dir(&cfg)
+	result := &Result{RunID: cfg.RunID, ArtifactsDir: cfg.ArtifactsDir}
+
+	policy, err := define.ParseExportFailurePolicy(cfg.ExportFailurePolicy)
+	if err != nil {
+		return result, err
+	}
+	if len(cfg.ArtifactsDir) > 0 {
+		if err := os.MkdirAll(cfg.ArtifactsDir, 0755); err != nil {
+			return result, fmt.Errorf("unable to create artifacts directory %s: %s", cfg.ArtifactsDir, err)
+		}
+		if err := artifacts.WriteConfig(cfg.ArtifactsDir, &cfg); err != nil {
+			return result, err
+		}
+	}
+	exporter := r.exporter(&cfg)
+
+	timeline.Record(define.TimelineSetupStart)
+	if err := exporter.Setup(&cfg); err != nil {
+		return result, err
+	}
+	if err := exporter.Healthcheck(); err != nil {
+		exporter.Teardown()
+		return result, err
+	}
+	if err := bench.Setup(&cfg); err != nil {
+		bench.Teardown(&cfg)
+		exporter.Teardown()
+		return result, err
+	}
+	timeline.Record(define.TimelineSetupEnd)
+
+	// Keep going if the benchmark fails, so documents it exported describing
+	// the failure are still flushed and reported
+	timeline.Record(define.TimelineBenchmarkStart)
+	runErr := bench.Run(exporter)
+	timeline.Record(define.TimelineBenchmarkEnd)
+	if runErr != nil {
+		log.Error().
+			Err(runErr).
+			Msg("Benchmark failed, flushing exported documents before exiting.")
+	}
+
+	timeline.Record(define.TimelineExportFlushStart)
+	exportErr := exporter.Flush()
+	timeline.Record(define.TimelineExportFlushEnd)
+	if exportErr == nil {
+		exportErr = ExportReports(&cfg, exporter, exporter.Report())
+	}
+	if exportErr == nil {
+		exportErr = ExportTimeline(&cfg, name, exporter, &timeline)
+	}
+	result.Timeline = timeline.Events()
+
+	// Don't want to stop on these, as doing so
+	// would interrupt other cleanup tasks
+	bench.Teardown(&cfg)
+	exporter.Teardown()
+
+	// Report on the export even if it failed, as the report holds the
+	// documents which failed and why
+	result.Reports = exporter.Report()
+	writeErr := writeRunReports(&cfg, result.Reports)
+	if exportErr != nil {
+		return result, exportErr
+	}
+	if writeErr != nil {
+		return result, writeErr
+	}
+	if runErr != nil {
+		return result, runErr
+	}
+	return result, policy.Check(result.Reports)
+}
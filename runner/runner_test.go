@@ -0,0 +1,219 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/learnitall/gobench/artifacts"
+	"github.com/learnitall/gobench/define"
+)
+
+// runnerTestExporter is a simple Exporterable which holds each payload
+// exported to it. Its report gives failed as the number of failed documents,
+// and Flush returns flushErr.
+type runnerTestExporter struct {
+	cfg      *define.Config
+	failed   uint64
+	flushErr error
+	lock     sync.Mutex
+	exported []string
+}
+
+func (rte *runnerTestExporter) Setup(cfg *define.Config) error {
+	rte.cfg = cfg
+	return nil
+}
+
+func (rte *runnerTestExporter) Healthcheck() error {
+	return nil
+}
+
+func (rte *runnerTestExporter) Marshal(payload interface{}) ([]byte, error) {
+	return json.Marshal(payload)
+}
+
+func (rte *runnerTestExporter) Export(payload []byte) error {
+	rte.lock.Lock()
+	defer rte.lock.Unlock()
+	rte.exported = append(rte.exported, string(payload))
+	return nil
+}
+
+func (rte *runnerTestExporter) Flush() error {
+	return rte.flushErr
+}
+
+func (rte *runnerTestExporter) Report() []*define.ExportReport {
+	rte.lock.Lock()
+	defer rte.lock.Unlock()
+	return []*define.ExportReport{{
+		Exporter:  "test",
+		NumAdded:  uint64(len(rte.exported)),
+		NumFailed: rte.failed,
+	}}
+}
+
+func (rte *runnerTestExporter) Teardown() error {
+	return nil
+}
+
+// runnerTestBenchmark is a simple Benchmarkable which exports a single
+// payload, then returns err.
+type runnerTestBenchmark struct {
+	cfg      *define.Config
+	err      error
+	tornDown bool
+}
+
+func (rtb *runnerTestBenchmark) Setup(cfg *define.Config) error {
+	rtb.cfg = cfg
+	return nil
+}
+
+func (rtb *runnerTestBenchmark) Run(exporter define.Exporterable) error {
+	marshalled, err := exporter.Marshal(map[string]string{"result": rtb.cfg.RunID})
+	if err != nil {
+		return err
+	}
+	if err := exporter.Export(marshalled); err != nil {
+		return err
+	}
+	return rtb.err
+}
+
+func (rtb *runnerTestBenchmark) Teardown(cfg *define.Config) error {
+	rtb.tornDown = true
+	return nil
+}
+
+// TestRunExportsResults checks that a run exports the benchmark's results,
+// its reports and its timeline, and saves its artifacts.
+func TestRunExportsResults(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "artifacts")
+	exporter := &runnerTestExporter{}
+	bench := &runnerTestBenchmark{}
+	result, err := New(
+		WithRunID("run-1"),
+		WithTags(map[string]string{"team": "perf"}),
+		WithArtifactsDir(dir),
+		WithExporter(exporter),
+	).Run("test", bench)
+	if err != nil {
+		t.Fatalf("Unexpected error when running benchmark: %s", err)
+	}
+
+	if bench.cfg.RunID != "run-1" || bench.cfg.Tags["team"] != "perf" || !bench.tornDown {
+		t.Errorf("Expected benchmark to be run with the Runner's options and torn down, instead got %+v", bench.cfg)
+	}
+	if result.RunID != "run-1" || result.ArtifactsDir != dir || len(result.Reports) != 2 {
+		t.Errorf("Expected result to describe the run, instead got %+v", result)
+	}
+	// The benchmark's result, one report from each exporter, then 6 timeline events
+	if len(exporter.exported) != 9 || !strings.Contains(exporter.exported[0], "run-1") {
+		t.Errorf("Expected results, reports and timeline to be exported, instead got %v", exporter.exported)
+	}
+	if len(result.Timeline) != 6 || result.Timeline[0].Metadata.Benchmark != "test" {
+		t.Errorf("Expected the run's timeline within the result, instead got %+v", result.Timeline)
+	}
+	for _, name := range []string{artifacts.ConfigFile, artifacts.DocumentsFile, artifacts.ReportFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected artifact %s to be saved, instead got: %s", name, err)
+		}
+	}
+}
+
+// TestRunFailures checks that benchmark and export errors are returned after
+// the export is reported, and that failed documents are checked against the
+// Config's ExportFailurePolicy.
+func TestRunFailures(t *testing.T) {
+	exporter := &runnerTestExporter{}
+	result, err := New(WithoutArtifacts(), WithExporter(exporter)).Run(
+		"test", &runnerTestBenchmark{err: fmt.Errorf("benchmark failed")},
+	)
+	if err == nil || err.Error() != "benchmark failed" {
+		t.Errorf("Expected benchmark error, instead got: %v", err)
+	}
+	if len(result.Reports) != 1 || result.ArtifactsDir != "" {
+		t.Errorf("Expected failed run to be reported without artifacts, instead got %+v", result)
+	}
+
+	// The export is still reported when it fails
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	cfg := define.NewConfig()
+	cfg.DisableArtifacts = true
+	cfg.ReportPath = reportPath
+	result, err = New(WithConfig(cfg), WithExporter(&runnerTestExporter{failed: 1, flushErr: fmt.Errorf("flush failed")})).Run(
+		"test", &runnerTestBenchmark{},
+	)
+	if err == nil || err.Error() != "flush failed" {
+		t.Errorf("Expected flush error, instead got: %v", err)
+	}
+	if len(result.Reports) != 1 || result.Reports[0].NumFailed != 1 {
+		t.Errorf("Expected failed export to be reported, instead got %+v", result.Reports)
+	}
+	if _, err := os.Stat(reportPath); err != nil {
+		t.Errorf("Expected report to be written after a failed export, instead got: %s", err)
+	}
+	cfg.ReportPath = ""
+
+	if _, err := New(WithConfig(cfg), WithExporter(&runnerTestExporter{failed: 1})).Run("test", &runnerTestBenchmark{}); err == nil {
+		t.Errorf("Expected error for failed documents, instead got nil")
+	}
+	// Failed documents from best-effort exporters are ignored by the policy
+	if _, err := New(
+		WithConfig(cfg),
+		WithExporter(&runnerTestExporter{}),
+		WithBestEffortExporter(&runnerTestExporter{failed: 1}),
+	).Run("test", &runnerTestBenchmark{}); err != nil {
+		t.Errorf("Expected failed documents from a best-effort exporter to be ignored, instead got: %s", err)
+	}
+	cfg.ExportFailurePolicy = string(define.ExportFailurePolicyNever)
+	if _, err := New(WithConfig(cfg), WithExporter(&runnerTestExporter{failed: 1})).Run("test", &runnerTestBenchmark{}); err != nil {
+		t.Errorf("Expected failed documents to be ignored, instead got: %s", err)
+	}
+}
+
+// TestRunnersAreIndependent checks that Runners with different Configs can
+// run at the same time, without their options leaking into each other.
+func TestRunnersAreIndependent(t *testing.T) {
+	cfg := define.NewConfig()
+	cfg.DisableArtifacts = true
+	cfg.Tags["host"] = "a"
+	first := New(WithConfig(cfg), WithExporter(&runnerTestExporter{}))
+	cfg.Tags["host"] = "b"
+	second := New(WithConfig(cfg), WithTags(map[string]string{"extra": "c"}), WithExporter(&runnerTestExporter{}))
+
+	benches := []*runnerTestBenchmark{{}, {}}
+	results := make([]*Result, 2)
+	var wg sync.WaitGroup
+	for i, r := range []*Runner{first, second} {
+		wg.Add(1)
+		go func(i int, r *Runner) {
+			defer wg.Done()
+			result, err := r.Run("test", benches[i])
+			if err != nil {
+				t.Errorf("Unexpected error when running benchmark: %s", err)
+			}
+			results[i] = result
+		}(i, r)
+	}
+	wg.Wait()
+
+	if benches[0].cfg.Tags["host"] != "a" || len(benches[0].cfg.Tags) != 1 {
+		t.Errorf("Expected first run to keep its own tags, instead got %v", benches[0].cfg.Tags)
+	}
+	if benches[1].cfg.Tags["host"] != "b" || benches[1].cfg.Tags["extra"] != "c" {
+		t.Errorf("Expected second run to have its own tags, instead got %v", benches[1].cfg.Tags)
+	}
+	if results[0].RunID == "" || results[0].RunID == results[1].RunID {
+		t.Errorf("Expected each run to be given its own RunID, instead got %s and %s", results[0].RunID, results[1].RunID)
+	}
+	if len(cfg.Tags) != 1 || cfg.RunID != "" {
+		t.Errorf("Expected given Config to be unchanged, instead got %+v", cfg)
+	}
+}
@@ -0,0 +1,211 @@
+// run.go defines functionality for running each step of a scenario.
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/learnitall/gobench/artifacts"
+	"github.com/learnitall/gobench/define"
+	"github.com/rs/zerolog/log"
+)
+
+// Tags added to the metadata of every document exported by a scenario,
+// naming the step and sample it belongs to.
+const (
+	StepTag   string = "step"
+	SampleTag string = "sample"
+)
+
+// Environment variables given to hooks and benchmarks run by a scenario.
+const (
+	CampaignIDEnv string = "GOBENCH_CAMPAIGN_ID"
+	StepEnv       string = "GOBENCH_STEP"
+)
+
+// RunStepFunc runs a single sample of the given step with the given Config,
+// which has its own RunID and holds the options given to the step.
+type RunStepFunc func(cfg *define.Config, step *Step) error
+
+// StepResult describes a single sample of a step. Samples which weren't run,
+// as an earlier step failed, are marked as Skipped. Failed hooks are given a
+// StepResult with a Sample of zero.
+type StepResult struct {
+	Step      string
+	Sample    int
+	RunID     string
+	Skipped   bool
+	StartTime time.Time
+	EndTime   time.Time
+	Err       error
+}
+
+// setEnv sets the given environment variables, returning a function which
+// restores their previous values.
+func setEnv(env map[string]string) func() {
+	previous := map[string]*string{}
+	for name, value := range env {
+		if old, existed := os.LookupEnv(name); existed {
+			previous[name] = &old
+		} else {
+			previous[name] = nil
+		}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, old := range previous {
+			if old == nil {
+				os.Unsetenv(name)
+			} else {
+				os.Setenv(name, *old)
+			}
+		}
+	}
+}
+
+// RunHooks runs each of the given shell commands with `sh -c`, stopping at
+// the first which fails. The kind of hook, ie pre or post, is used for
+// logging. The output of hooks is printed to stderr, so stdout is kept for
+// exported documents.
+func RunHooks(kind string, commands []string) error {
+	for _, command := range commands {
+		log.Info().
+			Str("hook", kind).
+			Str("command", command).
+			Msg("Running scenario hook.")
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook '%s' failed: %s", kind, command, err)
+		}
+	}
+	return nil
+}
+
+// stepConfig returns a copy of the given Config for a sample of the given
+// step, with its own RunID and the step's tags and timeout.
+// If the given Config has an artifacts directory, then the artifacts of each
+// run are saved to a `gobench-<RunID>` directory within it.
+func (s *Scenario) stepConfig(base *define.Config, step *Step, sample int) define.Config {
+	cfg := *base
+	cfg.RunID = uuid.New().String()
+	cfg.CampaignID = s.CampaignID
+	cfg.Tags = mergeStrings(base.Tags, s.Tags, step.Tags, map[string]string{
+		StepTag:   step.Name,
+		SampleTag: strconv.Itoa(sample),
+	})
+	if timeout := s.timeout(step); timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	if len(base.ArtifactsDir) > 0 {
+		cfg.ArtifactsDir = filepath.Join(base.ArtifactsDir, artifacts.DefaultDir(cfg.RunID))
+	}
+	return cfg
+}
+
+// runStep runs each sample of the given step between its hooks, returning a
+// StepResult for each and whether any of them failed.
+// If a sample fails, then the remaining samples are only run if the step
+// continues on error.
+func (s *Scenario) runStep(base *define.Config, step *Step, runStep RunStepFunc) ([]StepResult, bool) {
+	restore := setEnv(mergeStrings(step.Env, map[string]string{StepEnv: step.Name}))
+	defer restore()
+
+	if err := RunHooks("pre", step.Hooks.Pre); err != nil {
+		return []StepResult{{Step: step.Name, Err: err}}, true
+	}
+
+	results := []StepResult{}
+	failed := false
+	for sample := 1; sample <= step.Samples; sample++ {
+		if failed && !s.continueOnError(step) {
+			results = append(results, StepResult{Step: step.Name, Sample: sample, Skipped: true})
+			continue
+		}
+		cfg := s.stepConfig(base, step, sample)
+		log.Info().
+			Str("campaign_id", s.CampaignID).
+			Str("step", step.Name).
+			Int("sample", sample).
+			Str("run_id", cfg.RunID).
+			Msg("Running scenario step.")
+		result := StepResult{
+			Step:      step.Name,
+			Sample:    sample,
+			RunID:     cfg.RunID,
+			StartTime: time.Now().UTC(),
+		}
+		result.Err = runStep(&cfg, step)
+		result.EndTime = time.Now().UTC()
+		if result.Err != nil {
+			failed = true
+			log.Error().
+				Err(result.Err).
+				Str("step", step.Name).
+				Int("sample", sample).
+				Msg("Scenario step failed.")
+		}
+		results = append(results, result)
+	}
+
+	if err := RunHooks("post", step.Hooks.Post); err != nil {
+		results = append(results, StepResult{Step: step.Name, Err: err})
+		failed = true
+	}
+	return results, failed
+}
+
+// Run runs each step of the Scenario in order using the given RunStepFunc,
+// returning a StepResult for each sample and an error if any of them failed.
+// The scenario's hooks are run before the first step and after the last, and
+// its environment is set for the whole run. Post hooks are run even if a step
+// fails. If a step fails and doesn't continue on error, then the remaining
+// steps are skipped.
+func (s *Scenario) Run(base *define.Config, runStep RunStepFunc) ([]StepResult, error) {
+	restore := setEnv(mergeStrings(s.Env, map[string]string{CampaignIDEnv: s.CampaignID}))
+	defer restore()
+
+	results := []StepResult{}
+	stopped := false
+	if err := RunHooks("pre", s.Hooks.Pre); err != nil {
+		results = append(results, StepResult{Err: err})
+		stopped = true
+	}
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		if stopped {
+			for sample := 1; sample <= step.Samples; sample++ {
+				results = append(results, StepResult{Step: step.Name, Sample: sample, Skipped: true})
+			}
+			continue
+		}
+		stepResults, failed := s.runStep(base, step, runStep)
+		results = append(results, stepResults...)
+		if failed && !s.continueOnError(step) {
+			log.Warn().
+				Str("step", step.Name).
+				Msg("Stopping scenario, as the step failed without continue-on-error.")
+			stopped = true
+		}
+	}
+	if err := RunHooks("post", s.Hooks.Post); err != nil {
+		results = append(results, StepResult{Err: err})
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return results, fmt.Errorf("%d step(s) or hook(s) of the scenario failed", failed)
+	}
+	return results, nil
+}
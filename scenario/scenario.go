@@ -0,0 +1,212 @@
+// Package scenario defines scenario files, which describe a campaign of
+// benchmark runs in yaml, and runs them.
+package scenario
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Hooks lists shell commands to run before and after a scenario or step.
+type Hooks struct {
+	Pre  []string `yaml:"pre"`
+	Post []string `yaml:"post"`
+}
+
+// Step is a single benchmark within a scenario.
+// Args are given to the benchmark exactly as they would be given to its
+// `gobench run` subcommand. Env holds environment variables set while the
+// step runs, such as variables for a uperf workload. The step is run Samples
+// times, each with its own RunID, defaulting to once.
+// Exporters holds options of `gobench run` for the step, such as
+// `elasticsearch-url` or `print-json`, keyed by flag name.
+// Tags, Env, Exporters, Timeout and ContinueOnError override those given for
+// the whole scenario.
+type Step struct {
+	Name            string                 `yaml:"name"`
+	Benchmark       string                 `yaml:"benchmark"`
+	Args            []string               `yaml:"args"`
+	Env             map[string]string      `yaml:"env"`
+	Samples         int                    `yaml:"samples"`
+	Timeout         time.Duration          `yaml:"timeout"`
+	Tags            map[string]string      `yaml:"tags"`
+	Exporters       map[string]interface{} `yaml:"exporters"`
+	ContinueOnError *bool                  `yaml:"continue-on-error"`
+	Hooks           Hooks                  `yaml:"hooks"`
+}
+
+// Scenario describes a campaign of benchmark runs, being an ordered list of
+// steps along with options shared by each of them.
+// Every run within the scenario shares its CampaignID. If ContinueOnError is
+// false, then the first failed step stops the scenario.
+type Scenario struct {
+	Name            string                 `yaml:"name"`
+	CampaignID      string                 `yaml:"campaign-id"`
+	Tags            map[string]string      `yaml:"tags"`
+	Env             map[string]string      `yaml:"env"`
+	Exporters       map[string]interface{} `yaml:"exporters"`
+	Timeout         time.Duration          `yaml:"timeout"`
+	ContinueOnError bool                   `yaml:"continue-on-error"`
+	Hooks           Hooks                  `yaml:"hooks"`
+	Steps           []Step                 `yaml:"steps"`
+}
+
+// reservedExporterOptions lists options of `gobench run` which can't be given
+// within a scenario's exporters, as the scenario sets them itself.
+var reservedExporterOptions map[string]string = map[string]string{
+	"uuid":    "each run is given its own ID",
+	"tag":     "use tags instead",
+	"timeout": "use timeout instead",
+}
+
+// Parse parses the given scenario yaml, filling in defaults and validating it.
+// Unknown fields are an error, to catch typos.
+func Parse(raw []byte) (*Scenario, error) {
+	scenario := &Scenario{}
+	if err := yaml.UnmarshalStrict(raw, scenario); err != nil {
+		return nil, fmt.Errorf("unable to parse scenario: %s", err)
+	}
+	for i := range scenario.Steps {
+		step := &scenario.Steps[i]
+		if len(step.Name) == 0 {
+			step.Name = fmt.Sprintf("%s-%d", step.Benchmark, i)
+		}
+		if step.Samples == 0 {
+			step.Samples = 1
+		}
+	}
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+	return scenario, nil
+}
+
+// Load reads and parses the scenario file at the given path.
+func Load(path string) (*Scenario, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read scenario at %s: %s", path, err)
+	}
+	scenario, err := Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return scenario, nil
+}
+
+// validateExporters checks that the given exporter options only hold scalar
+// values or lists of them, and none of the reserved options.
+func validateExporters(exporters map[string]interface{}) error {
+	for name, value := range exporters {
+		if reason, ok := reservedExporterOptions[name]; ok {
+			return fmt.Errorf("exporter option '%s' can't be set within a scenario, %s", name, reason)
+		}
+		values, isList := value.([]interface{})
+		if !isList {
+			values = []interface{}{value}
+		}
+		for _, value := range values {
+			switch value.(type) {
+			case string, bool, int, float64:
+			default:
+				return fmt.Errorf("exporter option '%s' must be a string, number, bool or list of them", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks that the Scenario has at least one step, that each step
+// has a unique name and a benchmark, and that exporter options are valid.
+func (s *Scenario) Validate() error {
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("scenario has no steps")
+	}
+	if err := validateExporters(s.Exporters); err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for i, step := range s.Steps {
+		if len(step.Benchmark) == 0 {
+			return fmt.Errorf("step %d (%s) has no benchmark", i, step.Name)
+		}
+		if names[step.Name] {
+			return fmt.Errorf("step %d has the same name as an earlier step: %s", i, step.Name)
+		}
+		names[step.Name] = true
+		if step.Samples < 1 {
+			return fmt.Errorf("step %d (%s) must have at least one sample, got %d", i, step.Name, step.Samples)
+		}
+		if step.Timeout < 0 {
+			return fmt.Errorf("step %d (%s) has a negative timeout", i, step.Name)
+		}
+		if err := validateExporters(step.Exporters); err != nil {
+			return fmt.Errorf("step %d (%s): %s", i, step.Name, err)
+		}
+	}
+	return nil
+}
+
+// mergeStrings returns a new map holding the entries of each given map, with
+// later maps taking precedence.
+func mergeStrings(maps ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range maps {
+		for key, value := range m {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// ExporterArgs returns the exporter options for the given step as arguments
+// for `gobench run`, ie `--elasticsearch-url=http://...`, with options given
+// for the step taking precedence over those given for the scenario.
+// Each value of a list is given as its own argument.
+func (s *Scenario) ExporterArgs(step *Step) []string {
+	merged := map[string]interface{}{}
+	for name, value := range s.Exporters {
+		merged[name] = value
+	}
+	for name, value := range step.Exporters {
+		merged[name] = value
+	}
+	names := []string{}
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := []string{}
+	for _, name := range names {
+		values, isList := merged[name].([]interface{})
+		if !isList {
+			values = []interface{}{merged[name]}
+		}
+		for _, value := range values {
+			args = append(args, fmt.Sprintf("--%s=%v", name, value))
+		}
+	}
+	return args
+}
+
+// continueOnError returns true if the scenario should keep going after the
+// given step fails.
+func (s *Scenario) continueOnError(step *Step) bool {
+	if step.ContinueOnError != nil {
+		return *step.ContinueOnError
+	}
+	return s.ContinueOnError
+}
+
+// timeout returns the timeout for each run of the given step.
+func (s *Scenario) timeout(step *Step) time.Duration {
+	if step.Timeout > 0 {
+		return step.Timeout
+	}
+	return s.Timeout
+}
@@ -0,0 +1,190 @@
+package scenario
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/learnitall/gobench/define"
+)
+
+var SCENARIO_YAML string = `
+name: nightly
+campaign-id: campaign-1
+tags:
+  team: perf
+env:
+  h: 127.0.0.1
+exporters:
+  elasticsearch-url: http://localhost:9200
+  best-effort-exporters: [elasticsearch, json]
+timeout: 10m
+steps:
+  - benchmark: uperf
+    args: ["--serve", "--preset", "stream", "--", "-R"]
+  - name: rr
+    benchmark: uperf
+    args: ["rr.xml"]
+    env:
+      nthr: "8"
+    samples: 3
+    timeout: 1m
+    tags:
+      preset: rr
+    exporters:
+      print-json: true
+      elasticsearch-url: http://other:9200
+    continue-on-error: true
+    hooks:
+      pre: ["echo pre"]
+`
+
+// TestParse checks that scenarios are parsed with defaults filled in.
+func TestParse(t *testing.T) {
+	scenario, err := Parse([]byte(SCENARIO_YAML))
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing scenario: %s", err)
+	}
+	if scenario.Name != "nightly" || scenario.CampaignID != "campaign-1" || scenario.Timeout != 10*time.Minute {
+		t.Errorf("Expected scenario options to be parsed, instead got %+v", scenario)
+	}
+	if len(scenario.Steps) != 2 {
+		t.Fatalf("Expected 2 steps, instead got %d", len(scenario.Steps))
+	}
+	first, second := scenario.Steps[0], scenario.Steps[1]
+	if first.Name != "uperf-0" || first.Samples != 1 || first.ContinueOnError != nil {
+		t.Errorf("Expected first step to be given defaults, instead got %+v", first)
+	}
+	if second.Samples != 3 || second.Timeout != time.Minute || !*second.ContinueOnError || second.Hooks.Pre[0] != "echo pre" {
+		t.Errorf("Expected second step options to be parsed, instead got %+v", second)
+	}
+
+	expected := []string{
+		"--best-effort-exporters=elasticsearch",
+		"--best-effort-exporters=json",
+		"--elasticsearch-url=http://other:9200",
+		"--print-json=true",
+	}
+	if args := scenario.ExporterArgs(&second); !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected exporter args %v, instead got %v", expected, args)
+	}
+}
+
+// TestParseInvalid checks that invalid scenarios are rejected.
+func TestParseInvalid(t *testing.T) {
+	for _, raw := range []string{
+		"name: empty",
+		"steps:\n  - args: [a]",
+		"steps:\n  - benchmark: uperf\n    samplez: 2",
+		"steps:\n  - benchmark: uperf\n    samples: -1",
+		"steps:\n  - name: a\n    benchmark: uperf\n  - name: a\n    benchmark: uperf",
+		"steps:\n  - benchmark: uperf\n    exporters:\n      uuid: abc",
+		"exporters:\n  tag: {a: b}\nsteps:\n  - benchmark: uperf",
+		"steps:\n  - benchmark: uperf\n    exporters:\n      print-json: {a: b}",
+	} {
+		if _, err := Parse([]byte(raw)); err == nil {
+			t.Errorf("Expected error when parsing invalid scenario %q, instead got nil", raw)
+		}
+	}
+}
+
+// TestRun checks that each sample of each step is run with its own RunID and
+// the step's options, and that steps are skipped after a failure unless they
+// continue on error.
+func TestRun(t *testing.T) {
+	scenario, err := Parse([]byte(`
+campaign-id: campaign-1
+tags: {team: perf}
+env: {GOBENCH_TEST_HOST: 127.0.0.1}
+steps:
+  - name: flaky
+    benchmark: test
+    samples: 2
+    continue-on-error: true
+    env: {GOBENCH_TEST_NTHR: "8"}
+  - name: failing
+    benchmark: test
+    timeout: 1m
+  - name: skipped
+    benchmark: test
+`))
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing scenario: %s", err)
+	}
+
+	base := &define.Config{Tags: map[string]string{"host": "a"}, ArtifactsDir: "out"}
+	configs := []define.Config{}
+	results, err := scenario.Run(base, func(cfg *define.Config, step *Step) error {
+		configs = append(configs, *cfg)
+		if os.Getenv("GOBENCH_TEST_HOST") != "127.0.0.1" || os.Getenv(CampaignIDEnv) != "campaign-1" {
+			t.Errorf("Expected scenario environment to be set during %s", step.Name)
+		}
+		if step.Name == "flaky" && os.Getenv("GOBENCH_TEST_NTHR") != "8" {
+			t.Errorf("Expected step environment to be set during %s", step.Name)
+		}
+		if step.Name == "failing" || cfg.Tags[SampleTag] == "1" {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "2 step(s)") {
+		t.Errorf("Expected error for 2 failed runs, instead got: %v", err)
+	}
+	if _, ok := os.LookupEnv("GOBENCH_TEST_HOST"); ok {
+		t.Errorf("Expected scenario environment to be restored after the run")
+	}
+
+	if len(configs) != 3 {
+		t.Fatalf("Expected 3 runs, instead got %d", len(configs))
+	}
+	if configs[0].RunID == configs[1].RunID || configs[0].CampaignID != "campaign-1" {
+		t.Errorf("Expected each run to have its own RunID within the campaign, instead got %+v", configs)
+	}
+	if configs[1].Tags["team"] != "perf" || configs[1].Tags["host"] != "a" ||
+		configs[1].Tags[StepTag] != "flaky" || configs[1].Tags[SampleTag] != "2" {
+		t.Errorf("Expected run to be tagged with its step and sample, instead got %v", configs[1].Tags)
+	}
+	if configs[2].Timeout != time.Minute || configs[2].ArtifactsDir != filepath.Join("out", "gobench-"+configs[2].RunID) {
+		t.Errorf("Expected step timeout and artifacts directory, instead got %+v", configs[2])
+	}
+	if len(base.Tags) != 1 {
+		t.Errorf("Expected base config to be unchanged, instead got tags %v", base.Tags)
+	}
+
+	if len(results) != 4 || !results[3].Skipped || results[3].Step != "skipped" {
+		t.Errorf("Expected the last step to be skipped, instead got %+v", results)
+	}
+}
+
+// TestRunHooks checks that failed hooks fail the scenario, and that post
+// hooks still run.
+func TestRunHooks(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "post")
+	scenario, err := Parse([]byte(fmt.Sprintf(`
+hooks:
+  pre: ["true", "exit 2"]
+  post: ["touch %s"]
+steps:
+  - benchmark: test
+`, marker)))
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing scenario: %s", err)
+	}
+	results, err := scenario.Run(&define.Config{}, func(cfg *define.Config, step *Step) error {
+		t.Errorf("Expected no steps to run after the pre hook failed")
+		return nil
+	})
+	if err == nil {
+		t.Errorf("Expected error when a hook fails, instead got nil")
+	}
+	if len(results) != 2 || !strings.Contains(results[0].Err.Error(), "exit 2") || !results[1].Skipped {
+		t.Errorf("Expected a failed hook and a skipped step, instead got %+v", results)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("Expected post hook to run after the pre hook failed")
+	}
+}
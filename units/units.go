@@ -0,0 +1,221 @@
+// Package units parses the human readable quantities printed by benchmarks,
+// such as data sizes, data rates, operation rates and durations.
+//
+// Data units distinguish bits (b) from bytes (B). Prefixes with an `i`, such
+// as Ki and Gi, are always powers of 1024 (IEC), while the meaning of plain
+// prefixes, such as k and G, depends on the benchmark printing them and is
+// decided by a Convention.
+package units
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// System is a system of prefixes for multiples of a unit.
+type System int
+
+const (
+	// SI prefixes are powers of 1000, ie 1kb is 1000 bits.
+	SI System = iota
+	// IEC prefixes are powers of 1024, ie 1KiB is 1024 bytes.
+	IEC
+)
+
+// base returns the multiple between successive prefixes of the system.
+func (s System) base() float64 {
+	if s == IEC {
+		return 1024
+	}
+	return 1000
+}
+
+// Convention decides which System plain prefixes are interpreted with, for
+// amounts given in bytes and amounts given in bits.
+type Convention struct {
+	Bytes System
+	Bits  System
+}
+
+// Uperf is the convention used by uperf. Sizes in bytes use powers of 1024,
+// so 1GB is 2^30 bytes, while rates in bits use powers of 1000, so 1Gb/s is
+// 10^9 bits per second.
+var Uperf Convention = Convention{Bytes: IEC, Bits: SI}
+
+// prefixPowers matches each prefix to its power of the prefix system's base.
+var prefixPowers map[byte]float64 = map[byte]float64{
+	'k': 1,
+	'K': 1,
+	'M': 2,
+	'G': 3,
+	'T': 4,
+	'P': 5,
+	'E': 6,
+}
+
+// Data is an amount of data, in bits.
+type Data float64
+
+// Bits returns the amount of data in bits, rounded to the nearest bit.
+func (d Data) Bits() int64 {
+	return int64(math.Round(float64(d)))
+}
+
+// Bytes returns the amount of data in bytes, rounded to the nearest byte.
+func (d Data) Bytes() int64 {
+	return int64(math.Round(float64(d) / 8))
+}
+
+// splitNumber splits the given string into the number it starts with and the
+// unit which follows it, ignoring whitespace in between.
+func splitNumber(humanString string) (float64, string, error) {
+	humanString = strings.TrimSpace(humanString)
+	end := 0
+	if strings.HasPrefix(humanString, "-") || strings.HasPrefix(humanString, "+") {
+		end++
+	}
+	for end < len(humanString) && (humanString[end] == '.' || (humanString[end] >= '0' && humanString[end] <= '9')) {
+		end++
+	}
+	if end == 0 {
+		return 0, "", fmt.Errorf("expected %q to start with a number", humanString)
+	}
+	value, err := strconv.ParseFloat(humanString[:end], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("unable to parse number from %q: %s", humanString, err)
+	}
+	return value, strings.TrimSpace(humanString[end:]), nil
+}
+
+// dataUnitBits returns the number of bits in the given data unit, such as
+// `B`, `Kb`, `GB`, `MiB` or `k`. An empty unit is a byte.
+func dataUnitBits(unit string, convention Convention) (float64, error) {
+	switch unit {
+	case "", "B", "byte", "bytes":
+		return 8, nil
+	case "b", "bit", "bits":
+		return 1, nil
+	}
+
+	power, found := prefixPowers[unit[0]]
+	if !found {
+		return 0, fmt.Errorf("unknown data unit %q", unit)
+	}
+	// A prefix on its own is a multiple of bytes, as in uperf's `size=8k`
+	rest := unit[1:]
+	if len(rest) == 0 {
+		rest = "B"
+	}
+	system := convention.Bytes
+	explicitIEC := strings.HasPrefix(rest, "i")
+	if explicitIEC {
+		rest = rest[1:]
+	}
+
+	var bits float64
+	switch rest {
+	case "B":
+		bits = 8
+	case "b":
+		bits = 1
+		system = convention.Bits
+	default:
+		return 0, fmt.Errorf("unknown data unit %q", unit)
+	}
+	if explicitIEC {
+		system = IEC
+	}
+	return bits * math.Pow(system.base(), power), nil
+}
+
+// newData returns the given amount of the given data unit.
+func newData(value float64, unit string, humanString string, convention Convention) (Data, error) {
+	if value < 0 {
+		return 0, fmt.Errorf("expected a positive amount of data, instead got %q", humanString)
+	}
+	bits, err := dataUnitBits(unit, convention)
+	if err != nil {
+		return 0, err
+	}
+	return Data(value * bits), nil
+}
+
+// ParseData parses an amount of data of the format `<float><unit>`, such as
+// `66.11GB`, `512KiB`, `8Mb` or `8k`. A number without a unit, or with only a
+// prefix, is a number of bytes.
+func ParseData(humanString string, convention Convention) (Data, error) {
+	value, unit, err := splitNumber(humanString)
+	if err != nil {
+		return 0, err
+	}
+	return newData(value, unit, humanString, convention)
+}
+
+// ParseDataRate parses a rate of data of the format `<float><unit>/s` or
+// `<float><unit>ps`, such as `18.92Gb/s` or `100MBps`, returning the amount
+// of data per second. A number without a unit is a number of bytes per
+// second, as uperf prints a rate of `0` without a unit.
+func ParseDataRate(humanString string, convention Convention) (Data, error) {
+	value, unit, err := splitNumber(humanString)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case strings.HasSuffix(unit, "/s"):
+		unit = strings.TrimSuffix(unit, "/s")
+	case strings.HasSuffix(unit, "ps"):
+		unit = strings.TrimSuffix(unit, "ps")
+	case len(unit) > 0:
+		return 0, fmt.Errorf("expected data rate %q to be per second", humanString)
+	}
+	return newData(value, unit, humanString, convention)
+}
+
+// ParseOpRate parses a rate of operations of the format `<float>op/s` or
+// `<float>ops/s`, such as `288655op/s`, returning the operations per second.
+// A number without a unit is a number of operations per second.
+func ParseOpRate(humanString string) (float64, error) {
+	value, unit, err := splitNumber(humanString)
+	if err != nil {
+		return 0, err
+	}
+	switch unit {
+	case "", "op/s", "ops/s", "ops":
+		return value, nil
+	}
+	return 0, fmt.Errorf("unknown operation rate unit %q", unit)
+}
+
+// durationUnitSeconds matches each duration unit to the seconds within it.
+var durationUnitSeconds map[string]float64 = map[string]float64{
+	"ns": 1e-9,
+	"us": 1e-6,
+	"µs": 1e-6,
+	"μs": 1e-6,
+	"ms": 1e-3,
+	"s":  1,
+	"m":  60,
+	"h":  60 * 60,
+}
+
+// ParseDuration parses a duration of the format `<float><unit>`, such as
+// `34.61us`, `0.00ns` or `4.11ms`, returning the number of seconds. Units
+// may be wrapped in parentheses, as uperf does with `30.23(s)`.
+// Unlike time.ParseDuration, the result isn't rounded to the nearest
+// nanosecond.
+func ParseDuration(humanString string) (float64, error) {
+	value, unit, err := splitNumber(humanString)
+	if err != nil {
+		return 0, err
+	}
+	if strings.HasPrefix(unit, "(") && strings.HasSuffix(unit, ")") {
+		unit = unit[1 : len(unit)-1]
+	}
+	seconds, found := durationUnitSeconds[unit]
+	if !found {
+		return 0, fmt.Errorf("unknown duration unit %q in %q", unit, humanString)
+	}
+	return value * seconds, nil
+}
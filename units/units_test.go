@@ -0,0 +1,208 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+// closeTo checks that the given values are within a relative tolerance of 1e-9.
+func closeTo(actual float64, expected float64) bool {
+	if expected == 0 {
+		return actual == 0
+	}
+	return math.Abs(actual-expected)/math.Abs(expected) < 1e-9
+}
+
+// TestParseData checks amounts of data in bits and bytes, with SI and IEC
+// prefixes, including sizes printed by uperf.
+func TestParseData(t *testing.T) {
+	tests := []struct {
+		input      string
+		convention Convention
+		bits       float64
+	}{
+		// Uperf's transaction and run statistics
+		{"0", Uperf, 0},
+		{"66.11GB", Uperf, 66.11 * 8 * (1 << 30)},
+		{"6.61GB", Uperf, 6.61 * 8 * (1 << 30)},
+		{"74.46GB", Uperf, 74.46 * 8 * (1 << 30)},
+		{"100.00KB", Uperf, 100 * 8 * 1024},
+		// Sizes within uperf workloads
+		{"8k", Uperf, 8 * 8 * 1024},
+		{"1M", Uperf, 8 * (1 << 20)},
+		// Bits and bytes without a prefix
+		{"12", Uperf, 12 * 8},
+		{"12B", Uperf, 12 * 8},
+		{"12b", Uperf, 12},
+		{"12 bytes", Uperf, 12 * 8},
+		{"12 bits", Uperf, 12},
+		// Plain prefixes follow the convention
+		{"1kB", Convention{Bytes: SI, Bits: SI}, 8 * 1000},
+		{"1KB", Convention{Bytes: IEC, Bits: SI}, 8 * 1024},
+		{"1Mb", Convention{Bytes: IEC, Bits: SI}, 1000 * 1000},
+		{"1Mb", Convention{Bytes: IEC, Bits: IEC}, 1024 * 1024},
+		{"2TB", Convention{Bytes: SI, Bits: SI}, 2 * 8 * 1e12},
+		{"1PB", Convention{Bytes: IEC, Bits: SI}, 8 * math.Pow(1024, 5)},
+		{"1EB", Convention{Bytes: SI, Bits: SI}, 8 * 1e18},
+		// Explicit IEC prefixes ignore the convention
+		{"1KiB", Convention{Bytes: SI, Bits: SI}, 8 * 1024},
+		{"1.5GiB", Convention{Bytes: SI, Bits: SI}, 1.5 * 8 * (1 << 30)},
+		{"1Gib", Convention{Bytes: SI, Bits: SI}, 1 << 30},
+	}
+	for _, test := range tests {
+		data, err := ParseData(test.input, test.convention)
+		if err != nil {
+			t.Errorf("Unexpected error when parsing %q: %s", test.input, err)
+			continue
+		}
+		if !closeTo(float64(data), test.bits) {
+			t.Errorf("Expected %q to be %v bits, instead got %v", test.input, test.bits, float64(data))
+		}
+	}
+}
+
+// TestParseDataInvalid checks that malformed amounts of data are rejected.
+func TestParseDataInvalid(t *testing.T) {
+	for _, input := range []string{"", "GB", "1XB", "1Gx", "1GiX", "-1GB", "1GB/s", "1.2.3GB"} {
+		if data, err := ParseData(input, Uperf); err == nil {
+			t.Errorf("Expected error when parsing %q, instead got %v", input, float64(data))
+		}
+	}
+}
+
+// TestParseDataRate checks rates of data printed by uperf, which are in bits
+// with SI prefixes, along with other rate formats.
+func TestParseDataRate(t *testing.T) {
+	tests := []struct {
+		input string
+		bits  int64
+		bytes int64
+	}{
+		// Uperf's transaction, netstat and run statistics
+		{"0", 0, 0},
+		{"18.92Gb/s", 18920000000, 2365000000},
+		{"19.08Gb/s", 19080000000, 2385000000},
+		{"1.82Gb/s", 1820000000, 227500000},
+		{"20.22Gb/s", 20220000000, 2527500000},
+		{"15.51Gb/s", 15510000000, 1938750000},
+		{"512.00Mb/s", 512000000, 64000000},
+		{"8.00Kb/s", 8000, 1000},
+		{"17.32b/s", 17, 2},
+		// Bytes and other suffixes
+		{"100MB/s", 100 * 8 * (1 << 20), 100 * (1 << 20)},
+		{"100Mbps", 100000000, 12500000},
+		{"1KiB/s", 8 * 1024, 1024},
+	}
+	for _, test := range tests {
+		data, err := ParseDataRate(test.input, Uperf)
+		if err != nil {
+			t.Errorf("Unexpected error when parsing %q: %s", test.input, err)
+			continue
+		}
+		if data.Bits() != test.bits || data.Bytes() != test.bytes {
+			t.Errorf(
+				"Expected %q to be %d bits/s and %d bytes/s, instead got %d and %d",
+				test.input, test.bits, test.bytes, data.Bits(), data.Bytes(),
+			)
+		}
+	}
+
+	for _, input := range []string{"18.92Gb", "18.92Gb/m", "Gb/s", "18.92Gx/s"} {
+		if data, err := ParseDataRate(input, Uperf); err == nil {
+			t.Errorf("Expected error when parsing %q, instead got %v", input, float64(data))
+		}
+	}
+}
+
+// TestParseDataRateMatchesUperf checks that the rate uperf prints for a
+// transaction matches the data and time it prints alongside it, ie
+// `66.11GB /  30.23(s) =    18.78Gb/s`.
+func TestParseDataRateMatchesUperf(t *testing.T) {
+	data, err := ParseData("66.11GB", Uperf)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing data: %s", err)
+	}
+	seconds, err := ParseDuration("30.23(s)")
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing duration: %s", err)
+	}
+	rate, err := ParseDataRate("18.78Gb/s", Uperf)
+	if err != nil {
+		t.Fatalf("Unexpected error when parsing rate: %s", err)
+	}
+	computed := float64(data) / seconds
+	if math.Abs(computed-float64(rate))/float64(rate) > 0.001 {
+		t.Errorf("Expected %v bits/s from data and time, instead got %v", float64(rate), computed)
+	}
+}
+
+// TestParseOpRate checks rates of operations printed by uperf.
+func TestParseOpRate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"0op/s", 0},
+		{"1op/s", 1},
+		{"288655op/s", 288655},
+		{"267977op/s", 267977},
+		{"12.5ops/s", 12.5},
+		{"42", 42},
+	}
+	for _, test := range tests {
+		ops, err := ParseOpRate(test.input)
+		if err != nil {
+			t.Errorf("Unexpected error when parsing %q: %s", test.input, err)
+			continue
+		}
+		if ops != test.expected {
+			t.Errorf("Expected %q to be %v op/s, instead got %v", test.input, test.expected, ops)
+		}
+	}
+
+	for _, input := range []string{"op/s", "12op/m", "12Gb/s"} {
+		if ops, err := ParseOpRate(input); err == nil {
+			t.Errorf("Expected error when parsing %q, instead got %v", input, ops)
+		}
+	}
+}
+
+// TestParseDuration checks durations printed by uperf.
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		input   string
+		seconds float64
+	}{
+		// Uperf's transaction, averages and run statistics
+		{"1.00(s)", 1},
+		{"30.23(s)", 30.23},
+		{"0.00(s)", 0},
+		{"32.33s", 32.33},
+		{"107.04us", 107.04e-6},
+		{"34.61us", 34.61e-6},
+		{"0.00ns", 0},
+		{"4.11ms", 4.11e-3},
+		{"184467440ms", 184467.44},
+		// Other units
+		{"250ns", 250e-9},
+		{"1.5µs", 1.5e-6},
+		{"2m", 120},
+		{"1.5h", 5400},
+	}
+	for _, test := range tests {
+		seconds, err := ParseDuration(test.input)
+		if err != nil {
+			t.Errorf("Unexpected error when parsing %q: %s", test.input, err)
+			continue
+		}
+		if !closeTo(seconds, test.seconds) {
+			t.Errorf("Expected %q to be %vs, instead got %vs", test.input, test.seconds, seconds)
+		}
+	}
+
+	for _, input := range []string{"", "s", "12", "12d", "12(ms", "1.2.3s"} {
+		if seconds, err := ParseDuration(input); err == nil {
+			t.Errorf("Expected error when parsing %q, instead got %v", input, seconds)
+		}
+	}
+}